@@ -0,0 +1,35 @@
+package main
+
+import (
+    i18n "./i18n"
+)
+
+// stats counts the users and what they are doing.
+func (botStorage *TicTacToeBotStorage) stats() (users int, playing int, searching int) {
+    botStorage.mutex.Lock()
+    defer botStorage.mutex.Unlock()
+    for _, userState := range botStorage.UserId2UserState {
+        if userState.User == nil {
+            continue
+        }
+        users++
+        if userState.State == InGame {
+            playing++
+        }
+    }
+    return users, playing, len(botStorage.UsersSearching)
+}
+
+// registerAdminHandlers adds the commands of the users listed in admins;
+// to anybody else they are unknown.
+func registerAdminHandlers(router *Router, botStorage *TicTacToeBotStorage) {
+    router.Command("/stats", func(input *Input) error {
+        userState := botStorage.RegisterUser(input)
+        if !botStorage.config.IsAdmin(userState.User) {
+            return nil
+        }
+        users, playing, searching := botStorage.stats()
+        return SendEditable(botStorage, &userState, NewMessage, MessageNotEditable,
+                            i18n.T(userState.Lang(), i18n.Stats, users, playing, searching))
+    })
+}
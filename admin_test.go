@@ -0,0 +1,52 @@
+package main
+
+import (
+    "testing"
+
+    i18n "./i18n"
+)
+
+func TestStatsForAdminsOnly(t *testing.T) {
+    botStorage, transport := newTestBot(t, DefaultConfig().Rules)
+    botStorage.config.Admins = []string{"1", "discord:201"}
+    router := NewRouter()
+    registerAdminHandlers(router, botStorage)
+    startTestGame(t, botStorage, transport)
+    const discordAdmin, discordUser int64 = -1, -2
+
+    for _, input := range []*Input{
+        testInput(testX),
+        testInput(testO),
+        {User: User{ID: discordAdmin, Platform: PlatformDiscord, ExternalID: "201"}},
+        {User: User{ID: discordUser, Platform: PlatformDiscord, ExternalID: "1"}},
+    } {
+        input.Text = "/stats"
+        if err := router.Dispatch(input); err != nil {
+            t.Fatal(err)
+        }
+    }
+    expectCall(t, transport, testX, "send", english(i18n.Stats, 2, 2, 0))
+    expectCall(t, transport, discordAdmin, "send", english(i18n.Stats, 3, 2, 0))
+    for _, userId := range []int64{testO, discordUser} {
+        if calls := transport.to(userId, "send"); len(calls) != 0 {
+            t.Errorf("user %d who is not an admin got %+v", userId, calls)
+        }
+    }
+}
+
+func TestValidAdmin(t *testing.T) {
+    for admin, want := range map[string]bool{
+        "123456": true,
+        "discord:80351110224678912": true,
+        "web:0123456789abcdef": true,
+        "-5": false,
+        "0": false,
+        "discord:": false,
+        "slack:U123": false,
+        "alice": false,
+    } {
+        if validAdmin(admin) != want {
+            t.Errorf("validAdmin(%q) = %v", admin, !want)
+        }
+    }
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+    "context"
+    "crypto/subtle"
+    "encoding/json"
+    "fmt"
+    "log"
+    "net"
+    "net/http"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+
+    game "./game"
+)
+
+// APIServer is the JSON API for dashboards and other bots. It works on the
+// bot's own state, so games created or played through it are the same games
+// the players see in their messengers.
+type APIServer struct {
+    botStorage *TicTacToeBotStorage
+    tokens []string
+    listener net.Listener
+    server *http.Server
+}
+
+type apiError struct {
+    status int
+    message string
+}
+
+func (err apiError) Error() string {
+    return err.message
+}
+
+func apiErrorf(status int, format string, args ...interface{}) error {
+    return apiError{status, fmt.Sprintf(format, args...)}
+}
+
+type apiUser struct {
+    ID int64 `json:"id"`
+    Platform string `json:"platform"`
+    Name string `json:"name"`
+    Username string `json:"username,omitempty"`
+    State State `json:"state"`
+    GameID int64 `json:"game_id,omitempty"`
+    OpponentID int64 `json:"opponent_id,omitempty"`
+}
+
+type apiGame struct {
+    ID int64 `json:"id"`
+    XUserID int64 `json:"x_user_id"`
+    OUserID int64 `json:"o_user_id"`
+    Width int `json:"width"`
+    Height int `json:"height"`
+    WinLength int `json:"win_length"`
+    // Board has a row per string, "X", "O" or "." per cell.
+    Board []string `json:"board"`
+    Moves []string `json:"moves"`
+    Turn string `json:"turn,omitempty"`
+    Finished bool `json:"finished"`
+    // Result is "X", "O" or "draw" once the game is finished.
+    Result string `json:"result,omitempty"`
+    StartedAt time.Time `json:"started_at"`
+    FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+type apiNewGame struct {
+    XUserID int64 `json:"x_user_id"`
+    OUserID int64 `json:"o_user_id"`
+}
+
+type apiMove struct {
+    UserID int64 `json:"user_id"`
+    // Move is a cell as players type it: "e5" or "3 4".
+    Move string `json:"move"`
+}
+
+func NewAPIServer(config Config, botStorage *TicTacToeBotStorage) (*APIServer, error) {
+    listener, err := net.Listen("tcp", config.API.Listen)
+    if err != nil {
+        return nil, err
+    }
+    api := &APIServer{botStorage: botStorage, tokens: config.API.Tokens, listener: listener}
+    api.server = &http.Server{Handler: api}
+    return api, nil
+}
+
+// Addr is the address the server listens on, useful with port 0.
+func (api *APIServer) Addr() string {
+    return api.listener.Addr().String()
+}
+
+func (api *APIServer) Start() {
+    if err := api.server.Serve(api.listener); err != http.ErrServerClosed {
+        log.Println("API server failed", err)
+    }
+}
+
+func (api *APIServer) Stop() {
+    ctx, cancel := context.WithTimeout(context.Background(), 5 * time.Second)
+    defer cancel()
+    api.server.Shutdown(ctx)
+}
+
+func (api *APIServer) authorized(r *http.Request) bool {
+    token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+    for _, allowed := range api.tokens {
+        if subtle.ConstantTimeCompare([]byte(token), []byte(allowed)) == 1 {
+            return true
+        }
+    }
+    return false
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(status)
+    json.NewEncoder(w).Encode(v)
+}
+
+func (api *APIServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+    if !api.authorized(r) {
+        w.Header().Set("WWW-Authenticate", "Bearer")
+        writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "missing or wrong token"})
+        return
+    }
+    status, result, err := api.route(r)
+    if err != nil {
+        apiErr, ok := err.(apiError)
+        if !ok {
+            log.Println("API", r.Method, r.URL.Path, err)
+            apiErr = apiError{http.StatusInternalServerError, "internal error"}
+        }
+        writeJSON(w, apiErr.status, map[string]string{"error": apiErr.message})
+        return
+    }
+    writeJSON(w, status, result)
+}
+
+func (api *APIServer) route(r *http.Request) (int, interface{}, error) {
+    path := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+    if len(path) < 2 || path[0] != "api" {
+        return 0, nil, apiErrorf(http.StatusNotFound, "not found")
+    }
+    var id int64
+    if len(path) > 2 {
+        var err error
+        if id, err = strconv.ParseInt(path[2], 10, 64); err != nil {
+            return 0, nil, apiErrorf(http.StatusNotFound, "not found")
+        }
+    }
+
+    route := r.Method + " " + path[1]
+    switch {
+    case route == "GET users" && len(path) == 2:
+        return http.StatusOK, api.users(), nil
+    case route == "GET users" && len(path) == 3:
+        user, ok := api.user(id)
+        if !ok {
+            return 0, nil, apiErrorf(http.StatusNotFound, "no user %d", id)
+        }
+        return http.StatusOK, user, nil
+    case route == "GET games" && len(path) == 2:
+        result, err := api.games(r.URL.Query().Get("user_id"))
+        return http.StatusOK, result, err
+    case route == "POST games" && len(path) == 2:
+        var request apiNewGame
+        if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+            return 0, nil, apiErrorf(http.StatusBadRequest, "bad request: %v", err)
+        }
+        result, err := api.createGame(request)
+        return http.StatusCreated, result, err
+    case route == "GET games" && len(path) == 3:
+        result, err := api.game(id)
+        return http.StatusOK, result, err
+    case route == "POST games" && len(path) == 4 && path[3] == "moves":
+        var request apiMove
+        if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+            return 0, nil, apiErrorf(http.StatusBadRequest, "bad request: %v", err)
+        }
+        result, err := api.move(id, request)
+        return http.StatusOK, result, err
+    }
+    return 0, nil, apiErrorf(http.StatusNotFound, "no route %s %s", r.Method, r.URL.Path)
+}
+
+func platformName(platform string) string {
+    if platform == PlatformTelegram {
+        return "telegram"
+    }
+    return platform
+}
+
+func newAPIUser(userId int64, userState *UserState) apiUser {
+    user := apiUser{ID: userId, State: userState.State}
+    if userState.User != nil {
+        user.Platform = platformName(userState.User.Platform)
+        user.Name = strings.TrimSpace(userState.User.FirstName + " " + userState.User.LastName)
+        user.Username = userState.User.Username
+    }
+    if userState.State == InGame {
+        user.GameID, user.OpponentID = userState.GameID, userState.OpponentUserID
+    }
+    return user
+}
+
+// users lists registered users; entries made for ids that never talked to
+// the bot are left out.
+func (api *APIServer) users() []apiUser {
+    botStorage := api.botStorage
+    botStorage.mutex.Lock()
+    users := []apiUser{}
+    for userId, userState := range botStorage.UserId2UserState {
+        if userState.User != nil {
+            users = append(users, newAPIUser(userId, &userState))
+        }
+    }
+    botStorage.mutex.Unlock()
+    sort.Slice(users, func(a, b int) bool { return users[a].ID < users[b].ID })
+    return users
+}
+
+func (api *APIServer) user(userId int64) (apiUser, bool) {
+    botStorage := api.botStorage
+    botStorage.mutex.Lock()
+    defer botStorage.mutex.Unlock()
+    userState, ok := botStorage.UserId2UserState[userId]
+    if !ok || userState.User == nil {
+        return apiUser{}, false
+    }
+    return newAPIUser(userId, &userState), true
+}
+
+func newAPIGame(record *GameRecord) apiGame {
+    gs := record.Replay()
+    result := apiGame{
+        ID: record.ID,
+        XUserID: record.XUserID,
+        OUserID: record.OUserID,
+        Width: record.Width,
+        Height: record.Height,
+        WinLength: record.WinLength,
+        Board: make([]string, len(gs.Board)),
+        Moves: make([]string, len(record.Moves)),
+        Finished: record.Finished,
+        StartedAt: record.StartedAt,
+    }
+    for i, row := range gs.Board {
+        for _, cell := range row {
+            result.Board[i] += cell.String()
+        }
+    }
+    for k, move := range record.Moves {
+        result.Moves[k] = move.String()
+    }
+    if record.Finished {
+        result.Result = "draw"
+        if record.WhoWin != game.Empty {
+            result.Result = record.WhoWin.String()
+        }
+        result.FinishedAt = &record.FinishedAt
+    } else {
+        result.Turn = gs.WhoTurn.String()
+    }
+    return result
+}
+
+func (api *APIServer) games(userFilter string) ([]apiGame, error) {
+    var userId int64
+    if userFilter != "" {
+        var err error
+        if userId, err = strconv.ParseInt(userFilter, 10, 64); err != nil {
+            return nil, apiErrorf(http.StatusBadRequest, "bad user_id %q", userFilter)
+        }
+    }
+    records, err := api.botStorage.store.LoadGames()
+    if err != nil {
+        return nil, err
+    }
+    games := []apiGame{}
+    for i := range records {
+        if userId == 0 || records[i].XUserID == userId || records[i].OUserID == userId {
+            games = append(games, newAPIGame(&records[i]))
+        }
+    }
+    sort.Slice(games, func(a, b int) bool { return games[a].ID < games[b].ID })
+    return games, nil
+}
+
+func (api *APIServer) game(gameId int64) (apiGame, error) {
+    record, err := api.botStorage.store.LoadGame(gameId)
+    if err == ErrNotFound {
+        return apiGame{}, apiErrorf(http.StatusNotFound, "no game %d", gameId)
+    }
+    if err != nil {
+        return apiGame{}, err
+    }
+    return newAPIGame(&record), nil
+}
+
+// createGame starts a game between two registered users who are not playing,
+// taking them out of the matchmaking queue.
+func (api *APIServer) createGame(request apiNewGame) (apiGame, error) {
+    botStorage := api.botStorage
+    botStorage.updates.Lock()
+    defer botStorage.updates.Unlock()
+    if request.XUserID == request.OUserID {
+        return apiGame{}, apiErrorf(http.StatusBadRequest, "x_user_id and o_user_id must differ")
+    }
+    for _, userId := range []int64{request.XUserID, request.OUserID} {
+        user, ok := api.user(userId)
+        if !ok {
+            return apiGame{}, apiErrorf(http.StatusNotFound, "no user %d", userId)
+        }
+        if user.State == InGame {
+            return apiGame{}, apiErrorf(http.StatusConflict, "user %d is already playing game %d", userId, user.GameID)
+        }
+    }
+    for _, userId := range []int64{request.XUserID, request.OUserID} {
+        botStorage.stopSearching(userId)
+    }
+    gameId := startMatch(botStorage, request.XUserID, request.OUserID)
+    if gameId == 0 {
+        return apiGame{}, fmt.Errorf("could not create a game")
+    }
+    return api.game(gameId)
+}
+
+// move plays a move for a user as if they had pressed the cell.
+func (api *APIServer) move(gameId int64, request apiMove) (apiGame, error) {
+    botStorage := api.botStorage
+    botStorage.updates.Lock()
+    defer botStorage.updates.Unlock()
+    if _, err := api.game(gameId); err != nil {
+        return apiGame{}, err
+    }
+    userState := botStorage.getUserState(request.UserID)
+    if userState.User == nil || userState.State != InGame || userState.GameID != gameId {
+        return apiGame{}, apiErrorf(http.StatusConflict, "user %d is not playing game %d", request.UserID, gameId)
+    }
+    if !userState.CanMeMakeMove() {
+        return apiGame{}, apiErrorf(http.StatusConflict, "not the turn of user %d", request.UserID)
+    }
+    move, ok := game.ParseMove(request.Move)
+    gs := &userState.GameState
+    if !ok || move.I >= gs.Height || move.J >= gs.Width || gs.Board[move.I][move.J] != game.Empty {
+        return apiGame{}, apiErrorf(http.StatusBadRequest, "invalid move %q", request.Move)
+    }
+    if err := handleMove(move.I, move.J, botStorage, &Input{User: *userState.User}); err != nil {
+        return apiGame{}, err
+    }
+    return api.game(gameId)
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "io"
+    "math"
+    "math/rand"
+    "os"
+    "time"
+
+    game "./game"
+)
+
+// arenaZ is the normal quantile of the 95% confidence intervals.
+const arenaZ = 1.96
+
+type arenaInterval struct {
+    Value float64 `json:"value"`
+    Low float64 `json:"low"`
+    High float64 `json:"high"`
+}
+
+// arenaSummary counts games from engine A's side.
+type arenaSummary struct {
+    Games int `json:"games"`
+    Wins int `json:"wins"`
+    Draws int `json:"draws"`
+    Losses int `json:"losses"`
+    WinRate arenaInterval `json:"win_rate"`
+    DrawRate arenaInterval `json:"draw_rate"`
+    LossRate arenaInterval `json:"loss_rate"`
+    // Score is a win plus half a draw per game; Elo is the rating
+    // difference of A over B it implies.
+    Score arenaInterval `json:"score"`
+    Elo arenaInterval `json:"elo"`
+}
+
+type arenaGame struct {
+    Game int `json:"game"`
+    // X is the engine that played X, "a" or "b".
+    X string `json:"x"`
+    Opening []string `json:"opening"`
+    Moves []string `json:"moves"`
+    // Result is "a", "b" or "draw".
+    Result string `json:"result"`
+    // Forfeit is the engine that failed to make a legal move.
+    Forfeit string `json:"forfeit,omitempty"`
+}
+
+type arenaResults struct {
+    A string `json:"a"`
+    B string `json:"b"`
+    Width int `json:"width"`
+    Height int `json:"height"`
+    WinLength int `json:"win_length"`
+    OpeningMoves int `json:"opening_moves"`
+    Seed int64 `json:"seed"`
+    Summary arenaSummary `json:"summary"`
+    Games []arenaGame `json:"games"`
+}
+
+// wilson is the Wilson score interval of k successes in n trials.
+func wilson(k int, n int) arenaInterval {
+    p := float64(k) / float64(n)
+    z2 := arenaZ * arenaZ
+    centre := (p + z2 / (2 * float64(n))) / (1 + z2 / float64(n))
+    half := arenaZ / (1 + z2 / float64(n)) * math.Sqrt(p * (1 - p) / float64(n) + z2 / (4 * float64(n) * float64(n)))
+    return arenaInterval{Value: p, Low: math.Max(0, centre - half), High: math.Min(1, centre + half)}
+}
+
+// elo turns a score into a rating difference; scores of 0 and 1 are pulled
+// in by half a game so that the result stays finite.
+func elo(score float64, games int) float64 {
+    limit := 0.5 / float64(games)
+    score = math.Min(math.Max(score, limit), 1 - limit)
+    return 400 * math.Log10(score / (1 - score))
+}
+
+func summarize(games []arenaGame) arenaSummary {
+    s := arenaSummary{Games: len(games)}
+    for _, g := range games {
+        switch g.Result {
+        case "a":
+            s.Wins++
+        case "b":
+            s.Losses++
+        default:
+            s.Draws++
+        }
+    }
+    n := float64(s.Games)
+    s.WinRate, s.DrawRate, s.LossRate = wilson(s.Wins, s.Games), wilson(s.Draws, s.Games), wilson(s.Losses, s.Games)
+
+    score := (float64(s.Wins) + float64(s.Draws) / 2) / n
+    variance := (float64(s.Wins) * math.Pow(1 - score, 2) + float64(s.Draws) * math.Pow(0.5 - score, 2) + float64(s.Losses) * score * score) / n
+    half := arenaZ * math.Sqrt(variance / n)
+    s.Score = arenaInterval{Value: score, Low: math.Max(0, score - half), High: math.Min(1, score + half)}
+    s.Elo = arenaInterval{Value: elo(score, s.Games), Low: elo(s.Score.Low, s.Games), High: elo(s.Score.High, s.Games)}
+    return s
+}
+
+func moveStrings(moves []game.Move) []string {
+    result := make([]string, len(moves))
+    for k, m := range moves {
+        result[k] = m.String()
+    }
+    return result
+}
+
+// playArenaGame plays one game from opening; aIsX tells which side engine A
+// has.
+func playArenaGame(gs game.GameState, opening []game.Move, a game.Engine, b game.Engine, aIsX bool) arenaGame {
+    gs.Replay(opening)
+    x, o := a, b
+    side := map[game.Cell]string{game.X: "a", game.O: "b"}
+    if !aIsX {
+        x, o = b, a
+        side[game.X], side[game.O] = "b", "a"
+    }
+    result := arenaGame{X: side[game.X], Opening: moveStrings(opening)}
+
+    if failed := game.PlayGame(&gs, x, o); failed != game.Empty {
+        result.Forfeit = side[failed]
+        result.Result = side[game.X]
+        if failed == game.X {
+            result.Result = side[game.O]
+        }
+    } else if gs.WhoWin == game.Empty {
+        result.Result = "draw"
+    } else {
+        result.Result = side[gs.WhoWin]
+    }
+    result.Moves = moveStrings(gs.Moves[len(opening):])
+    return result
+}
+
+func runArena(config Config) error {
+    arena := config.Arena
+    seed := arena.Seed
+    if seed == 0 {
+        seed = time.Now().UnixNano()
+    }
+    openings := rand.New(rand.NewSource(seed))
+    a, err := newEngine(arena.A, config.Rules, rand.New(rand.NewSource(seed + 1)))
+    if err != nil {
+        return err
+    }
+    b, err := newEngine(arena.B, config.Rules, rand.New(rand.NewSource(seed + 2)))
+    if err != nil {
+        return err
+    }
+    for _, engine := range []game.Engine{a, b} {
+        if closer, ok := engine.(io.Closer); ok {
+            defer closer.Close()
+        }
+    }
+
+    results := arenaResults{
+        A: arena.A,
+        B: arena.B,
+        Width: config.Rules.Width,
+        Height: config.Rules.Height,
+        WinLength: config.Rules.WinLength,
+        OpeningMoves: arena.OpeningMoves,
+        Seed: seed,
+    }
+    var opening []game.Move
+    for k := 0; k < arena.Games; k++ {
+        if k % 2 == 0 {
+            gs := config.Rules.NewGameState()
+            gs.ResetGame()
+            for !gs.RandomOpening(arena.OpeningMoves, openings) {
+                gs.ResetGame()
+            }
+            opening = gs.Moves
+        }
+        result := playArenaGame(config.Rules.NewGameState(), opening, a, b, k % 2 == 0)
+        result.Game = k + 1
+        results.Games = append(results.Games, result)
+        aSide := "X"
+        if result.X != "a" {
+            aSide = "O"
+        }
+        // Progress goes to stderr so that stdout carries only the summary.
+        fmt.Fprintf(os.Stderr, "game %d/%d: A plays %s, result %s after %d moves\n", k + 1, arena.Games, aSide, result.Result, len(result.Moves))
+    }
+
+    s := summarize(results.Games)
+    results.Summary = s
+    fmt.Printf("%s vs %s, %d games: +%d =%d -%d\n", arena.A, arena.B, s.Games, s.Wins, s.Draws, s.Losses)
+    for _, line := range []struct {
+        name string
+        rate arenaInterval
+    }{{"wins", s.WinRate}, {"draws", s.DrawRate}, {"losses", s.LossRate}, {"score", s.Score}} {
+        fmt.Printf("%-7s %5.1f%%  (95%%: %.1f%% - %.1f%%)\n", line.name, 100 * line.rate.Value, 100 * line.rate.Low, 100 * line.rate.High)
+    }
+    fmt.Printf("elo     %+.0f  (95%%: %+.0f - %+.0f)\n", s.Elo.Value, s.Elo.Low, s.Elo.High)
+
+    if arena.Output == "" {
+        return nil
+    }
+    data, err := json.MarshalIndent(results, "", "  ")
+    if err != nil {
+        return err
+    }
+    return os.WriteFile(arena.Output, data, 0644)
+}
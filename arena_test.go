@@ -0,0 +1,63 @@
+package main
+
+import (
+    "math"
+    "testing"
+)
+
+func near(a float64, b float64, tolerance float64) bool {
+    return math.Abs(a - b) <= tolerance
+}
+
+func TestWilson(t *testing.T) {
+    for _, test := range []struct {
+        k, n int
+        low, high float64
+    }{
+        {0, 10, 0, 0.2775},
+        {5, 10, 0.2366, 0.7634},
+        {8, 10, 0.4902, 0.9433},
+        {10, 10, 0.7225, 1},
+    } {
+        interval := wilson(test.k, test.n)
+        if !near(interval.Value, float64(test.k) / float64(test.n), 1e-9) ||
+           !near(interval.Low, test.low, 1e-4) || !near(interval.High, test.high, 1e-4) {
+            t.Errorf("wilson(%d, %d) = %+v, want %.4f - %.4f", test.k, test.n, interval, test.low, test.high)
+        }
+    }
+}
+
+func TestElo(t *testing.T) {
+    for _, test := range []struct {
+        score float64
+        games int
+        elo float64
+    }{
+        {0.5, 10, 0},
+        {0.75, 100, 190.85},
+        // A clean sweep counts as 9.5 of 10.
+        {1, 10, 511.50},
+        {0, 10, -511.50},
+    } {
+        if got := elo(test.score, test.games); !near(got, test.elo, 0.01) {
+            t.Errorf("elo(%v, %d) = %.2f, want %.2f", test.score, test.games, got, test.elo)
+        }
+    }
+}
+
+func TestSummarize(t *testing.T) {
+    var games []arenaGame
+    for _, result := range []string{"a", "a", "a", "draw", "draw", "b"} {
+        games = append(games, arenaGame{Result: result})
+    }
+    s := summarize(games)
+    if s.Games != 6 || s.Wins != 3 || s.Draws != 2 || s.Losses != 1 {
+        t.Fatalf("counted %+v", s)
+    }
+    if !near(s.Score.Value, 4.0 / 6, 1e-9) || !near(s.Score.Low, 0.3685, 1e-4) || !near(s.Score.High, 0.9649, 1e-4) {
+        t.Errorf("score %+v", s.Score)
+    }
+    if !near(s.Elo.Value, 120.41, 0.01) || !near(s.Elo.Low, -93.60, 0.01) || !near(s.Elo.High, 416.56, 0.01) {
+        t.Errorf("elo %+v", s.Elo)
+    }
+}
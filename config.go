@@ -0,0 +1,430 @@
+package main
+
+import (
+    "bytes"
+    "flag"
+    "fmt"
+    "os"
+    "strconv"
+    "strings"
+    "time"
+
+    game "./game"
+    yaml "gopkg.in/yaml.v3"
+)
+
+// Telegram renders at most eight buttons in a keyboard row.
+const maxBoardSize = 8
+
+const (
+    pollerLong    = "long"
+    pollerWebhook = "webhook"
+)
+
+type StorageConfig struct {
+    Path string `yaml:"path"`
+    Snapshot string `yaml:"snapshot"`
+    SnapshotInterval time.Duration `yaml:"snapshot_interval"`
+    LegacySave string `yaml:"legacy_save"`
+    EventLog string `yaml:"event_log"`
+}
+
+type RulesConfig struct {
+    Width int `yaml:"width"`
+    Height int `yaml:"height"`
+    WinLength int `yaml:"win_length"`
+    // Openings starts every game from a random position of the opening book.
+    Openings bool `yaml:"openings"`
+}
+
+type PollerConfig struct {
+    Mode string `yaml:"mode"`
+    Timeout time.Duration `yaml:"timeout"`
+    Limit int `yaml:"limit"`
+}
+
+type WebhookConfig struct {
+    Listen string `yaml:"listen"`
+    Path string `yaml:"path"`
+    TLSCert string `yaml:"tls_cert"`
+    TLSKey string `yaml:"tls_key"`
+    SecretToken string `yaml:"secret_token"`
+    PublicURL string `yaml:"public_url"`
+    PublicCert string `yaml:"public_cert"`
+}
+
+type FeaturesConfig struct {
+    Language bool `yaml:"language"`
+    Themes bool `yaml:"themes"`
+    Replay bool `yaml:"replay"`
+    TextMoves bool `yaml:"text_moves"`
+    Hint bool `yaml:"hint"`
+    // HintPvP allows /hint in games between people, where the opponent has
+    // not agreed to play against the engine's advice.
+    HintPvP bool `yaml:"hint_pvp"`
+    Puzzle bool `yaml:"puzzle"`
+    Daily bool `yaml:"daily"`
+}
+
+// PuzzlesConfig points at the JSON file of /puzzle positions.
+type PuzzlesConfig struct {
+    Path string `yaml:"path"`
+}
+
+// DailyConfig publishes a challenge every day at Time (UTC, "15:04") to the
+// users who asked for it with /daily on. The positions are in the puzzle
+// format; an empty Path takes them from the puzzles.
+type DailyConfig struct {
+    Time string `yaml:"time"`
+    Path string `yaml:"path"`
+}
+
+// DiscordConfig enables the Discord front-end when Token is set. Commands are
+// registered in GuildID only, or globally when it is empty.
+type DiscordConfig struct {
+    Token string `yaml:"token"`
+    GuildID string `yaml:"guild_id"`
+    APIURL string `yaml:"api_url"`
+}
+
+// WebConfig enables the browser front-end when Listen is set.
+type WebConfig struct {
+    Listen string `yaml:"listen"`
+}
+
+// APIConfig enables the JSON API when Listen is set; requests must carry
+// one of Tokens as a bearer token.
+type APIConfig struct {
+    Listen string `yaml:"listen"`
+    Tokens []string `yaml:"tokens"`
+}
+
+type ConsoleConfig struct {
+    Enabled bool `yaml:"enabled"`
+    X string `yaml:"x"`
+    O string `yaml:"o"`
+}
+
+// ArenaConfig plays engine A against engine B without any messenger. Games
+// go in pairs with the same random opening and the colours swapped.
+type ArenaConfig struct {
+    Enabled bool `yaml:"enabled"`
+    A string `yaml:"a"`
+    B string `yaml:"b"`
+    Games int `yaml:"games"`
+    OpeningMoves int `yaml:"opening_moves"`
+    // Seed makes the openings and the built-in engine repeatable; 0 picks one.
+    Seed int64 `yaml:"seed"`
+    Output string `yaml:"output"`
+}
+
+type Config struct {
+    Token string `yaml:"token"`
+    APIURL string `yaml:"api_url"`
+    Storage StorageConfig `yaml:"storage"`
+    Rules RulesConfig `yaml:"rules"`
+    Poller PollerConfig `yaml:"poller"`
+    Webhook WebhookConfig `yaml:"webhook"`
+    Discord DiscordConfig `yaml:"discord"`
+    Web WebConfig `yaml:"web"`
+    API APIConfig `yaml:"api"`
+    // Admins are Telegram user ids or "platform:id" of other messengers,
+    // e.g. "discord:80351110224678912".
+    Admins []string `yaml:"admins"`
+    Features FeaturesConfig `yaml:"features"`
+    Puzzles PuzzlesConfig `yaml:"puzzles"`
+    Daily DailyConfig `yaml:"daily"`
+    Console ConsoleConfig `yaml:"console"`
+    Arena ArenaConfig `yaml:"arena"`
+    Piskvork bool `yaml:"-"`
+}
+
+func DefaultConfig() Config {
+    return Config{
+        APIURL: "https://api.telegram.org",
+        Storage: StorageConfig{
+            Path: "storage.db",
+            Snapshot: "snapshot.json",
+            SnapshotInterval: time.Hour,
+            LegacySave: "save.json",
+            EventLog: "events.log",
+        },
+        Rules: RulesConfig{Width: 8, Height: 8, WinLength: 5},
+        Poller: PollerConfig{Mode: pollerLong, Timeout: 10 * time.Second},
+        Webhook: WebhookConfig{Listen: ":8443", Path: "/telegram"},
+        Discord: DiscordConfig{APIURL: "https://discord.com/"},
+        Features: FeaturesConfig{Language: true, Themes: true, Replay: true, TextMoves: true, Hint: true, Puzzle: true, Daily: true},
+        Puzzles: PuzzlesConfig{Path: "puzzles.json"},
+        Daily: DailyConfig{Time: "09:00"},
+        Console: ConsoleConfig{X: "human", O: "human"},
+        Arena: ArenaConfig{A: "ai", B: "ai", Games: 100, OpeningMoves: 4, Output: "arena.json"},
+    }
+}
+
+func (rules RulesConfig) NewGameState() game.GameState {
+    return game.GameState{Width: rules.Width, Height: rules.Height, WinLength: rules.WinLength}
+}
+
+func (config *Config) IsAdmin(user *User) bool {
+    id := strconv.FormatInt(user.ID, 10)
+    if user.Platform != PlatformTelegram {
+        id = accountKey(user.Platform, user.ExternalID)
+    }
+    for _, admin := range config.Admins {
+        if admin == id {
+            return true
+        }
+    }
+    return false
+}
+
+func validAdmin(admin string) bool {
+    if id, err := strconv.ParseInt(admin, 10, 64); err == nil {
+        return id > 0
+    }
+    i := strings.Index(admin, ":")
+    if i < 0 || i == len(admin) - 1 {
+        return false
+    }
+    switch admin[:i] {
+    case PlatformDiscord, PlatformWeb:
+        return true
+    }
+    return false
+}
+
+type stringList []string
+
+func (list *stringList) String() string {
+    return strings.Join(*list, ",")
+}
+
+func (list *stringList) Set(value string) error {
+    var parsed stringList
+    for _, part := range strings.Split(value, ",") {
+        if part = strings.TrimSpace(part); part != "" {
+            parsed = append(parsed, part)
+        }
+    }
+    *list = parsed
+    return nil
+}
+
+func (config *Config) bindFlags(flags *flag.FlagSet) {
+    flags.StringVar(&config.Token, "token", config.Token, "Telegram bot token")
+    flags.StringVar(&config.APIURL, "api-url", config.APIURL, "Bot API server, e.g. a local stand-in")
+    flags.StringVar(&config.Storage.Path, "storage.path", config.Storage.Path, "BoltDB database file")
+    flags.StringVar(&config.Storage.Snapshot, "storage.snapshot", config.Storage.Snapshot, "JSON snapshot file")
+    flags.DurationVar(&config.Storage.SnapshotInterval, "storage.snapshot-interval", config.Storage.SnapshotInterval, "how often to write the snapshot")
+    flags.StringVar(&config.Storage.LegacySave, "storage.legacy-save", config.Storage.LegacySave, "save.json of older versions to import")
+    flags.StringVar(&config.Storage.EventLog, "storage.event-log", config.Storage.EventLog, "game event log file")
+    flags.IntVar(&config.Rules.Width, "rules.width", config.Rules.Width, "board width")
+    flags.IntVar(&config.Rules.Height, "rules.height", config.Rules.Height, "board height")
+    flags.IntVar(&config.Rules.WinLength, "rules.win-length", config.Rules.WinLength, "stones in a row needed to win")
+    flags.BoolVar(&config.Rules.Openings, "rules.openings", config.Rules.Openings, "start games from a random balanced opening (five in a row only)")
+    flags.StringVar(&config.Poller.Mode, "poller.mode", config.Poller.Mode, "how to receive updates: long or webhook")
+    flags.DurationVar(&config.Poller.Timeout, "poller.timeout", config.Poller.Timeout, "long polling timeout")
+    flags.IntVar(&config.Poller.Limit, "poller.limit", config.Poller.Limit, "updates per poll, 0 for the Telegram default")
+    flags.StringVar(&config.Webhook.Listen, "webhook.listen", config.Webhook.Listen, "address the webhook server listens on")
+    flags.StringVar(&config.Webhook.Path, "webhook.path", config.Webhook.Path, "URL path that accepts updates")
+    flags.StringVar(&config.Webhook.TLSCert, "webhook.tls-cert", config.Webhook.TLSCert, "TLS certificate, empty to serve plain HTTP behind a proxy")
+    flags.StringVar(&config.Webhook.TLSKey, "webhook.tls-key", config.Webhook.TLSKey, "TLS private key")
+    flags.StringVar(&config.Webhook.SecretToken, "webhook.secret-token", config.Webhook.SecretToken, "expected X-Telegram-Bot-Api-Secret-Token")
+    flags.StringVar(&config.Webhook.PublicURL, "webhook.public-url", config.Webhook.PublicURL, "URL to register with setWebhook, empty to skip registration")
+    flags.StringVar(&config.Webhook.PublicCert, "webhook.public-cert", config.Webhook.PublicCert, "self-signed certificate to upload with setWebhook")
+    flags.StringVar(&config.Discord.Token, "discord.token", config.Discord.Token, "Discord bot token, empty to run on Telegram only")
+    flags.StringVar(&config.Discord.GuildID, "discord.guild-id", config.Discord.GuildID, "register slash commands in this server only")
+    flags.StringVar(&config.Discord.APIURL, "discord.api-url", config.Discord.APIURL, "Discord API server, e.g. a local stand-in")
+    flags.StringVar(&config.Web.Listen, "web.listen", config.Web.Listen, "address of the browser UI, e.g. :8080; empty to disable")
+    flags.StringVar(&config.API.Listen, "api.listen", config.API.Listen, "address of the JSON API, e.g. :8081; empty to disable")
+    flags.Var((*stringList)(&config.API.Tokens), "api.tokens", "comma separated bearer tokens accepted by the API")
+    flags.Var((*stringList)(&config.Admins), "admins", "comma separated administrators: Telegram user ids or platform:id (discord:<user id>, web:<ttt_key cookie>)")
+    flags.BoolVar(&config.Features.Language, "features.language", config.Features.Language, "enable /language")
+    flags.BoolVar(&config.Features.Themes, "features.themes", config.Features.Themes, "enable /theme")
+    flags.BoolVar(&config.Features.Replay, "features.replay", config.Features.Replay, "enable board images and /replay")
+    flags.BoolVar(&config.Features.TextMoves, "features.text-moves", config.Features.TextMoves, "accept moves typed as e5 or 3 4")
+    flags.BoolVar(&config.Features.Hint, "features.hint", config.Features.Hint, "enable /hint")
+    flags.BoolVar(&config.Features.HintPvP, "features.hint-pvp", config.Features.HintPvP, "allow /hint in games between people")
+    flags.BoolVar(&config.Features.Puzzle, "features.puzzle", config.Features.Puzzle, "enable /puzzle")
+    flags.StringVar(&config.Puzzles.Path, "puzzles.path", config.Puzzles.Path, "JSON file with the /puzzle positions")
+    flags.BoolVar(&config.Features.Daily, "features.daily", config.Features.Daily, "enable the /daily challenge")
+    flags.StringVar(&config.Daily.Time, "daily.time", config.Daily.Time, "when the daily challenge is published, HH:MM UTC")
+    flags.StringVar(&config.Daily.Path, "daily.path", config.Daily.Path, "JSON file with the daily positions, empty to use the puzzles")
+    flags.BoolVar(&config.Console.Enabled, "console", config.Console.Enabled, "play in the terminal instead of running the Telegram bot")
+    flags.StringVar(&config.Console.X, "console.x", config.Console.X, "who plays X in the console game: human, ai or piskvork:<engine command>")
+    flags.StringVar(&config.Console.O, "console.o", config.Console.O, "who plays O in the console game: human, ai or piskvork:<engine command>")
+    flags.BoolVar(&config.Arena.Enabled, "arena", config.Arena.Enabled, "play engine A against engine B, report the score and exit")
+    flags.StringVar(&config.Arena.A, "arena.a", config.Arena.A, "engine A: ai, ai:defence=<percent> or piskvork:<engine command>")
+    flags.StringVar(&config.Arena.B, "arena.b", config.Arena.B, "engine B: ai, ai:defence=<percent> or piskvork:<engine command>")
+    flags.IntVar(&config.Arena.Games, "arena.games", config.Arena.Games, "number of games, played in pairs with colours swapped")
+    flags.IntVar(&config.Arena.OpeningMoves, "arena.opening-moves", config.Arena.OpeningMoves, "random moves played before the engines take over")
+    flags.Int64Var(&config.Arena.Seed, "arena.seed", config.Arena.Seed, "random seed for openings, 0 for a new one each run")
+    flags.StringVar(&config.Arena.Output, "arena.output", config.Arena.Output, "JSON file for the results, empty to skip")
+    flags.BoolVar(&config.Piskvork, "piskvork", config.Piskvork, "play as a Piskvork (Gomocup) engine on stdin and stdout and exit")
+}
+
+// envName maps a flag to its environment override: rules.win-length is
+// TTT_RULES_WIN_LENGTH. The tokens keep the usual TELEGRAM_TOKEN and
+// DISCORD_TOKEN.
+func envName(flagName string) string {
+    switch flagName {
+    case "token":
+        return "TELEGRAM_TOKEN"
+    case "discord.token":
+        return "DISCORD_TOKEN"
+    }
+    return "TTT_" + strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(flagName))
+}
+
+func loadConfigFile(path string, config *Config) error {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return err
+    }
+    decoder := yaml.NewDecoder(bytes.NewReader(data))
+    decoder.KnownFields(true)
+    if err := decoder.Decode(config); err != nil {
+        return fmt.Errorf("%s: %v", path, err)
+    }
+    return nil
+}
+
+// LoadConfig layers the defaults, the YAML file given by -config or
+// TTT_CONFIG, environment overrides and finally the command line flags.
+func LoadConfig(args []string) (Config, error) {
+    config := DefaultConfig()
+    path := os.Getenv("TTT_CONFIG")
+    flags := flag.NewFlagSet(args[0], flag.ExitOnError)
+    flags.StringVar(&path, "config", path, "YAML config file")
+    config.bindFlags(flags)
+    flags.Parse(args[1:])
+
+    explicit := make(map[string]string)
+    flags.Visit(func(f *flag.Flag) {
+        explicit[f.Name] = f.Value.String()
+    })
+
+    config = DefaultConfig()
+    if path != "" {
+        if err := loadConfigFile(path, &config); err != nil {
+            return config, err
+        }
+    }
+    var err error
+    flags.VisitAll(func(f *flag.Flag) {
+        if value, ok := os.LookupEnv(envName(f.Name)); ok && f.Name != "config" && err == nil {
+            if setErr := f.Value.Set(value); setErr != nil {
+                err = fmt.Errorf("%s: %v", envName(f.Name), setErr)
+            }
+        }
+    })
+    if err != nil {
+        return config, err
+    }
+    for name, value := range explicit {
+        if err := flags.Set(name, value); err != nil {
+            return config, err
+        }
+    }
+    return config, config.Validate()
+}
+
+func validSecretToken(token string) bool {
+    if len(token) > 256 {
+        return false
+    }
+    for _, r := range token {
+        if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-') {
+            return false
+        }
+    }
+    return true
+}
+
+func validConsolePlayer(kind string) bool {
+    return kind == "human" || validEngine(kind)
+}
+
+func (config *Config) Validate() error {
+    var problems []string
+    check := func(ok bool, format string, args ...interface{}) {
+        if !ok {
+            problems = append(problems, fmt.Sprintf(format, args...))
+        }
+    }
+
+    rules := config.Rules
+    maxSize := maxBoardSize
+    checkPiskvorkRules := func(kinds ...string) {
+        for _, kind := range kinds {
+            if err := piskvorkRules(kind, rules); err != nil {
+                check(false, "%v", err)
+            }
+        }
+    }
+    if config.Arena.Enabled {
+        maxSize = 'z' - 'a' + 1
+        check(validEngine(config.Arena.A), "arena.a must be ai, ai:defence=<percent> or piskvork:<engine command>")
+        check(validEngine(config.Arena.B), "arena.b must be ai, ai:defence=<percent> or piskvork:<engine command>")
+        checkPiskvorkRules(config.Arena.A, config.Arena.B)
+        check(config.Arena.Games > 0, "arena.games must be positive")
+        check(config.Arena.OpeningMoves >= 0 && config.Arena.OpeningMoves < rules.Width * rules.Height / 2,
+              "arena.opening-moves must be between 0 and half the board")
+    } else if config.Console.Enabled {
+        maxSize = 'z' - 'a' + 1
+        check(validConsolePlayer(config.Console.X), "console.x must be human, ai, ai:defence=<percent> or piskvork:<engine command>")
+        check(validConsolePlayer(config.Console.O), "console.o must be human, ai, ai:defence=<percent> or piskvork:<engine command>")
+        checkPiskvorkRules(config.Console.X, config.Console.O)
+    } else if !config.Piskvork {
+        check(config.Token != "" || config.Discord.Token != "" || config.Web.Listen != "",
+              "token (TELEGRAM_TOKEN), discord.token (DISCORD_TOKEN) or web.listen is required")
+        check(config.Storage.Path != "", "storage.path is empty")
+        check(config.Storage.Snapshot != "", "storage.snapshot is empty")
+        check(config.Storage.EventLog != "", "storage.event-log is empty")
+        check(config.Storage.SnapshotInterval > 0, "storage.snapshot-interval must be positive")
+        if config.Discord.Token != "" {
+            check(strings.HasPrefix(config.Discord.APIURL, "http://") || strings.HasPrefix(config.Discord.APIURL, "https://"), "discord.api-url must be an http(s) URL")
+        }
+    }
+    if config.Token != "" && !config.Console.Enabled && !config.Arena.Enabled && !config.Piskvork {
+        check(strings.HasPrefix(config.APIURL, "http://") || strings.HasPrefix(config.APIURL, "https://"), "api-url must be an http(s) URL")
+        check(config.Poller.Timeout > 0, "poller.timeout must be positive")
+        check(config.Poller.Limit >= 0 && config.Poller.Limit <= 100, "poller.limit must be between 0 and 100")
+        check(config.Poller.Mode == pollerLong || config.Poller.Mode == pollerWebhook, "poller.mode must be long or webhook")
+        if config.Poller.Mode == pollerWebhook {
+            webhook := config.Webhook
+            check(webhook.Listen != "", "webhook.listen is empty")
+            check(strings.HasPrefix(webhook.Path, "/"), "webhook.path must start with /")
+            check((webhook.TLSCert == "") == (webhook.TLSKey == ""), "webhook.tls-cert and webhook.tls-key go together")
+            check(webhook.SecretToken == "" || validSecretToken(webhook.SecretToken),
+                  "webhook.secret-token may only hold 1-256 of A-Z, a-z, 0-9, _ and -")
+            check(webhook.PublicURL == "" || strings.HasPrefix(webhook.PublicURL, "https://"), "webhook.public-url must be https")
+        }
+    }
+    if config.API.Listen != "" {
+        check(len(config.API.Tokens) > 0, "api.tokens is required with api.listen")
+        for _, token := range config.API.Tokens {
+            check(len(token) >= 16, "api tokens must be at least 16 characters long")
+        }
+    }
+    check(rules.Width >= 3 && rules.Width <= maxSize, "rules.width must be between 3 and %d", maxSize)
+    check(rules.Height >= 3 && rules.Height <= maxSize, "rules.height must be between 3 and %d", maxSize)
+    check(rules.WinLength >= 3 && rules.WinLength <= rules.Width && rules.WinLength <= rules.Height,
+          "rules.win-length must be at least 3 and fit on the board")
+    if rules.Openings {
+        gs := rules.NewGameState()
+        check(len(game.OpeningsFor(&gs)) > 0, "rules.openings needs five in a row on a board of at least 5x5")
+    }
+    if config.Features.Daily {
+        _, err := dailyOffset(config.Daily.Time)
+        check(err == nil, "daily.time must be HH:MM")
+    }
+    for _, admin := range config.Admins {
+        check(validAdmin(admin), "admin %q is neither a Telegram user id nor discord:<id> or web:<key>", admin)
+    }
+
+    if len(problems) > 0 {
+        return fmt.Errorf("invalid config: %s", strings.Join(problems, "; "))
+    }
+    return nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+    "fmt"
+    "io"
+    "math/rand"
+    "os"
+    "strconv"
+    "strings"
+    "time"
+
+    game "./game"
+    i18n "./i18n"
+)
+
+// consoleEngineTimeout is the time a Piskvork engine gets for a move.
+const consoleEngineTimeout = 5 * time.Second
+
+const (
+    piskvorkPlayer = "piskvork:"
+    aiPlayer = "ai:"
+)
+
+// newEngine makes an engine from its description for games under rules.
+func newEngine(kind string, rules RulesConfig, r *rand.Rand) (game.Engine, error) {
+    if err := piskvorkRules(kind, rules); err != nil {
+        return nil, err
+    }
+    return parseEngine(kind, r)
+}
+
+// piskvorkRules refuses rules a Piskvork engine cannot play: the protocol
+// knows only five in a row, and most engines only square boards.
+func piskvorkRules(kind string, rules RulesConfig) error {
+    if !strings.HasPrefix(kind, piskvorkPlayer) {
+        return nil
+    }
+    if rules.WinLength != game.PiskvorkWinLength || rules.Width != rules.Height || rules.Width < game.PiskvorkWinLength {
+        return fmt.Errorf("%s plays five in a row on a square board of at least 5x5, not %d in a row on %dx%d",
+                          kind, rules.WinLength, rules.Width, rules.Height)
+    }
+    return nil
+}
+
+// parseEngine reads an engine description: ai, ai:defence=<percent> or
+// piskvork:<engine command>.
+func parseEngine(kind string, r *rand.Rand) (game.Engine, error) {
+    if strings.HasPrefix(kind, piskvorkPlayer) {
+        command := strings.Fields(strings.TrimPrefix(kind, piskvorkPlayer))
+        if len(command) == 0 {
+            return nil, fmt.Errorf("no engine command in %q", kind)
+        }
+        return game.NewPiskvorkEngine(command, consoleEngineTimeout), nil
+    }
+    if kind == "ai" {
+        return game.HeuristicEngine{Rand: r}, nil
+    }
+    if !strings.HasPrefix(kind, aiPlayer) {
+        return nil, fmt.Errorf("unknown engine %q, expected ai, ai:defence=<percent> or piskvork:<command>", kind)
+    }
+    engine := game.HeuristicEngine{Rand: r}
+    for _, option := range strings.Split(strings.TrimPrefix(kind, aiPlayer), ",") {
+        pair := strings.SplitN(strings.TrimSpace(option), "=", 2)
+        switch pair[0] {
+        case "defence":
+            percent, err := strconv.Atoi(pair[len(pair) - 1])
+            if err != nil || percent < 1 || percent > 200 {
+                return nil, fmt.Errorf("defence in %q must be a percent from 1 to 200", kind)
+            }
+            engine.Defence = percent
+        default:
+            return nil, fmt.Errorf("unknown ai option %q in %q", pair[0], kind)
+        }
+    }
+    return engine, nil
+}
+
+func validEngine(kind string) bool {
+    _, err := parseEngine(kind, nil)
+    return err == nil
+}
+
+func consolePlayer(kind string, rules RulesConfig) (game.Engine, error) {
+    if kind == "human" {
+        return nil, nil
+    }
+    return newEngine(kind, rules, rand.New(rand.NewSource(time.Now().UnixNano())))
+}
+
+func consoleText(lang i18n.Lang) game.ConsoleText {
+    return game.ConsoleText{
+        MovePrompt: i18n.T(lang, i18n.ConsoleMovePrompt),
+        EngineMove: i18n.T(lang, i18n.ConsoleEngineMove),
+        InvalidCoordinates: i18n.T(lang, i18n.ConsoleInvalidCoordinates),
+        Draw: i18n.T(lang, i18n.ConsoleDraw),
+        XWon: i18n.T(lang, i18n.ConsoleXWon),
+        OWon: i18n.T(lang, i18n.ConsoleOWon),
+        PlayAgain: i18n.T(lang, i18n.ConsolePlayAgain),
+    }
+}
+
+func runConsole(config Config) error {
+    x, err := consolePlayer(config.Console.X, config.Rules)
+    if err != nil {
+        return err
+    }
+    o, err := consolePlayer(config.Console.O, config.Rules)
+    if err != nil {
+        return err
+    }
+    for _, engine := range []game.Engine{x, o} {
+        if closer, ok := engine.(io.Closer); ok {
+            defer closer.Close()
+        }
+    }
+    return game.RunConsoleGameLoop(config.Rules.NewGameState(), game.ConsoleOptions{
+        Text: consoleText(i18n.FromLanguageCode(os.Getenv("LANG"))),
+        X: x,
+        O: o,
+        In: os.Stdin,
+        Out: os.Stdout,
+    })
+}
+
+// runPiskvork lets Gomocup managers play our engine over stdin and stdout.
+func runPiskvork() error {
+    engine := game.HeuristicEngine{Rand: rand.New(rand.NewSource(time.Now().UnixNano()))}
+    return game.ServePiskvork(engine, os.Stdin, os.Stdout)
+}
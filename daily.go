@@ -0,0 +1,226 @@
+package main
+
+import (
+    "log"
+    "sort"
+    "strings"
+    "time"
+
+    i18n "./i18n"
+)
+
+const (
+    dailyDateFormat = "2006-01-02"
+    // dailyTop is how many places the leaderboard shows.
+    dailyTop = 10
+)
+
+// DailyResult is a user's go at one day's challenge. Attempts counts every
+// start, the solving one included; Time runs from the first start.
+type DailyResult struct {
+    Date string
+    Attempts int
+    StartedAt time.Time
+    Solved bool `json:",omitempty"`
+    Time time.Duration `json:",omitempty"`
+}
+
+// dailyOffset is the publishing time as a duration past midnight UTC.
+func dailyOffset(at string) (time.Duration, error) {
+    t, err := time.Parse("15:04", at)
+    if err != nil {
+        return 0, err
+    }
+    return time.Duration(t.Hour()) * time.Hour + time.Duration(t.Minute()) * time.Minute, nil
+}
+
+// dailyDay is the start of the challenge running at now: a challenge lasts
+// from one publishing time to the next.
+func dailyDay(now time.Time, offset time.Duration) time.Time {
+    return now.UTC().Add(-offset).Truncate(24 * time.Hour)
+}
+
+func (botStorage *TicTacToeBotStorage) dailyOffset() time.Duration {
+    offset, _ := dailyOffset(botStorage.config.Daily.Time)
+    return offset
+}
+
+// dailyPuzzle is the challenge at now and its date; every day takes the
+// next position of the list.
+func (botStorage *TicTacToeBotStorage) dailyPuzzle(now time.Time) (*Puzzle, string, bool) {
+    if len(botStorage.dailyPuzzles) == 0 {
+        return nil, "", false
+    }
+    day := dailyDay(now, botStorage.dailyOffset())
+    n := int(day.Unix() / int64(24 * time.Hour / time.Second)) % len(botStorage.dailyPuzzles)
+    return &botStorage.dailyPuzzles[n], day.Format(dailyDateFormat), true
+}
+
+type dailyEntry struct {
+    userId int64
+    name string
+    result DailyResult
+}
+
+// dailyStandings ranks the users who solved the challenge of date: fewer
+// attempts first, then the faster ones.
+func (botStorage *TicTacToeBotStorage) dailyStandings(date string) []dailyEntry {
+    botStorage.mutex.Lock()
+    var entries []dailyEntry
+    for userId, userState := range botStorage.UserId2UserState {
+        if userState.Daily == nil || userState.Daily.Date != date || !userState.Daily.Solved || userState.User == nil {
+            continue
+        }
+        name := strings.TrimSpace(userState.User.FirstName + " " + userState.User.LastName)
+        if name == "" {
+            name = userState.User.Username
+        }
+        entries = append(entries, dailyEntry{userId: userId, name: name, result: *userState.Daily})
+    }
+    botStorage.mutex.Unlock()
+
+    sort.Slice(entries, func(a, b int) bool {
+        ra, rb := entries[a].result, entries[b].result
+        switch {
+        case ra.Attempts != rb.Attempts:
+            return ra.Attempts < rb.Attempts
+        case ra.Time != rb.Time:
+            return ra.Time < rb.Time
+        }
+        return entries[a].userId < entries[b].userId
+    })
+    return entries
+}
+
+// dailyLeaderboard shows the top places, and the user's own one when it is
+// further down.
+func (botStorage *TicTacToeBotStorage) dailyLeaderboard(userId int64, date string, lang i18n.Lang) string {
+    entries := botStorage.dailyStandings(date)
+    text := i18n.T(lang, i18n.DailyLeaderboard, date)
+    if len(entries) == 0 {
+        return text + "\n" + i18n.T(lang, i18n.DailyNobody)
+    }
+    for k, entry := range entries {
+        if k >= dailyTop && entry.userId != userId {
+            continue
+        }
+        text += "\n" + i18n.N(lang, i18n.DailyEntry, entry.result.Attempts, k + 1, entry.name, entry.result.Time.Round(time.Second))
+    }
+    return text
+}
+
+func dailyKeyboard(lang i18n.Lang) Keyboard {
+    return Keyboard{{{Text: i18n.T(lang, i18n.DailyPlay), Action: "daily"}}}
+}
+
+func startDaily(botStorage *TicTacToeBotStorage, input *Input) error {
+    userState := botStorage.RegisterUser(input)
+    lang := userState.Lang()
+    if userState.State == InGame {
+        return SendEditable(botStorage, &userState, NewMessage, MessageNotEditable, i18n.T(lang, i18n.PuzzleInGame))
+    }
+    now := time.Now()
+    p, date, ok := botStorage.dailyPuzzle(now)
+    if !ok {
+        return SendEditable(botStorage, &userState, NewMessage, MessageNotEditable, i18n.T(lang, i18n.NoPuzzles))
+    }
+    if userState.Daily != nil && userState.Daily.Date == date && userState.Daily.Solved {
+        return SendEditable(botStorage, &userState, NewMessage, MessageNotEditable,
+                            i18n.T(lang, i18n.DailyAlreadySolved) + "\n\n" + botStorage.dailyLeaderboard(userState.User.ID, date, lang))
+    }
+    if userState.Daily == nil || userState.Daily.Date != date {
+        userState.Daily = &DailyResult{Date: date, StartedAt: now}
+    }
+    userState.Daily.Attempts++
+    intro := i18n.T(lang, i18n.DailyIntro, date, userState.Daily.Attempts)
+    return playPuzzle(botStorage, &userState, p, PuzzleProgress{ID: p.ID, Daily: true}, intro)
+}
+
+// finishDaily scores a solution; a miss keeps the solution hidden so the
+// user can try again.
+func finishDaily(botStorage *TicTacToeBotStorage, userState *UserState, p *Puzzle, solved bool) error {
+    lang := userState.Lang()
+    userState.State = Start
+    userState.Puzzle = nil
+    board := userState.GameState.ShowBoardToString(userState.Customization)
+    daily := userState.Daily
+    if daily == nil {
+        daily = &DailyResult{StartedAt: time.Now()}
+        userState.Daily = daily
+    }
+    if !solved {
+        botStorage.setUserState(userState.User.ID, *userState)
+        return SendEditable(botStorage, userState, EditPreviousMessage, MessageNotEditable,
+                            board + i18n.T(lang, i18n.DailyFailed, daily.Attempts), dailyKeyboard(lang))
+    }
+    daily.Solved = true
+    daily.Time = time.Since(daily.StartedAt)
+    botStorage.setUserState(userState.User.ID, *userState)
+    text := board + i18n.N(lang, i18n.DailySolved, daily.Attempts, daily.Time.Round(time.Second)) + "\n\n" +
+        botStorage.dailyLeaderboard(userState.User.ID, daily.Date, lang)
+    return SendEditable(botStorage, userState, EditPreviousMessage, MessageNotEditable, text)
+}
+
+// publishDaily tells the subscribers that a new challenge is out. The note
+// goes past SendEditable so that it leaves a board being played alone.
+func (botStorage *TicTacToeBotStorage) publishDaily(now time.Time) {
+    p, _, ok := botStorage.dailyPuzzle(now)
+    if !ok {
+        return
+    }
+    botStorage.mutex.Lock()
+    var users []UserState
+    for _, userState := range botStorage.UserId2UserState {
+        if userState.DailySubscribed && userState.User != nil {
+            users = append(users, userState)
+        }
+    }
+    botStorage.mutex.Unlock()
+
+    log.Println("Publishing the daily challenge to", len(users), "users")
+    for _, userState := range users {
+        lang := userState.Lang()
+        if _, err := botStorage.transport.SendText(*userState.User, i18n.N(lang, i18n.DailyPublished, p.Moves()), dailyKeyboard(lang)); err != nil {
+            log.Println("Failed to send the daily challenge to", userState.User.ID, err)
+        }
+    }
+}
+
+// RunDaily publishes a challenge every day at the configured time.
+func (botStorage *TicTacToeBotStorage) RunDaily() {
+    offset := botStorage.dailyOffset()
+    for {
+        now := time.Now()
+        next := dailyDay(now, offset).Add(24 * time.Hour + offset)
+        time.Sleep(next.Sub(now))
+        botStorage.publishDaily(next)
+    }
+}
+
+func registerDailyHandlers(router *Router, botStorage *TicTacToeBotStorage) {
+    router.Command("/daily", func(input *Input) error {
+        switch payload := strings.ToLower(strings.TrimSpace(input.Payload)); payload {
+        case "":
+            return startDaily(botStorage, input)
+        case "on", "off":
+            userState := botStorage.RegisterUser(input)
+            userState.DailySubscribed = payload == "on"
+            botStorage.setUserState(userState.User.ID, userState)
+            text := i18n.T(userState.Lang(), i18n.DailyUnsubscribed)
+            if userState.DailySubscribed {
+                text = i18n.T(userState.Lang(), i18n.DailySubscribed, botStorage.config.Daily.Time)
+            }
+            return SendEditable(botStorage, &userState, NewMessage, MessageNotEditable, text)
+        case "top":
+            userState := botStorage.RegisterUser(input)
+            date := dailyDay(time.Now(), botStorage.dailyOffset()).Format(dailyDateFormat)
+            return SendEditable(botStorage, &userState, NewMessage, MessageNotEditable,
+                                botStorage.dailyLeaderboard(userState.User.ID, date, userState.Lang()))
+        }
+        userState := botStorage.RegisterUser(input)
+        return SendEditable(botStorage, &userState, NewMessage, MessageNotEditable, i18n.T(userState.Lang(), i18n.DailyUsage))
+    })
+    router.Action("daily", func(input *Input) error {
+        return startDaily(botStorage, input)
+    })
+}
@@ -0,0 +1,429 @@
+package main
+
+import (
+    "bytes"
+    "fmt"
+    "log"
+    "net/http"
+    "net/url"
+    "strconv"
+    "strings"
+    "sync"
+
+    discordgo "github.com/bwmarrin/discordgo"
+    game "./game"
+    i18n "./i18n"
+)
+
+// Discord shows at most five action rows of five buttons and 25 options in a
+// select menu.
+const (
+    discordMaxRows = 5
+    discordMaxButtons = 5
+    discordMaxOptions = 25
+)
+
+// DiscordTransport runs the bot as a Discord application: slash commands and
+// message components come in over the gateway, the bot answers in direct
+// messages.
+type DiscordTransport struct {
+    session *discordgo.Session
+    accounts Accounts
+    guildID string
+    features FeaturesConfig
+    router *Router
+    stop chan struct{}
+
+    mutex sync.Mutex
+    // channels caches the direct message channel of every Discord user.
+    channels map[string]string
+}
+
+// discordRewrite sends requests meant for discord.com to another server, such
+// as a local stand-in.
+type discordRewrite struct {
+    target *url.URL
+}
+
+func (rewrite discordRewrite) RoundTrip(r *http.Request) (*http.Response, error) {
+    if r.URL.Host == "discord.com" {
+        r = r.Clone(r.Context())
+        r.URL.Scheme, r.URL.Host, r.Host = rewrite.target.Scheme, rewrite.target.Host, ""
+    }
+    return http.DefaultTransport.RoundTrip(r)
+}
+
+func NewDiscordTransport(config Config, accounts Accounts) (*DiscordTransport, error) {
+    session, err := discordgo.New("Bot " + config.Discord.Token)
+    if err != nil {
+        return nil, err
+    }
+    session.Identify.Intents = discordgo.IntentsNone
+    if config.Discord.APIURL != "" && config.Discord.APIURL != discordgo.EndpointDiscord {
+        target, err := url.Parse(config.Discord.APIURL)
+        if err != nil {
+            return nil, err
+        }
+        session.Client = &http.Client{Transport: discordRewrite{target}, Timeout: session.Client.Timeout}
+    }
+    transport := &DiscordTransport{
+        session: session,
+        accounts: accounts,
+        guildID: config.Discord.GuildID,
+        features: config.Features,
+        stop: make(chan struct{}),
+        channels: make(map[string]string),
+    }
+    session.AddHandler(transport.onReady)
+    session.AddHandler(transport.onInteraction)
+    return transport, nil
+}
+
+func (transport *DiscordTransport) Platform() string {
+    return PlatformDiscord
+}
+
+func localizations(id i18n.MessageID) map[discordgo.Locale]string {
+    return map[discordgo.Locale]string{discordgo.Russian: i18n.T(i18n.Russian, id)}
+}
+
+func slashCommand(name string, description i18n.MessageID, options ...*discordgo.ApplicationCommandOption) *discordgo.ApplicationCommand {
+    descriptions := localizations(description)
+    return &discordgo.ApplicationCommand{
+        Name: name,
+        Description: i18n.T(i18n.English, description),
+        DescriptionLocalizations: &descriptions,
+        Options: options,
+    }
+}
+
+func stringOption(name string, description i18n.MessageID, required bool) *discordgo.ApplicationCommandOption {
+    return &discordgo.ApplicationCommandOption{
+        Type: discordgo.ApplicationCommandOptionString,
+        Name: name,
+        Description: i18n.T(i18n.English, description),
+        DescriptionLocalizations: localizations(description),
+        Required: required,
+    }
+}
+
+// commands mirror the Telegram commands; an option value is passed on as the
+// command payload.
+func (transport *DiscordTransport) commands() []*discordgo.ApplicationCommand {
+    commands := []*discordgo.ApplicationCommand{
+        slashCommand("start", i18n.CommandStart),
+        slashCommand("resign", i18n.CommandResign),
+        slashCommand("help", i18n.CommandHelp),
+    }
+    if transport.features.TextMoves {
+        commands = append(commands, slashCommand("move", i18n.CommandMove, stringOption("cell", i18n.CommandMoveCell, true)))
+    }
+    if transport.features.Language {
+        commands = append(commands, slashCommand("language", i18n.CommandLanguage, stringOption("value", i18n.CommandArgument, false)))
+    }
+    if transport.features.Themes {
+        commands = append(commands, slashCommand("theme", i18n.CommandTheme, stringOption("value", i18n.CommandArgument, false)))
+    }
+    if transport.features.Replay {
+        commands = append(commands, slashCommand("replay", i18n.CommandReplay, stringOption("value", i18n.CommandArgument, false)))
+    }
+    if transport.features.Hint && transport.features.HintPvP {
+        commands = append(commands, slashCommand("hint", i18n.CommandHint))
+    }
+    if transport.features.Puzzle {
+        commands = append(commands, slashCommand("puzzle", i18n.CommandPuzzle, stringOption("value", i18n.CommandArgument, false)))
+    }
+    if transport.features.Daily {
+        commands = append(commands, slashCommand("daily", i18n.CommandDaily, stringOption("value", i18n.CommandArgument, false)))
+    }
+    return commands
+}
+
+func (transport *DiscordTransport) onReady(session *discordgo.Session, ready *discordgo.Ready) {
+    appID := ready.User.ID
+    if ready.Application != nil {
+        appID = ready.Application.ID
+    }
+    if _, err := session.ApplicationCommandBulkOverwrite(appID, transport.guildID, transport.commands()); err != nil {
+        log.Println("Failed to register Discord commands", err)
+    }
+}
+
+func (transport *DiscordTransport) discordUser(interaction *discordgo.Interaction) (User, error) {
+    user := interaction.User
+    if interaction.Member != nil {
+        user = interaction.Member.User
+    }
+    if user == nil {
+        return User{}, fmt.Errorf("interaction %s has no user", interaction.ID)
+    }
+    id, err := transport.accounts.UserID(PlatformDiscord, user.ID)
+    if err != nil {
+        return User{}, err
+    }
+    name := user.GlobalName
+    if name == "" {
+        name = user.Username
+    }
+    return User{
+        ID: id,
+        Platform: PlatformDiscord,
+        ExternalID: user.ID,
+        FirstName: name,
+        Username: user.Username,
+        LanguageCode: string(interaction.Locale),
+    }, nil
+}
+
+func (transport *DiscordTransport) onInteraction(session *discordgo.Session, event *discordgo.InteractionCreate) {
+    interaction := event.Interaction
+    user, err := transport.discordUser(interaction)
+    if err != nil {
+        log.Println("Discord interaction", err)
+        return
+    }
+    input := &Input{User: user}
+
+    switch interaction.Type {
+    case discordgo.InteractionApplicationCommand:
+        data := interaction.ApplicationCommandData()
+        input.Text = "/" + data.Name
+        for _, option := range data.Options {
+            if data.Name == "move" {
+                input.Text = option.StringValue()
+            } else {
+                input.Text += " " + option.StringValue()
+            }
+        }
+        // The bot answers in direct messages, so the reply to the command
+        // itself is only a placeholder removed afterwards.
+        err = session.InteractionRespond(interaction, &discordgo.InteractionResponse{
+            Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+            Data: &discordgo.InteractionResponseData{Flags: discordgo.MessageFlagsEphemeral},
+        })
+        if err == nil {
+            defer session.InteractionResponseDelete(interaction)
+        }
+    case discordgo.InteractionMessageComponent:
+        data := interaction.MessageComponentData()
+        customID := data.CustomID
+        if len(data.Values) > 0 {
+            customID = data.Values[0]
+        }
+        input.Action = customID[strings.Index(customID, ":") + 1:]
+        if k := strings.Index(input.Action, "|"); k >= 0 {
+            input.Action, input.Data = input.Action[:k], input.Action[k + 1:]
+        }
+        if interaction.Message != nil {
+            input.Message = discordRef(interaction.Message)
+        }
+        err = session.InteractionRespond(interaction, &discordgo.InteractionResponse{
+            Type: discordgo.InteractionResponseDeferredMessageUpdate,
+        })
+    default:
+        return
+    }
+    if err != nil {
+        log.Println("Failed to answer Discord interaction", err)
+    }
+    if transport.router == nil {
+        return
+    }
+    if err := transport.router.Dispatch(input); err != nil {
+        log.Println("Discord handler failed", err)
+    }
+}
+
+// customID keeps ids unique within a message even if two buttons share an
+// action and data.
+func customID(k int, button Button) string {
+    return fmt.Sprintf("%d:%s|%s", k, button.Action, button.Data)
+}
+
+func keycap(n int) string {
+    if n > 9 {
+        return strconv.Itoa(n)
+    }
+    return strconv.Itoa(n) + "\ufe0f\u20e3"
+}
+
+// discordGrid draws a keyboard too big for buttons as an emoji board with
+// letters over the columns and numbers next to the rows. Regional indicator
+// letters are kept apart so that pairs do not turn into flags.
+func discordGrid(keyboard Keyboard) string {
+    var grid strings.Builder
+    grid.WriteString("⬛")
+    for j := range keyboard[0] {
+        grid.WriteString("\u200b")
+        grid.WriteRune(rune(0x1f1e6 + j))
+    }
+    for i, row := range keyboard {
+        grid.WriteString("\n" + keycap(i + 1))
+        for _, button := range row {
+            grid.WriteString(button.Text)
+        }
+    }
+    return grid.String()
+}
+
+// discordComponents lays a keyboard out within Discord's limits: as it is if
+// it fits, packed into rows of five if it is a list of single buttons, and
+// otherwise as a board drawn in the text with select menus for the cells.
+func discordComponents(text string, keyboard Keyboard) (string, []discordgo.MessageComponent) {
+    components := []discordgo.MessageComponent{}
+    if len(keyboard) == 0 {
+        return text, components
+    }
+
+    var buttons []Button
+    fits, single := len(keyboard) <= discordMaxRows, true
+    for _, row := range keyboard {
+        fits = fits && len(row) <= discordMaxButtons
+        single = single && len(row) == 1
+        buttons = append(buttons, row...)
+    }
+    if !fits && single && len(buttons) <= discordMaxRows * discordMaxButtons {
+        packed := Keyboard{}
+        for k := 0; k < len(buttons); k += discordMaxButtons {
+            end := k + discordMaxButtons
+            if end > len(buttons) {
+                end = len(buttons)
+            }
+            packed = append(packed, buttons[k:end])
+        }
+        keyboard, fits = packed, true
+    }
+
+    if fits {
+        k := 0
+        for _, row := range keyboard {
+            actionsRow := discordgo.ActionsRow{}
+            for _, button := range row {
+                actionsRow.Components = append(actionsRow.Components, discordgo.Button{
+                    Label: button.Text,
+                    Style: discordgo.SecondaryButton,
+                    CustomID: customID(k, button),
+                })
+                k++
+            }
+            components = append(components, actionsRow)
+        }
+        return text, components
+    }
+
+    width := len(keyboard[0])
+    rowsPerMenu := discordMaxOptions / width
+    if rowsPerMenu == 0 || (len(keyboard) + rowsPerMenu - 1) / rowsPerMenu > discordMaxRows {
+        log.Println("Keyboard does not fit into a Discord message", len(keyboard), width)
+        return text, components
+    }
+    k := 0
+    for first := 0; first < len(keyboard); first += rowsPerMenu {
+        last := first + rowsPerMenu
+        if last > len(keyboard) {
+            last = len(keyboard)
+        }
+        menu := discordgo.SelectMenu{
+            CustomID: fmt.Sprintf("cells:%d", first),
+            Placeholder: game.Move{I: first, J: 0}.String() + " – " + game.Move{I: last - 1, J: width - 1}.String(),
+        }
+        for i := first; i < last; i++ {
+            for j, button := range keyboard[i] {
+                menu.Options = append(menu.Options, discordgo.SelectMenuOption{
+                    Label: game.Move{I: i, J: j}.String() + " " + button.Text,
+                    Value: customID(k, button),
+                })
+                k++
+            }
+        }
+        components = append(components, discordgo.ActionsRow{Components: []discordgo.MessageComponent{menu}})
+    }
+    return text + "\n" + discordGrid(keyboard), components
+}
+
+func discordRef(message *discordgo.Message) MessageRef {
+    chatID, _ := strconv.ParseInt(message.ChannelID, 10, 64)
+    return MessageRef{MessageID: message.ID, ChatID: chatID, Platform: PlatformDiscord}
+}
+
+func (transport *DiscordTransport) channel(to User) (string, error) {
+    transport.mutex.Lock()
+    defer transport.mutex.Unlock()
+    if channelID, ok := transport.channels[to.ExternalID]; ok {
+        return channelID, nil
+    }
+    channel, err := transport.session.UserChannelCreate(to.ExternalID)
+    if err != nil {
+        return "", err
+    }
+    transport.channels[to.ExternalID] = channel.ID
+    return channel.ID, nil
+}
+
+func boardFile(photo Photo) []*discordgo.File {
+    return []*discordgo.File{{Name: "board.png", ContentType: "image/png", Reader: bytes.NewReader(photo.PNG)}}
+}
+
+func (transport *DiscordTransport) send(to User, message *discordgo.MessageSend) (MessageRef, error) {
+    channelID, err := transport.channel(to)
+    if err != nil {
+        return MessageRef{}, err
+    }
+    m, err := transport.session.ChannelMessageSendComplex(channelID, message)
+    if err != nil {
+        return MessageRef{}, err
+    }
+    return discordRef(m), nil
+}
+
+func (transport *DiscordTransport) SendText(to User, text string, keyboard Keyboard) (MessageRef, error) {
+    content, components := discordComponents(text, keyboard)
+    return transport.send(to, &discordgo.MessageSend{Content: content, Components: components})
+}
+
+func (transport *DiscordTransport) SendPhoto(to User, photo Photo, keyboard Keyboard) (MessageRef, error) {
+    content, components := discordComponents(photo.Caption, keyboard)
+    return transport.send(to, &discordgo.MessageSend{Content: content, Components: components, Files: boardFile(photo)})
+}
+
+func (transport *DiscordTransport) edit(ref MessageRef, text string, keyboard Keyboard) *discordgo.MessageEdit {
+    content, components := discordComponents(text, keyboard)
+    edit := discordgo.NewMessageEdit(strconv.FormatInt(ref.ChatID, 10), ref.MessageID)
+    edit.Content = &content
+    edit.Components = &components
+    return edit
+}
+
+func (transport *DiscordTransport) EditText(ref MessageRef, text string, keyboard Keyboard) error {
+    _, err := transport.session.ChannelMessageEditComplex(transport.edit(ref, text, keyboard))
+    return err
+}
+
+func (transport *DiscordTransport) EditPhoto(ref MessageRef, photo Photo, keyboard Keyboard) error {
+    edit := transport.edit(ref, photo.Caption, keyboard)
+    edit.Files = boardFile(photo)
+    edit.Attachments = &[]*discordgo.MessageAttachment{}
+    _, err := transport.session.ChannelMessageEditComplex(edit)
+    return err
+}
+
+func (transport *DiscordTransport) Delete(ref MessageRef) error {
+    return transport.session.ChannelMessageDelete(strconv.FormatInt(ref.ChatID, 10), ref.MessageID)
+}
+
+func (transport *DiscordTransport) Bind(router *Router) {
+    transport.router = router
+}
+
+func (transport *DiscordTransport) Start() {
+    if err := transport.session.Open(); err != nil {
+        log.Println("Failed to connect to Discord", err)
+        return
+    }
+    <-transport.stop
+    transport.session.Close()
+}
+
+func (transport *DiscordTransport) Stop() {
+    close(transport.stop)
+}
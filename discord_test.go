@@ -0,0 +1,98 @@
+package main
+
+import (
+    "fmt"
+    "strings"
+    "testing"
+
+    discordgo "github.com/bwmarrin/discordgo"
+    game "./game"
+)
+
+func testKeyboard(height int, width int) Keyboard {
+    keyboard := Keyboard{}
+    for i := 0; i < height; i++ {
+        row := []Button{}
+        for j := 0; j < width; j++ {
+            row = append(row, Button{Text: "🌫", Action: "cell", Data: fmt.Sprintf("%d,%d", i, j)})
+        }
+        keyboard = append(keyboard, row)
+    }
+    return keyboard
+}
+
+func TestDiscordComponents(t *testing.T) {
+    for _, test := range []struct {
+        name string
+        keyboard Keyboard
+        // rows is the number of buttons, or of options of the select menu,
+        // in every action row.
+        rows []int
+        menus []string
+    }{
+        {"empty", Keyboard{}, nil, nil},
+        {"buttons", testKeyboard(3, 3), []int{3, 3, 3}, nil},
+        {"5x5", testKeyboard(5, 5), []int{5, 5, 5, 5, 5}, nil},
+        {"list", testKeyboard(8, 1), []int{5, 3}, nil},
+        {"full list", testKeyboard(25, 1), []int{5, 5, 5, 5, 5}, nil},
+        {"long list", testKeyboard(27, 1), []int{25, 2}, []string{"a1 – a25", "a26 – a27"}},
+        {"6x6", testKeyboard(6, 6), []int{24, 12}, []string{"a1 – f4", "a5 – f6"}},
+        {"8x8", testKeyboard(8, 8), []int{24, 24, 16}, []string{"a1 – h3", "a4 – h6", "a7 – h8"}},
+    } {
+        t.Run(test.name, func(t *testing.T) {
+            text, components := discordComponents("board", test.keyboard)
+            if test.menus == nil && text != "board" {
+                t.Errorf("text %q of a keyboard of buttons", text)
+            }
+            if test.menus != nil && !strings.HasPrefix(text, "board\n⬛") {
+                t.Errorf("the board is not drawn: %q", text)
+            }
+            if len(components) != len(test.rows) {
+                t.Fatalf("%d action rows, want %d", len(components), len(test.rows))
+            }
+
+            var ids, menus []string
+            for r, component := range components {
+                row := component.(discordgo.ActionsRow)
+                n := len(row.Components)
+                if test.menus != nil {
+                    menu := row.Components[0].(discordgo.SelectMenu)
+                    menus = append(menus, menu.Placeholder)
+                    n = len(menu.Options)
+                    for _, option := range menu.Options {
+                        ids = append(ids, option.Value)
+                    }
+                } else {
+                    for _, button := range row.Components {
+                        ids = append(ids, button.(discordgo.Button).CustomID)
+                    }
+                }
+                if n != test.rows[r] {
+                    t.Errorf("row %d has %d cells, want %d", r, n, test.rows[r])
+                }
+            }
+            if fmt.Sprint(menus) != fmt.Sprint(test.menus) {
+                t.Errorf("menus %q, want %q", menus, test.menus)
+            }
+
+            k := 0
+            for _, row := range test.keyboard {
+                for _, button := range row {
+                    if k >= len(ids) || ids[k] != customID(k, button) {
+                        t.Fatalf("button %d is not laid out in order: %q", k, ids)
+                    }
+                    k++
+                }
+            }
+        })
+    }
+}
+
+func TestDiscordMenuLabels(t *testing.T) {
+    _, components := discordComponents("board", testKeyboard(8, 8))
+    menu := components[1].(discordgo.ActionsRow).Components[0].(discordgo.SelectMenu)
+    want := game.Move{I: 3, J: 0}.String() + " 🌫"
+    if menu.Options[0].Label != want {
+        t.Errorf("first option of the second menu is %q, want %q", menu.Options[0].Label, want)
+    }
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+    "bufio"
+    "bytes"
+    "encoding/json"
+    "log"
+    "os"
+    "sync"
+    "time"
+
+    game "./game"
+)
+
+type EventType string
+const (
+    GameCreatedEvent EventType = "GameCreated"
+    MoveEvent                  = "Move"
+    ResignEvent                = "Resign"
+    GameEndedEvent             = "GameEnded"
+)
+
+const compactionGrace = time.Minute
+
+type Event struct {
+    Type EventType
+    GameID int64
+    Time time.Time
+
+    XUserID int64 `json:",omitempty"`
+    OUserID int64 `json:",omitempty"`
+    Width int `json:",omitempty"`
+    Height int `json:",omitempty"`
+    WinLength int `json:",omitempty"`
+    Opening string `json:",omitempty"`
+
+    N int `json:",omitempty"`
+    I int `json:",omitempty"`
+    J int `json:",omitempty"`
+
+    UserID int64 `json:",omitempty"`
+    WhoWin game.Cell `json:",omitempty"`
+}
+
+type EventLog struct {
+    path string
+    file *os.File
+    events []Event
+    mutex sync.Mutex
+}
+
+func OpenEventLog(path string) (*EventLog, error) {
+    eventLog := &EventLog{path: path}
+    data, err := os.ReadFile(path)
+    if err != nil && !os.IsNotExist(err) {
+        return nil, err
+    }
+
+    valid := 0
+    scanner := bufio.NewScanner(bytes.NewReader(data))
+    for scanner.Scan() {
+        var event Event
+        if err := decodeEvent(scanner.Bytes(), &event); err != nil {
+            log.Println("Event log is torn after", len(eventLog.events), "events, dropping the tail")
+            break
+        }
+        eventLog.events = append(eventLog.events, event)
+        valid += len(scanner.Bytes()) + 1
+    }
+    missingNewline := valid > len(data)
+    if missingNewline {
+        valid = len(data)
+    }
+
+    eventLog.file, err = os.OpenFile(path, os.O_CREATE | os.O_WRONLY, 0600)
+    if err != nil {
+        return nil, err
+    }
+    if err := eventLog.file.Truncate(int64(valid)); err != nil {
+        eventLog.file.Close()
+        return nil, err
+    }
+    if _, err := eventLog.file.Seek(int64(valid), 0); err != nil {
+        eventLog.file.Close()
+        return nil, err
+    }
+    if missingNewline {
+        if _, err := eventLog.file.Write([]byte("\n")); err != nil {
+            eventLog.file.Close()
+            return nil, err
+        }
+    }
+    return eventLog, nil
+}
+
+func (eventLog *EventLog) Events() []Event {
+    eventLog.mutex.Lock()
+    defer eventLog.mutex.Unlock()
+    return append([]Event(nil), eventLog.events...)
+}
+
+func (eventLog *EventLog) Append(event Event) error {
+    eventLog.mutex.Lock()
+    defer eventLog.mutex.Unlock()
+    event.Time = time.Now()
+    b, err := json.Marshal(event)
+    if err != nil {
+        return err
+    }
+    if _, err := eventLog.file.Write(append(b, '\n')); err != nil {
+        return err
+    }
+    if err := eventLog.file.Sync(); err != nil {
+        return err
+    }
+    eventLog.events = append(eventLog.events, event)
+    return nil
+}
+
+func (eventLog *EventLog) Compact() error {
+    eventLog.mutex.Lock()
+    defer eventLog.mutex.Unlock()
+
+    finished := make(map[int64]bool)
+    for _, event := range eventLog.events {
+        if (event.Type == GameEndedEvent || event.Type == ResignEvent) && time.Since(event.Time) > compactionGrace {
+            finished[event.GameID] = true
+        }
+    }
+    var kept []Event
+    var buf bytes.Buffer
+    for _, event := range eventLog.events {
+        if finished[event.GameID] {
+            continue
+        }
+        b, err := json.Marshal(event)
+        if err != nil {
+            return err
+        }
+        buf.Write(append(b, '\n'))
+        kept = append(kept, event)
+    }
+    if len(kept) == len(eventLog.events) {
+        return nil
+    }
+
+    // Appends go on to the old file until the new one is in its place.
+    file, err := replaceFile(eventLog.path, &buf)
+    if file == nil {
+        return err
+    }
+    eventLog.file.Close()
+    eventLog.file = file
+    log.Println("Event log compacted from", len(eventLog.events), "to", len(kept), "events")
+    eventLog.events = kept
+    return err
+}
+
+func (eventLog *EventLog) Close() error {
+    return eventLog.file.Close()
+}
+
+func (botStorage *TicTacToeBotStorage) logEvent(event Event) {
+    if botStorage.events == nil {
+        return
+    }
+    if err := botStorage.events.Append(event); err != nil {
+        log.Println("Failed to append event", event.Type, event.GameID, err)
+    }
+}
+
+func (botStorage *TicTacToeBotStorage) restoreGameUser(userId int64, opponentUserId int64, whoMe game.Cell, record *GameRecord) {
+    userState := botStorage.getUserState(userId)
+    if userState.GameID > record.ID {
+        return
+    }
+    if userState.GameID == record.ID && record.Finished && userState.State != InGame {
+        return
+    }
+    userState.GameID = record.ID
+    userState.OpponentUserID = opponentUserId
+    userState.WhoMe = whoMe
+    userState.GameState = record.Replay()
+    userState.LastX, userState.LastY = -1, -1
+    if k := len(record.Moves) - 1; k >= record.OpeningLength() && (k % 2 == 0) != (whoMe == game.X) {
+        userState.LastX, userState.LastY = record.Moves[k].I, record.Moves[k].J
+    }
+    userState.State = InGame
+    if record.Finished {
+        userState.State = EndGame
+    }
+    rebuildSelector(&userState)
+    botStorage.setUserState(userId, userState)
+
+    botStorage.mutex.Lock()
+    defer botStorage.mutex.Unlock()
+    if !record.Finished && botStorage.UsersSearching[userId] {
+        delete(botStorage.UsersSearching, userId)
+        botStorage.store.Dequeue(userId)
+    }
+}
+
+func (botStorage *TicTacToeBotStorage) ReplayEvents(events []Event) {
+    records := make(map[int64]*GameRecord)
+    var order []int64
+    for _, event := range events {
+        record, ok := records[event.GameID]
+        if !ok {
+            loaded, err := botStorage.store.LoadGame(event.GameID)
+            if err != nil && event.Type != GameCreatedEvent {
+                log.Println("Replay: unknown game", event.GameID, err)
+                continue
+            }
+            record = &loaded
+            records[event.GameID] = record
+            order = append(order, event.GameID)
+        }
+
+        switch event.Type {
+        case GameCreatedEvent:
+            if record.ID == 0 {
+                *record = GameRecord{
+                    ID: event.GameID,
+                    XUserID: event.XUserID,
+                    OUserID: event.OUserID,
+                    Width: event.Width,
+                    Height: event.Height,
+                    WinLength: event.WinLength,
+                    Opening: event.Opening,
+                    StartedAt: event.Time,
+                }
+            }
+        case MoveEvent:
+            if event.N == len(record.Moves) {
+                record.Moves = append(record.Moves, game.Move{I: event.I, J: event.J})
+            }
+        case ResignEvent, GameEndedEvent:
+            if !record.Finished {
+                record.Finished = true
+                record.WhoWin = event.WhoWin
+                record.FinishedAt = event.Time
+            }
+        }
+    }
+
+    for _, gameId := range order {
+        record := records[gameId]
+        if err := botStorage.store.SaveGame(record); err != nil {
+            log.Println("Replay: failed to save game", gameId, err)
+        }
+        botStorage.restoreGameUser(record.XUserID, record.OUserID, game.X, record)
+        botStorage.restoreGameUser(record.OUserID, record.XUserID, game.O, record)
+    }
+    log.Println("Replayed", len(events), "events of", len(order), "games")
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+    "io"
+    "log"
+    "os"
+    "path/filepath"
+    "testing"
+    "time"
+)
+
+func TestEventLogAppendAfterCompact(t *testing.T) {
+    log.SetOutput(io.Discard)
+    defer log.SetOutput(os.Stderr)
+    path := filepath.Join(t.TempDir(), "events.log")
+    eventLog, err := OpenEventLog(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    for _, event := range []Event{
+        {Type: GameCreatedEvent, GameID: 1},
+        {Type: GameEndedEvent, GameID: 1},
+        {Type: GameCreatedEvent, GameID: 2},
+    } {
+        if err := eventLog.Append(event); err != nil {
+            t.Fatal(err)
+        }
+    }
+    for k := range eventLog.events {
+        eventLog.events[k].Time = time.Now().Add(-2 * compactionGrace)
+    }
+    if err := eventLog.Compact(); err != nil {
+        t.Fatal(err)
+    }
+    if err := eventLog.Append(Event{Type: MoveEvent, GameID: 2, I: 3, J: 4}); err != nil {
+        t.Fatal(err)
+    }
+    eventLog.Close()
+
+    reopened, err := OpenEventLog(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer reopened.Close()
+    events := reopened.Events()
+    if len(events) != 2 || events[0].GameID != 2 || events[1].Type != MoveEvent || events[1].J != 4 {
+        t.Errorf("events after compaction and append: %+v", events)
+    }
+}
@@ -0,0 +1,193 @@
+package lib
+
+import (
+    "math/rand"
+)
+
+type Engine interface {
+    BestMove(gs *GameState) (Move, bool)
+}
+
+// HeuristicEngine scores every empty cell next to the existing stones by the
+// lines it would build for the side to move and the lines it would break for
+// the opponent, and plays the best one.
+type HeuristicEngine struct {
+    Rand *rand.Rand
+    // Defence is how much breaking the opponent's lines is worth against
+    // building own ones, in percent; 0 means the default 90.
+    Defence int
+}
+
+const defaultDefence = 90
+
+const (
+    scoreWin       = 10000000
+    scoreOpenFour  = 100000
+    scoreFour      = 10000
+    scoreOpenThree = 5000
+    scoreThree     = 300
+)
+
+var directions = [4][2]int{{0, 1}, {1, 0}, {1, 1}, {1, -1}}
+
+func opponent(who Cell) Cell {
+    if who == X {
+        return O
+    }
+    return X
+}
+
+func (gs *GameState) inside(i int, j int) bool {
+    return i >= 0 && i < gs.Height && j >= 0 && j < gs.Width
+}
+
+// lineScore values the line through (i, j) in direction d if who played there.
+func (gs *GameState) lineScore(i int, j int, d [2]int, who Cell) int {
+    count, open, room := 1, 0, 1
+    for _, sign := range []int{1, -1} {
+        k := 1
+        for ; gs.inside(i + sign * k * d[0], j + sign * k * d[1]) && gs.Board[i + sign * k * d[0]][j + sign * k * d[1]] == who; k++ {
+            count++
+            room++
+        }
+        if gs.inside(i + sign * k * d[0], j + sign * k * d[1]) && gs.Board[i + sign * k * d[0]][j + sign * k * d[1]] == Empty {
+            open++
+        }
+        for ; gs.inside(i + sign * k * d[0], j + sign * k * d[1]) && gs.Board[i + sign * k * d[0]][j + sign * k * d[1]] != opponent(who); k++ {
+            room++
+        }
+    }
+
+    switch {
+    case count >= gs.WinLength:
+        return scoreWin
+    case room < gs.WinLength || open == 0:
+        return 0
+    case count == gs.WinLength - 1 && open == 2:
+        return scoreOpenFour
+    case count == gs.WinLength - 1:
+        return scoreFour
+    case count == gs.WinLength - 2 && open == 2:
+        return scoreOpenThree
+    case count == gs.WinLength - 2:
+        return scoreThree
+    }
+    score := open
+    for k := 0; k < count; k++ {
+        score *= 10
+    }
+    return score
+}
+
+func (gs *GameState) cellScore(i int, j int, who Cell) int {
+    score := 0
+    for _, d := range directions {
+        score += gs.lineScore(i, j, d, who)
+    }
+    return score
+}
+
+// ScoreMove rates an empty cell for the side to move: attack counts in full,
+// defence slightly less so that a win is always preferred to a block.
+func (gs *GameState) ScoreMove(m Move) int {
+    return gs.scoreMove(m, defaultDefence)
+}
+
+func (gs *GameState) scoreMove(m Move, defencePercent int) int {
+    attack := gs.cellScore(m.I, m.J, gs.WhoTurn)
+    defence := gs.cellScore(m.I, m.J, opponent(gs.WhoTurn))
+    return attack + defence * defencePercent / 100
+}
+
+// Candidates lists empty cells within two steps of a stone, or the centre of
+// an empty board.
+func (gs *GameState) Candidates() []Move {
+    if len(gs.Moves) == 0 {
+        return []Move{{I: gs.Height / 2, J: gs.Width / 2}}
+    }
+    var moves []Move
+    for i := 0; i < gs.Height; i++ {
+        for j := 0; j < gs.Width; j++ {
+            if gs.Board[i][j] != Empty {
+                continue
+            }
+            near := false
+            for di := -2; di <= 2 && !near; di++ {
+                for dj := -2; dj <= 2 && !near; dj++ {
+                    near = gs.inside(i + di, j + dj) && gs.Board[i + di][j + dj] != Empty
+                }
+            }
+            if near {
+                moves = append(moves, Move{I: i, J: j})
+            }
+        }
+    }
+    return moves
+}
+
+func (e HeuristicEngine) BestMove(gs *GameState) (Move, bool) {
+    if gs.IsGameEnded {
+        return Move{}, false
+    }
+    defence := e.Defence
+    if defence == 0 {
+        defence = defaultDefence
+    }
+    var best []Move
+    bestScore := -1
+    for _, m := range gs.Candidates() {
+        score := gs.scoreMove(m, defence)
+        switch {
+        case score > bestScore:
+            best, bestScore = []Move{m}, score
+        case score == bestScore:
+            best = append(best, m)
+        }
+    }
+    if len(best) == 0 {
+        return Move{}, false
+    }
+    if e.Rand != nil {
+        return best[e.Rand.Intn(len(best))], true
+    }
+    return best[0], true
+}
+
+// Threats are the lines a stone of one side on a cell would make.
+type Threats struct {
+    Win bool
+    OpenFours int
+    Fours int
+    OpenThrees int
+}
+
+// ThreatsAt classifies the lines through the empty cell m as if who played
+// there. Fours and threes are one and two stones short of a win.
+func (gs *GameState) ThreatsAt(m Move, who Cell) Threats {
+    var t Threats
+    for _, d := range directions {
+        switch gs.lineScore(m.I, m.J, d, who) {
+        case scoreWin:
+            t.Win = true
+        case scoreOpenFour:
+            t.OpenFours++
+        case scoreFour:
+            t.Fours++
+        case scoreOpenThree:
+            t.OpenThrees++
+        }
+    }
+    return t
+}
+
+// Unstoppable reports an open four or two fours: the opponent can block
+// only one of the winning cells.
+func (t Threats) Unstoppable() bool {
+    return t.OpenFours > 0 || t.Fours > 1
+}
+
+// DoubleThree reports two open threes, which become an open four on the
+// next move whichever one the opponent blocks.
+func (t Threats) DoubleThree() bool {
+    return t.OpenThrees > 1
+}
@@ -0,0 +1,69 @@
+package lib
+
+import "testing"
+
+// position plays moves alternately from X on an empty board.
+func position(t *testing.T, width int, height int, winLength int, moves ...Move) GameState {
+    t.Helper()
+    gs := GameState{Width: width, Height: height, WinLength: winLength}
+    if !gs.Replay(moves) {
+        t.Fatalf("cannot play %v", moves)
+    }
+    return gs
+}
+
+func TestEngineOpensInTheCentre(t *testing.T) {
+    gs := position(t, 8, 8, 5)
+    if candidates := gs.Candidates(); len(candidates) != 1 || candidates[0] != (Move{I: 4, J: 4}) {
+        t.Errorf("candidates on an empty board: %v", candidates)
+    }
+    if m, ok := (HeuristicEngine{}).BestMove(&gs); !ok || m != (Move{I: 4, J: 4}) {
+        t.Errorf("engine opens with %v", m)
+    }
+}
+
+func TestEngineWinsBeforeBlocking(t *testing.T) {
+    // X and O both have four in a row, X to move.
+    gs := position(t, 8, 8, 5,
+                   Move{3, 1}, Move{5, 1}, Move{3, 2}, Move{5, 2},
+                   Move{3, 3}, Move{5, 3}, Move{3, 4}, Move{5, 4})
+    m, ok := (HeuristicEngine{}).BestMove(&gs)
+    if !ok || !gs.MakeMove(m.I, m.J) || gs.WhoWin != X {
+        t.Errorf("X played %v instead of winning", m)
+    }
+}
+
+func TestEngineBlocksFour(t *testing.T) {
+    gs := position(t, 8, 8, 5,
+                   Move{3, 1}, Move{5, 1}, Move{3, 2}, Move{5, 2},
+                   Move{3, 3}, Move{0, 7}, Move{3, 4})
+    m, ok := (HeuristicEngine{}).BestMove(&gs)
+    if !ok || m != (Move{3, 0}) && m != (Move{3, 5}) {
+        t.Errorf("O played %v instead of blocking the four", m)
+    }
+    if over := gs.Clone(); !over.MakeMove(3, 0) || !over.MakeMove(3, 5) || over.WhoWin != X {
+        t.Errorf("the open four cannot be stopped, yet %+v", over)
+    }
+}
+
+func TestThreats(t *testing.T) {
+    // X's stones on row 4 and column e meet at e4.
+    gs := position(t, 8, 8, 5,
+                   Move{3, 2}, Move{7, 0}, Move{3, 3}, Move{7, 7},
+                   Move{4, 4}, Move{0, 7}, Move{5, 4}, Move{0, 0})
+    if threats := gs.ThreatsAt(Move{3, 1}, X); threats.OpenThrees != 1 || threats.DoubleThree() {
+        t.Errorf("three in a row: %+v", threats)
+    }
+    if threats := gs.ThreatsAt(Move{3, 4}, X); !threats.DoubleThree() || threats.Unstoppable() {
+        t.Errorf("two threes through one cell: %+v", threats)
+    }
+
+    gs.MakeMove(3, 4)
+    gs.MakeMove(1, 1)
+    if threats := gs.ThreatsAt(Move{3, 5}, X); threats.OpenFours != 1 || !threats.Unstoppable() {
+        t.Errorf("open four: %+v", threats)
+    }
+    if threats := gs.ThreatsAt(Move{3, 5}, O); threats != (Threats{}) {
+        t.Errorf("O has threats in X's lines: %+v", threats)
+    }
+}
@@ -0,0 +1,137 @@
+package lib
+
+// analysisDepth is how many fours in a row the forced win search tries.
+const analysisDepth = 8
+
+// MoveAnalysis rates a move against the engine's choice and marks the moves
+// that threw away a forced win or let the opponent have one.
+type MoveAnalysis struct {
+    Move Move
+    Who Cell
+    Best Move
+    // Quality is the heuristic score of Move against Best's, 0 to 100.
+    Quality int
+    MissedWin bool
+    AllowedWin bool
+}
+
+func (a MoveAnalysis) Mistake() bool {
+    return a.MissedWin || a.AllowedWin
+}
+
+// Clone is a copy of the game that shares no memory with gs.
+func (gs *GameState) Clone() GameState {
+    c := *gs
+    c.Board = make([][]Cell, len(gs.Board))
+    for i := range gs.Board {
+        c.Board[i] = append([]Cell(nil), gs.Board[i]...)
+    }
+    c.Moves = append([]Move(nil), gs.Moves...)
+    c.WinLine = append([]Move(nil), gs.WinLine...)
+    return c
+}
+
+func (gs *GameState) after(m Move) GameState {
+    c := gs.Clone()
+    c.MakeMove(m.I, m.J)
+    return c
+}
+
+// winningCells lists the empty cells where who would complete a line.
+func (gs *GameState) winningCells(who Cell) []Move {
+    var cells []Move
+    for i := 0; i < gs.Height; i++ {
+        for j := 0; j < gs.Width; j++ {
+            if gs.Board[i][j] == Empty && gs.ThreatsAt(Move{I: i, J: j}, who).Win {
+                cells = append(cells, Move{I: i, J: j})
+            }
+        }
+    }
+    return cells
+}
+
+// WinsWith reports whether m starts a forced win for the side to move: it
+// wins at once, or it makes a four and every answer leads to another one.
+func (gs *GameState) WinsWith(m Move, depth int) bool {
+    who := gs.WhoTurn
+    next := gs.after(m)
+    if next.IsGameEnded {
+        return next.WhoWin == who
+    }
+    if len(next.winningCells(opponent(who))) > 0 {
+        return false
+    }
+    threats := next.winningCells(who)
+    switch {
+    case len(threats) > 1:
+        return true
+    case len(threats) == 0:
+        return false
+    }
+    blocked := next.after(threats[0])
+    return !blocked.IsGameEnded && blocked.ForcedWin(depth - 1)
+}
+
+// ForcedWin reports whether the side to move wins by a chain of fours the
+// opponent has to block, at most depth of them.
+func (gs *GameState) ForcedWin(depth int) bool {
+    if gs.IsGameEnded {
+        return false
+    }
+    who := gs.WhoTurn
+    if len(gs.winningCells(who)) > 0 {
+        return true
+    }
+    if depth <= 0 {
+        return false
+    }
+    candidates := gs.Candidates()
+    if theirs := gs.winningCells(opponent(who)); len(theirs) > 1 {
+        return false
+    } else if len(theirs) == 1 {
+        candidates = theirs
+    }
+    for _, m := range candidates {
+        if gs.WinsWith(m, depth) {
+            return true
+        }
+    }
+    return false
+}
+
+// Analyse plays moves on from gs's position and rates each of them; gs
+// itself is left as it is.
+func (gs *GameState) Analyse(moves []Move) []MoveAnalysis {
+    board := gs.Clone()
+    result := make([]MoveAnalysis, 0, len(moves))
+    for _, m := range moves {
+        a := MoveAnalysis{Move: m, Who: board.WhoTurn, Best: m, Quality: 100}
+        if best, ok := (HeuristicEngine{}).BestMove(&board); ok {
+            a.Best = best
+            if bestScore := board.ScoreMove(best); bestScore > 0 && best != m {
+                a.Quality = board.ScoreMove(m) * 100 / bestScore
+                if a.Quality > 100 {
+                    a.Quality = 100
+                }
+            }
+        }
+
+        if board.ForcedWin(analysisDepth) && !board.WinsWith(m, analysisDepth) {
+            a.MissedWin = true
+        } else if next := board.after(m); !next.IsGameEnded && next.ForcedWin(analysisDepth) {
+            // Only a mistake if some other move would have held.
+            for _, other := range board.Candidates() {
+                if alternative := board.after(other); alternative.IsGameEnded || !alternative.ForcedWin(analysisDepth) {
+                    a.AllowedWin = true
+                    break
+                }
+            }
+        }
+
+        if !board.MakeMove(m.I, m.J) {
+            break
+        }
+        result = append(result, a)
+    }
+    return result
+}
@@ -0,0 +1,68 @@
+package lib
+
+import "testing"
+
+func TestCloneSharesNothing(t *testing.T) {
+    gs := position(t, 3, 3, 3, Move{0, 0})
+    c := gs.Clone()
+    c.MakeMove(1, 1)
+    if gs.Board[1][1] != Empty || len(gs.Moves) != 1 {
+        t.Errorf("a move on the clone changed the game: %v %v", gs.Board, gs.Moves)
+    }
+}
+
+func TestForcedWin(t *testing.T) {
+    // X has an open three on row 4, X to move.
+    gs := position(t, 8, 8, 5,
+                   Move{3, 2}, Move{7, 0}, Move{3, 3}, Move{7, 7}, Move{3, 4}, Move{0, 7})
+    if gs.ForcedWin(0) {
+        t.Errorf("a win without any four on the board")
+    }
+    if !gs.ForcedWin(1) {
+        t.Errorf("an open three does not win")
+    }
+    if !gs.WinsWith(Move{3, 1}, 1) || !gs.WinsWith(Move{3, 5}, 1) {
+        t.Errorf("the open four does not win")
+    }
+    if gs.WinsWith(Move{6, 6}, 1) {
+        t.Errorf("a quiet move wins")
+    }
+}
+
+func TestBlockedFourDoesNotWin(t *testing.T) {
+    // X's three on row 4 is blocked on the left.
+    gs := position(t, 8, 8, 5,
+                   Move{3, 1}, Move{3, 0}, Move{3, 2}, Move{7, 7}, Move{3, 3}, Move{0, 7})
+    if gs.WinsWith(Move{3, 4}, 2) {
+        t.Errorf("a four that O blocks wins")
+    }
+    gs.MakeMove(3, 4)
+    if !gs.ThreatsAt(Move{3, 5}, X).Win {
+        t.Errorf("the four does not threaten to win")
+    }
+    gs.MakeMove(3, 5)
+    if gs.ForcedWin(0) {
+        t.Errorf("the blocked four still wins")
+    }
+}
+
+func TestAnalyse(t *testing.T) {
+    gs := position(t, 8, 8, 5,
+                   Move{3, 1}, Move{5, 1}, Move{3, 2}, Move{5, 2}, Move{3, 3}, Move{5, 3})
+    analysis := gs.Analyse([]Move{{3, 4}, {5, 4}, {0, 0}})
+    if len(analysis) != 3 {
+        t.Fatalf("%d moves analysed", len(analysis))
+    }
+    if a := analysis[0]; a.Who != X || a.Mistake() || a.Quality != 100 {
+        t.Errorf("the open four is rated %+v", a)
+    }
+    if a := analysis[1]; a.Who != O || a.Mistake() {
+        t.Errorf("O's move in a lost position is rated %+v", a)
+    }
+    if a := analysis[2]; !a.MissedWin || a.Best == (Move{0, 0}) {
+        t.Errorf("X's miss of a win is rated %+v", a)
+    }
+    if len(gs.Moves) != 6 {
+        t.Errorf("analysis changed the game: %v", gs.Moves)
+    }
+}
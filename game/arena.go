@@ -0,0 +1,46 @@
+package lib
+
+import (
+    "math/rand"
+)
+
+// RandomOpening plays moves random stones: the first within two cells of the
+// centre, the rest next to the stones already there. It returns false if
+// the game ended during the opening.
+func (gs *GameState) RandomOpening(moves int, r *rand.Rand) bool {
+    for k := 0; k < moves; k++ {
+        var m Move
+        if len(gs.Moves) == 0 {
+            m = Move{I: gs.Height / 2 - 2 + r.Intn(5), J: gs.Width / 2 - 2 + r.Intn(5)}
+            if !gs.inside(m.I, m.J) {
+                m = Move{I: gs.Height / 2, J: gs.Width / 2}
+            }
+        } else {
+            candidates := gs.Candidates()
+            if len(candidates) == 0 {
+                return false
+            }
+            m = candidates[r.Intn(len(candidates))]
+        }
+        if !gs.MakeMove(m.I, m.J) || gs.IsGameEnded {
+            return false
+        }
+    }
+    return true
+}
+
+// PlayGame lets x and o play gs from its position to the end. It returns
+// the side whose engine failed to make a legal move, or Empty.
+func PlayGame(gs *GameState, x Engine, o Engine) Cell {
+    for !gs.IsGameEnded {
+        engine := x
+        if gs.WhoTurn == O {
+            engine = o
+        }
+        m, ok := engine.BestMove(gs)
+        if !ok || !gs.MakeMove(m.I, m.J) {
+            return gs.WhoTurn
+        }
+    }
+    return Empty
+}
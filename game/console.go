@@ -0,0 +1,114 @@
+package lib
+
+import (
+    "bufio"
+    "errors"
+    "fmt"
+    "io"
+    "strconv"
+    "strings"
+)
+
+// ConsoleText is what the console game says. MovePrompt gets the side to
+// move, EngineMove the engine's side and its move.
+type ConsoleText struct {
+    MovePrompt string
+    EngineMove string
+    InvalidCoordinates string
+    Draw string
+    XWon string
+    OWon string
+    PlayAgain string
+}
+
+type ConsoleOptions struct {
+    Text ConsoleText
+    // X and O are engines playing for that side; nil means a human at the keyboard.
+    X Engine
+    O Engine
+    In io.Reader
+    Out io.Writer
+}
+
+func (opts ConsoleOptions) engine(who Cell) Engine {
+    if who == X {
+        return opts.X
+    }
+    return opts.O
+}
+
+// ConsoleString draws the board with column letters and row numbers, the
+// same coordinates ParseMove accepts; the last move is put in brackets.
+func (gs *GameState) ConsoleString() string {
+    last, hasLast := gs.LastMove()
+    rowWidth := len(strconv.Itoa(gs.Height))
+    var b strings.Builder
+    b.WriteString(strings.Repeat(" ", rowWidth))
+    for j := 0; j < gs.Width; j++ {
+        fmt.Fprintf(&b, " %c ", 'a' + j)
+    }
+    b.WriteString("\n")
+    for i := 0; i < gs.Height; i++ {
+        fmt.Fprintf(&b, "%*d", rowWidth, i + 1)
+        for j := 0; j < gs.Width; j++ {
+            if hasLast && last.I == i && last.J == j {
+                fmt.Fprintf(&b, "[%s]", gs.Board[i][j])
+            } else {
+                fmt.Fprintf(&b, " %s ", gs.Board[i][j])
+            }
+        }
+        b.WriteString("\n")
+    }
+    return b.String()
+}
+
+func RunConsoleGameLoop(gs GameState, opts ConsoleOptions) error {
+    if !gs.ValidateParams() {
+        return errors.New("invalid board parameters")
+    }
+    in := bufio.NewScanner(opts.In)
+    out := opts.Out
+    text := opts.Text
+
+    for {
+        gs.ResetGame()
+        fmt.Fprint(out, "\n" + gs.ConsoleString())
+        for !gs.IsGameEnded {
+            if engine := opts.engine(gs.WhoTurn); engine != nil {
+                move, ok := engine.BestMove(&gs)
+                if !ok || !gs.MakeMove(move.I, move.J) {
+                    return fmt.Errorf("engine failed to move for %s", gs.WhoTurn)
+                }
+                fmt.Fprintf(out, "%s\n", fmt.Sprintf(text.EngineMove, opponent(gs.WhoTurn), move))
+            } else {
+                fmt.Fprint(out, fmt.Sprintf(text.MovePrompt, gs.WhoTurn))
+                if !in.Scan() {
+                    return in.Err()
+                }
+                move, ok := ParseMove(in.Text())
+                if !ok || !gs.MakeMove(move.I, move.J) {
+                    fmt.Fprintln(out, text.InvalidCoordinates)
+                    continue
+                }
+            }
+            fmt.Fprint(out, "\n" + gs.ConsoleString())
+        }
+
+        switch gs.WhoWin {
+        case Empty:
+            fmt.Fprintln(out, text.Draw)
+        case X:
+            fmt.Fprintln(out, text.XWon)
+        case O:
+            fmt.Fprintln(out, text.OWon)
+        }
+
+        fmt.Fprint(out, text.PlayAgain)
+        if !in.Scan() {
+            return in.Err()
+        }
+        if strings.TrimSpace(in.Text()) != "1" {
+            return nil
+        }
+    }
+}
@@ -0,0 +1,76 @@
+package lib
+
+import (
+    "strings"
+    "testing"
+)
+
+var testConsoleText = ConsoleText{
+    MovePrompt: "%s to move: ",
+    EngineMove: "Engine (%s) plays %s",
+    InvalidCoordinates: "Invalid coordinates",
+    Draw: "Draw",
+    XWon: "X wins",
+    OWon: "O wins",
+    PlayAgain: "Again? ",
+}
+
+func runConsole(t *testing.T, gs GameState, x Engine, o Engine, input string) string {
+    t.Helper()
+    var out strings.Builder
+    err := RunConsoleGameLoop(gs, ConsoleOptions{
+        Text: testConsoleText,
+        X: x,
+        O: o,
+        In: strings.NewReader(input),
+        Out: &out,
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+    return out.String()
+}
+
+func TestConsoleHumans(t *testing.T) {
+    gs := GameState{Width: 3, Height: 3, WinLength: 3}
+    // X takes column a; O answers on column b and once tries a taken cell.
+    out := runConsole(t, gs, nil, nil, "a1\nzz\na1\nb1\na2\nb2\na3\n0\n")
+
+    if n := strings.Count(out, "Invalid coordinates"); n != 2 {
+        t.Errorf("%d invalid moves reported, want 2:\n%s", n, out)
+    }
+    if !strings.Contains(out, "X wins") || strings.Contains(out, "O wins") {
+        t.Errorf("X did not win:\n%s", out)
+    }
+    if strings.Count(out, "Again? ") != 1 {
+        t.Errorf("the game was not over once:\n%s", out)
+    }
+    if want := "  a  b  c \n1 X  O  . \n2 X  O  . \n3[X] .  . \n"; !strings.HasSuffix(strings.SplitAfter(out, "X wins")[0], want + "X wins") {
+        t.Errorf("final board is not\n%s\ngot\n%s", want, out)
+    }
+}
+
+func TestConsoleEngines(t *testing.T) {
+    gs := GameState{Width: 3, Height: 3, WinLength: 3}
+    out := runConsole(t, gs, HeuristicEngine{}, HeuristicEngine{}, "1\n0\n")
+    if n := strings.Count(out, "Again? "); n != 2 {
+        t.Errorf("%d games were played, want 2:\n%s", n, out)
+    }
+    if !strings.Contains(out, "Engine (X) plays b2") {
+        t.Errorf("X did not open in the centre:\n%s", out)
+    }
+    if strings.Contains(out, "to move") {
+        t.Errorf("engines were asked for input:\n%s", out)
+    }
+}
+
+func TestConsoleEndOfInput(t *testing.T) {
+    gs := GameState{Width: 3, Height: 3, WinLength: 3}
+    out := runConsole(t, gs, nil, HeuristicEngine{}, "b2\n")
+    if !strings.Contains(out, "Engine (O) plays") {
+        t.Errorf("the engine did not answer:\n%s", out)
+    }
+    if err := RunConsoleGameLoop(GameState{Width: 3, Height: 3, WinLength: 4}, ConsoleOptions{In: strings.NewReader(""), Out: &strings.Builder{}}); err == nil {
+        t.Errorf("a board smaller than the line was accepted")
+    }
+}
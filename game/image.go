@@ -0,0 +1,210 @@
+package lib
+
+import (
+    "bytes"
+    "image"
+    "image/color"
+    "image/draw"
+    "image/png"
+    "io"
+    "math"
+    "strconv"
+)
+
+type ImageOptions struct {
+    CellSize int
+    LastMove bool
+    WinLine bool
+    Highlights []Move
+}
+
+var DefaultImageOptions = ImageOptions{
+    CellSize: 48,
+    LastMove: true,
+    WinLine: true,
+}
+
+var (
+    backgroundColor = color.RGBA{0xF5, 0xE6, 0xC8, 0xFF}
+    gridColor       = color.RGBA{0x8A, 0x72, 0x50, 0xFF}
+    labelColor      = color.RGBA{0x5A, 0x48, 0x30, 0xFF}
+    xColor          = color.RGBA{0xD0, 0x30, 0x30, 0xFF}
+    oColor          = color.RGBA{0x20, 0x60, 0xC0, 0xFF}
+    lastMoveColor   = color.RGBA{0xFF, 0xD8, 0x70, 0xFF}
+    highlightColor  = color.RGBA{0x9C, 0xE0, 0x9C, 0xFF}
+    winLineColor    = color.RGBA{0x20, 0xA0, 0x40, 0xC0}
+)
+
+// 3x5 bitmap glyphs for the coordinate labels.
+var glyphs = map[rune][5]string{
+    '0': {"###", "#.#", "#.#", "#.#", "###"},
+    '1': {".#.", "##.", ".#.", ".#.", "###"},
+    '2': {"###", "..#", "###", "#..", "###"},
+    '3': {"###", "..#", ".##", "..#", "###"},
+    '4': {"#.#", "#.#", "###", "..#", "..#"},
+    '5': {"###", "#..", "###", "..#", "###"},
+    '6': {"###", "#..", "###", "#.#", "###"},
+    '7': {"###", "..#", ".#.", ".#.", ".#."},
+    '8': {"###", "#.#", "###", "#.#", "###"},
+    '9': {"###", "#.#", "###", "..#", "###"},
+    'a': {".#.", "#.#", "###", "#.#", "#.#"},
+    'b': {"##.", "#.#", "##.", "#.#", "##."},
+    'c': {".##", "#..", "#..", "#..", ".##"},
+    'd': {"##.", "#.#", "#.#", "#.#", "##."},
+    'e': {"###", "#..", "##.", "#..", "###"},
+    'f': {"###", "#..", "##.", "#..", "#.."},
+    'g': {".##", "#..", "#.#", "#.#", ".##"},
+    'h': {"#.#", "#.#", "###", "#.#", "#.#"},
+    'i': {"###", ".#.", ".#.", ".#.", "###"},
+    'j': {"..#", "..#", "..#", "#.#", ".#."},
+    'k': {"#.#", "#.#", "##.", "#.#", "#.#"},
+    'l': {"#..", "#..", "#..", "#..", "###"},
+    'm': {"#.#", "###", "###", "#.#", "#.#"},
+    'n': {"##.", "#.#", "#.#", "#.#", "#.#"},
+    'o': {".#.", "#.#", "#.#", "#.#", ".#."},
+    'p': {"##.", "#.#", "##.", "#..", "#.."},
+    'q': {".#.", "#.#", "#.#", "##.", ".##"},
+    'r': {"##.", "#.#", "##.", "#.#", "#.#"},
+    's': {".##", "#..", ".#.", "..#", "##."},
+    't': {"###", ".#.", ".#.", ".#.", ".#."},
+    'u': {"#.#", "#.#", "#.#", "#.#", "###"},
+    'v': {"#.#", "#.#", "#.#", "#.#", ".#."},
+    'w': {"#.#", "#.#", "###", "###", "#.#"},
+    'x': {"#.#", "#.#", ".#.", "#.#", "#.#"},
+    'y': {"#.#", "#.#", ".#.", ".#.", ".#."},
+    'z': {"###", "..#", ".#.", "#..", "###"},
+}
+
+func fillRect(img draw.Image, rect image.Rectangle, c color.Color) {
+    draw.Draw(img, rect, image.NewUniform(c), image.Point{}, draw.Over)
+}
+
+func drawText(img draw.Image, x int, y int, scale int, text string, c color.Color) {
+    for _, r := range text {
+        glyph, ok := glyphs[r]
+        if ok {
+            for row := range glyph {
+                for col, pixel := range glyph[row] {
+                    if pixel == '#' {
+                        fillRect(img, image.Rect(x + col * scale, y + row * scale,
+                                                 x + (col + 1) * scale, y + (row + 1) * scale), c)
+                    }
+                }
+            }
+        }
+        x += 4 * scale
+    }
+}
+
+func textWidth(text string, scale int) int {
+    return (4 * len(text) - 1) * scale
+}
+
+func drawDisc(img draw.Image, cx float64, cy float64, radius float64, c color.Color) {
+    for y := int(cy - radius); y <= int(cy + radius) + 1; y++ {
+        for x := int(cx - radius); x <= int(cx + radius) + 1; x++ {
+            dx, dy := float64(x) + 0.5 - cx, float64(y) + 0.5 - cy
+            if dx * dx + dy * dy <= radius * radius {
+                fillRect(img, image.Rect(x, y, x + 1, y + 1), c)
+            }
+        }
+    }
+}
+
+func drawRing(img draw.Image, cx float64, cy float64, outer float64, inner float64, c color.Color) {
+    for y := int(cy - outer); y <= int(cy + outer) + 1; y++ {
+        for x := int(cx - outer); x <= int(cx + outer) + 1; x++ {
+            dx, dy := float64(x) + 0.5 - cx, float64(y) + 0.5 - cy
+            if d := dx * dx + dy * dy; d <= outer * outer && d >= inner * inner {
+                fillRect(img, image.Rect(x, y, x + 1, y + 1), c)
+            }
+        }
+    }
+}
+
+func drawLine(img draw.Image, x0 float64, y0 float64, x1 float64, y1 float64, width float64, c color.Color) {
+    steps := int(math.Hypot(x1 - x0, y1 - y0) / (width / 4)) + 1
+    for s := 0; s <= steps; s++ {
+        t := float64(s) / float64(steps)
+        drawDisc(img, x0 + (x1 - x0) * t, y0 + (y1 - y0) * t, width / 2, c)
+    }
+}
+
+func (gs *GameState) RenderImage(opts ImageOptions) image.Image {
+    cell := opts.CellSize
+    scale := cell / 16
+    if scale < 1 {
+        scale = 1
+    }
+    margin := textWidth(strconv.Itoa(gs.Height), scale) + 4 * scale
+    if margin < 9 * scale {
+        margin = 9 * scale
+    }
+    left, top := margin, margin
+    width := left + gs.Width * cell + scale * 2
+    height := top + gs.Height * cell + scale * 2
+
+    img := image.NewRGBA(image.Rect(0, 0, width, height))
+    fillRect(img, img.Bounds(), backgroundColor)
+    cellRect := func(m Move) image.Rectangle {
+        return image.Rect(left + m.J * cell, top + m.I * cell, left + (m.J + 1) * cell, top + (m.I + 1) * cell)
+    }
+    center := func(m Move) (float64, float64) {
+        return float64(left) + (float64(m.J) + 0.5) * float64(cell), float64(top) + (float64(m.I) + 0.5) * float64(cell)
+    }
+
+    for _, m := range opts.Highlights {
+        fillRect(img, cellRect(m), highlightColor)
+    }
+    if last, ok := gs.LastMove(); ok && opts.LastMove {
+        fillRect(img, cellRect(last), lastMoveColor)
+    }
+
+    for j := 0; j < gs.Width; j++ {
+        label := string(rune('a' + j))
+        drawText(img, left + j * cell + (cell - textWidth(label, scale)) / 2, (top - 5 * scale) / 2, scale, label, labelColor)
+    }
+    for i := 0; i < gs.Height; i++ {
+        label := strconv.Itoa(i + 1)
+        drawText(img, (left - textWidth(label, scale)) / 2, top + i * cell + (cell - 5 * scale) / 2, scale, label, labelColor)
+    }
+    for k := 0; k <= gs.Width; k++ {
+        fillRect(img, image.Rect(left + k * cell - scale / 2, top, left + k * cell + (scale + 1) / 2, top + gs.Height * cell), gridColor)
+    }
+    for k := 0; k <= gs.Height; k++ {
+        fillRect(img, image.Rect(left, top + k * cell - scale / 2, left + gs.Width * cell, top + k * cell + (scale + 1) / 2), gridColor)
+    }
+
+    pen := float64(cell) / 8
+    pad := float64(cell) * 0.25
+    for i := 0; i < gs.Height; i++ {
+        for j := 0; j < gs.Width; j++ {
+            cx, cy := center(Move{I: i, J: j})
+            half := float64(cell) / 2 - pad
+            switch gs.Board[i][j] {
+            case X:
+                drawLine(img, cx - half, cy - half, cx + half, cy + half, pen, xColor)
+                drawLine(img, cx - half, cy + half, cx + half, cy - half, pen, xColor)
+            case O:
+                drawRing(img, cx, cy, half + pen / 2, half - pen / 2, oColor)
+            }
+        }
+    }
+
+    if opts.WinLine && len(gs.WinLine) > 1 {
+        x0, y0 := center(gs.WinLine[0])
+        x1, y1 := center(gs.WinLine[len(gs.WinLine) - 1])
+        drawLine(img, x0, y0, x1, y1, pen * 0.8, winLineColor)
+    }
+    return img
+}
+
+func (gs *GameState) WritePNG(w io.Writer, opts ImageOptions) error {
+    return png.Encode(w, gs.RenderImage(opts))
+}
+
+func (gs *GameState) PNG(opts ImageOptions) ([]byte, error) {
+    var buf bytes.Buffer
+    err := gs.WritePNG(&buf, opts)
+    return buf.Bytes(), err
+}
@@ -0,0 +1,43 @@
+package lib
+
+import (
+    "bytes"
+    "image/color"
+    "image/png"
+    "testing"
+)
+
+func TestPNG(t *testing.T) {
+    gs := position(t, 3, 3, 3, Move{0, 0}, Move{1, 1})
+    data, err := gs.PNG(ImageOptions{CellSize: 48, LastMove: true, Highlights: []Move{{2, 2}}})
+    if err != nil {
+        t.Fatal(err)
+    }
+    img, err := png.Decode(bytes.NewReader(data))
+    if err != nil {
+        t.Fatal(err)
+    }
+    // 48 pixel cells have a 27 pixel margin for the labels and a 6 pixel border.
+    const cell, margin, size = 48, 27, 27 + 3 * 48 + 6
+    if b := img.Bounds(); b.Dx() != size || b.Dy() != size {
+        t.Fatalf("image is %dx%d, want %dx%d", b.Dx(), b.Dy(), size, size)
+    }
+    at := func(i int, j int, dx int, dy int) color.RGBA {
+        r, g, b, a := img.At(margin + j * cell + dx, margin + i * cell + dy).RGBA()
+        return color.RGBA{uint8(r >> 8), uint8(g >> 8), uint8(b >> 8), uint8(a >> 8)}
+    }
+    for _, test := range []struct {
+        name string
+        got, want color.RGBA
+    }{
+        {"X", at(0, 0, cell / 2, cell / 2), xColor},
+        {"the hole of O", at(1, 1, cell / 2, cell / 2), lastMoveColor},
+        {"the last move", at(1, 1, 4, 4), lastMoveColor},
+        {"the highlight", at(2, 2, 4, 4), highlightColor},
+        {"an empty cell", at(0, 2, cell / 2, cell / 2), backgroundColor},
+    } {
+        if test.got != test.want {
+            t.Errorf("%s is %v, want %v", test.name, test.got, test.want)
+        }
+    }
+}
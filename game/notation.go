@@ -0,0 +1,37 @@
+package lib
+
+import (
+    "strconv"
+    "strings"
+    "unicode"
+)
+
+// ParseMove accepts algebraic coordinates ("e5": column letter, row number)
+// or two 1-based numbers ("3 4": row, column).
+func ParseMove(text string) (Move, bool) {
+    text = strings.ToLower(strings.TrimSpace(text))
+    fields := strings.FieldsFunc(text, func(r rune) bool {
+        return unicode.IsSpace(r) || r == ',' || r == ';'
+    })
+
+    switch len(fields) {
+    case 1:
+        runes := []rune(fields[0])
+        if len(runes) < 2 || runes[0] < 'a' || runes[0] > 'z' {
+            return Move{}, false
+        }
+        row, err := strconv.Atoi(string(runes[1:]))
+        if err != nil || row < 1 {
+            return Move{}, false
+        }
+        return Move{I: row - 1, J: int(runes[0] - 'a')}, true
+    case 2:
+        row, errRow := strconv.Atoi(fields[0])
+        col, errCol := strconv.Atoi(fields[1])
+        if errRow != nil || errCol != nil || row < 1 || col < 1 {
+            return Move{}, false
+        }
+        return Move{I: row - 1, J: col - 1}, true
+    }
+    return Move{}, false
+}
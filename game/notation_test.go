@@ -0,0 +1,57 @@
+package lib
+
+import "testing"
+
+func TestParseMove(t *testing.T) {
+    for _, test := range []struct {
+        text string
+        move Move
+        ok bool
+    }{
+        {"e5", Move{I: 4, J: 4}, true},
+        {" A1 ", Move{I: 0, J: 0}, true},
+        {"h15", Move{I: 14, J: 7}, true},
+        {"3 4", Move{I: 2, J: 3}, true},
+        {"3,4", Move{I: 2, J: 3}, true},
+        {"3; 4", Move{I: 2, J: 3}, true},
+        {"a0", Move{}, false},
+        {"0 4", Move{}, false},
+        {"3 0", Move{}, false},
+        {"-1 2", Move{}, false},
+        {"e", Move{}, false},
+        {"5e", Move{}, false},
+        {"e5x", Move{}, false},
+        {"1 2 3", Move{}, false},
+        {"", Move{}, false},
+        {"пять", Move{}, false},
+    } {
+        move, ok := ParseMove(test.text)
+        if ok != test.ok || ok && move != test.move {
+            t.Errorf("ParseMove(%q) = %v, %v, want %v, %v", test.text, move, ok, test.move, test.ok)
+        }
+    }
+}
+
+func TestParseMoveOutsideTheBoard(t *testing.T) {
+    gs := GameState{Width: 8, Height: 8, WinLength: 5}
+    gs.ResetGame()
+    for _, text := range []string{"i1", "a9", "9 1", "1 9"} {
+        move, ok := ParseMove(text)
+        if !ok {
+            t.Errorf("ParseMove(%q) failed", text)
+            continue
+        }
+        if gs.MakeMove(move.I, move.J) {
+            t.Errorf("%s was played outside the 8x8 board", text)
+        }
+    }
+}
+
+func TestMoveString(t *testing.T) {
+    for _, text := range []string{"a1", "e5", "h15"} {
+        move, _ := ParseMove(text)
+        if move.String() != text {
+            t.Errorf("%q is written back as %q", text, move.String())
+        }
+    }
+}
@@ -0,0 +1,43 @@
+package lib
+
+import "testing"
+
+func TestApplyOpening(t *testing.T) {
+    opening, ok := FindOpening("Kagetsu")
+    if !ok {
+        t.Fatal("no Kagetsu")
+    }
+    if _, ok := FindOpening("Nonexistent"); ok {
+        t.Errorf("an unknown opening was found")
+    }
+
+    gs := position(t, 8, 8, 5)
+    if !gs.ApplyOpening(opening) {
+        t.Fatal("Kagetsu does not fit 8x8")
+    }
+    if gs.Board[4][4] != X || gs.Board[3][4] != O || gs.Board[3][5] != X {
+        t.Errorf("Kagetsu is placed as %v", gs.Moves)
+    }
+    if gs.WhoTurn != O || len(gs.Moves) != 3 {
+        t.Errorf("after the opening %s is to move with %d stones", gs.WhoTurn, len(gs.Moves))
+    }
+}
+
+func TestOpeningsFor(t *testing.T) {
+    gs := position(t, 8, 8, 5)
+    if openings := OpeningsFor(&gs); len(openings) != len(Openings) {
+        t.Errorf("%d openings fit 8x8, want all %d", len(openings), len(Openings))
+    }
+    threes := position(t, 8, 8, 3)
+    if openings := OpeningsFor(&threes); openings != nil {
+        t.Errorf("openings for three in a row: %v", openings)
+    }
+    if threes.ApplyOpening(Openings[0]) {
+        t.Errorf("an opening was applied to three in a row")
+    }
+    narrow := GameState{Width: 5, Height: 2, WinLength: 5}
+    narrow.ResetGame()
+    if _, ok := Openings[0].Place(&narrow); ok {
+        t.Errorf("%s was placed on a board two rows high", Openings[0].Name)
+    }
+}
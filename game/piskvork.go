@@ -0,0 +1,354 @@
+package lib
+
+import (
+    "bufio"
+    "fmt"
+    "io"
+    "log"
+    "os/exec"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// Piskvork (Gomocup) engines talk over stdin and stdout in lines. x is the
+// column and y the row, both from 0; engines always play five in a row.
+const PiskvorkWinLength = 5
+
+func piskvorkCoords(m Move) string {
+    return fmt.Sprintf("%d,%d", m.J, m.I)
+}
+
+func parsePiskvorkCoords(text string) (Move, []string, bool) {
+    fields := strings.Split(strings.TrimSpace(text), ",")
+    if len(fields) < 2 {
+        return Move{}, nil, false
+    }
+    x, errX := strconv.Atoi(strings.TrimSpace(fields[0]))
+    y, errY := strconv.Atoi(strings.TrimSpace(fields[1]))
+    if errX != nil || errY != nil {
+        return Move{}, nil, false
+    }
+    return Move{I: y, J: x}, fields[2:], true
+}
+
+// PiskvorkEngine runs a Gomocup engine binary as a subprocess and asks it
+// for moves. The engine is started on the first move and kept between
+// moves and games; positions it has not followed are sent with BOARD.
+type PiskvorkEngine struct {
+    Command []string
+    // Timeout is the time the engine gets for a move.
+    Timeout time.Duration
+
+    cmd *exec.Cmd
+    stdin io.WriteCloser
+    lines chan string
+    width, height int
+    // known are the moves of the position the engine has.
+    known []Move
+}
+
+func NewPiskvorkEngine(command []string, timeout time.Duration) *PiskvorkEngine {
+    return &PiskvorkEngine{Command: command, Timeout: timeout}
+}
+
+func (e *PiskvorkEngine) BestMove(gs *GameState) (Move, bool) {
+    m, err := e.Move(gs)
+    if err != nil {
+        log.Println("Piskvork engine", e.Command[0], err)
+        e.Close()
+        return Move{}, false
+    }
+    return m, true
+}
+
+func (e *PiskvorkEngine) start() error {
+    cmd := exec.Command(e.Command[0], e.Command[1:]...)
+    stdin, err := cmd.StdinPipe()
+    if err != nil {
+        return err
+    }
+    stdout, err := cmd.StdoutPipe()
+    if err != nil {
+        return err
+    }
+    if err := cmd.Start(); err != nil {
+        return err
+    }
+    lines := make(chan string)
+    go func() {
+        scanner := bufio.NewScanner(stdout)
+        for scanner.Scan() {
+            lines <- strings.TrimSpace(scanner.Text())
+        }
+        close(lines)
+    }()
+    e.cmd, e.stdin, e.lines = cmd, stdin, lines
+    e.width, e.height, e.known = 0, 0, nil
+    return nil
+}
+
+func (e *PiskvorkEngine) send(format string, args ...interface{}) error {
+    _, err := fmt.Fprintf(e.stdin, format + "\n", args...)
+    return err
+}
+
+// answer waits for the next line that is not a MESSAGE or DEBUG.
+func (e *PiskvorkEngine) answer(timeout time.Duration) (string, error) {
+    deadline := time.After(timeout)
+    for {
+        select {
+        case line, ok := <-e.lines:
+            if !ok {
+                return "", fmt.Errorf("engine exited")
+            }
+            command := strings.ToUpper(strings.Fields(line + " ")[0])
+            switch command {
+            case "MESSAGE", "DEBUG", "SUGGEST", "":
+                continue
+            case "ERROR", "UNKNOWN":
+                return "", fmt.Errorf("engine answered %q", line)
+            }
+            return line, nil
+        case <-deadline:
+            return "", fmt.Errorf("no answer in %v", timeout)
+        }
+    }
+}
+
+func (e *PiskvorkEngine) expectOK() error {
+    line, err := e.answer(e.Timeout)
+    if err == nil && strings.ToUpper(line) != "OK" {
+        err = fmt.Errorf("engine answered %q instead of OK", line)
+    }
+    return err
+}
+
+// sync brings the engine to the position before gs's side moves and asks
+// for the move: BEGIN on an empty board, TURN when only the opponent's last
+// move is new, BOARD otherwise.
+func (e *PiskvorkEngine) sync(gs *GameState) error {
+    if e.width != gs.Width || e.height != gs.Height {
+        var err error
+        if gs.Width == gs.Height {
+            err = e.send("START %d", gs.Width)
+        } else {
+            err = e.send("RECTSTART %d,%d", gs.Width, gs.Height)
+        }
+        if err != nil {
+            return err
+        }
+        if err := e.expectOK(); err != nil {
+            return err
+        }
+        e.width, e.height, e.known = gs.Width, gs.Height, nil
+        if err := e.send("INFO timeout_turn %d", e.Timeout.Milliseconds()); err != nil {
+            return err
+        }
+    }
+
+    moves := gs.Moves
+    followed := len(moves) == len(e.known) + 1
+    for k := 0; followed && k < len(e.known); k++ {
+        followed = moves[k] == e.known[k]
+    }
+    if followed && len(e.known) > 0 {
+        return e.send("TURN %s", piskvorkCoords(moves[len(moves) - 1]))
+    }
+    if len(e.known) > 0 {
+        if err := e.send("RESTART"); err != nil {
+            return err
+        }
+        if err := e.expectOK(); err != nil {
+            return err
+        }
+        e.known = nil
+    }
+    if len(moves) == 0 {
+        return e.send("BEGIN")
+    }
+    if err := e.send("BOARD"); err != nil {
+        return err
+    }
+    for _, m := range moves {
+        who := 1
+        if gs.Board[m.I][m.J] != gs.WhoTurn {
+            who = 2
+        }
+        if err := e.send("%s,%d", piskvorkCoords(m), who); err != nil {
+            return err
+        }
+    }
+    return e.send("DONE")
+}
+
+// Move asks the engine for the move of the side to move in gs.
+func (e *PiskvorkEngine) Move(gs *GameState) (Move, error) {
+    if e.cmd == nil {
+        if err := e.start(); err != nil {
+            return Move{}, err
+        }
+    }
+    if err := e.sync(gs); err != nil {
+        return Move{}, err
+    }
+    line, err := e.answer(e.Timeout + time.Second)
+    if err != nil {
+        return Move{}, err
+    }
+    m, _, ok := parsePiskvorkCoords(line)
+    if !ok || !gs.inside(m.I, m.J) || gs.Board[m.I][m.J] != Empty {
+        return Move{}, fmt.Errorf("engine played %q", line)
+    }
+    e.known = append(append([]Move(nil), gs.Moves...), m)
+    return m, nil
+}
+
+// Close sends END and stops the engine if it does not exit by itself.
+func (e *PiskvorkEngine) Close() error {
+    if e.cmd == nil {
+        return nil
+    }
+    e.send("END")
+    e.stdin.Close()
+    done := make(chan error, 1)
+    go func() { done <- e.cmd.Wait() }()
+    var err error
+    select {
+    case err = <-done:
+    case <-time.After(time.Second):
+        e.cmd.Process.Kill()
+        err = <-done
+    }
+    e.cmd = nil
+    return err
+}
+
+// ServePiskvork lets a Gomocup manager play engine: commands come from in,
+// answers go to out. It returns after END or when in is closed.
+func ServePiskvork(engine Engine, in io.Reader, out io.Writer) error {
+    var gs GameState
+    started := false
+    scanner := bufio.NewScanner(in)
+    reply := func(format string, args ...interface{}) {
+        fmt.Fprintf(out, format + "\n", args...)
+    }
+    play := func() {
+        m, ok := engine.BestMove(&gs)
+        if !ok {
+            reply("ERROR no move")
+            return
+        }
+        gs.MakeMove(m.I, m.J)
+        reply("%s", piskvorkCoords(m))
+    }
+    newGame := func(width int, height int) {
+        if width < PiskvorkWinLength || height < PiskvorkWinLength {
+            reply("ERROR unsupported size %dx%d", width, height)
+            return
+        }
+        gs = GameState{Width: width, Height: height, WinLength: PiskvorkWinLength}
+        gs.ResetGame()
+        started = true
+        reply("OK")
+    }
+
+    for scanner.Scan() {
+        line := strings.TrimSpace(scanner.Text())
+        fields := strings.Fields(line)
+        if len(fields) == 0 {
+            continue
+        }
+        command, argument := strings.ToUpper(fields[0]), strings.TrimSpace(line[len(fields[0]):])
+        if !started && command != "START" && command != "RECTSTART" && command != "ABOUT" && command != "INFO" && command != "END" {
+            reply("ERROR send START first")
+            continue
+        }
+        switch command {
+        case "START":
+            size, err := strconv.Atoi(argument)
+            if err != nil {
+                reply("ERROR bad size %q", argument)
+                continue
+            }
+            newGame(size, size)
+        case "RECTSTART":
+            size, _, ok := parsePiskvorkCoords(argument)
+            if !ok {
+                reply("ERROR bad size %q", argument)
+                continue
+            }
+            newGame(size.J, size.I)
+        case "RESTART":
+            gs.ResetGame()
+            reply("OK")
+        case "BEGIN":
+            play()
+        case "TURN":
+            m, _, ok := parsePiskvorkCoords(argument)
+            if !ok || !gs.MakeMove(m.I, m.J) {
+                reply("ERROR bad move %q", argument)
+                continue
+            }
+            play()
+        case "BOARD":
+            var own, theirs []Move
+            for scanner.Scan() {
+                entry := strings.TrimSpace(scanner.Text())
+                if strings.ToUpper(entry) == "DONE" {
+                    break
+                }
+                m, rest, ok := parsePiskvorkCoords(entry)
+                if !ok || len(rest) == 0 {
+                    continue
+                }
+                if strings.TrimSpace(rest[0]) == "1" {
+                    own = append(own, m)
+                } else {
+                    theirs = append(theirs, m)
+                }
+            }
+            if !gs.setPosition(own, theirs) {
+                reply("ERROR bad position")
+                continue
+            }
+            play()
+        case "TAKEBACK":
+            m, _, ok := parsePiskvorkCoords(argument)
+            last, hasLast := gs.LastMove()
+            if !ok || !hasLast || last != m {
+                reply("ERROR cannot take back %q", argument)
+                continue
+            }
+            gs.Replay(gs.Moves[:len(gs.Moves) - 1])
+            reply("OK")
+        case "INFO":
+        case "ABOUT":
+            reply(`name="tic_tac_toe_bot", version="1.0", country="RU"`)
+        case "END":
+            return nil
+        default:
+            reply("UNKNOWN %s", command)
+        }
+    }
+    return scanner.Err()
+}
+
+// setPosition replays the stones of a BOARD command so that the side of own
+// is to move: own first when both have as many stones, theirs otherwise.
+func (gs *GameState) setPosition(own []Move, theirs []Move) bool {
+    first, second := own, theirs
+    if len(theirs) == len(own) + 1 {
+        first, second = theirs, own
+    } else if len(own) != len(theirs) {
+        return false
+    }
+    var moves []Move
+    for k := range first {
+        moves = append(moves, first[k])
+        if k < len(second) {
+            moves = append(moves, second[k])
+        }
+    }
+    return gs.Replay(moves)
+}
@@ -0,0 +1,117 @@
+package lib
+
+import (
+    "io"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+    "time"
+)
+
+// TestMain lets TestPiskvorkEngine run the test binary as its engine: with
+// TTT_PISKVORK_ENGINE set it serves the protocol on stdin and stdout and
+// copies the commands it gets to TTT_PISKVORK_LOG.
+func TestMain(m *testing.M) {
+    if os.Getenv("TTT_PISKVORK_ENGINE") == "" {
+        os.Exit(m.Run())
+    }
+    commands, err := os.Create(os.Getenv("TTT_PISKVORK_LOG"))
+    if err != nil {
+        os.Exit(2)
+    }
+    err = ServePiskvork(HeuristicEngine{}, io.TeeReader(os.Stdin, commands), os.Stdout)
+    commands.Close()
+    if err != nil {
+        os.Exit(1)
+    }
+    os.Exit(0)
+}
+
+func TestPiskvorkCoords(t *testing.T) {
+    m := Move{I: 3, J: 10}
+    if text := piskvorkCoords(m); text != "10,3" {
+        t.Errorf("%v is sent as %q", m, text)
+    }
+    if parsed, rest, ok := parsePiskvorkCoords(" 10, 3,1 "); !ok || parsed != m || len(rest) != 1 || rest[0] != "1" {
+        t.Errorf("\"10,3,1\" is read as %v %q %v", parsed, rest, ok)
+    }
+    for _, text := range []string{"", "10", "a,3", "10;3"} {
+        if _, _, ok := parsePiskvorkCoords(text); ok {
+            t.Errorf("%q is read as a move", text)
+        }
+    }
+}
+
+func TestSetPosition(t *testing.T) {
+    gs := position(t, 15, 15, 5)
+    if !gs.setPosition([]Move{{8, 8}}, []Move{{7, 7}, {7, 8}}) || gs.WhoTurn != O || gs.Board[7][7] != X || gs.Board[8][8] != O {
+        t.Errorf("with a stone less own stones are O and O is to move: %v", gs.Moves)
+    }
+    if !gs.setPosition([]Move{{1, 1}}, []Move{{2, 2}}) || gs.WhoTurn != X || gs.Board[1][1] != X || gs.Board[2][2] != O {
+        t.Errorf("with as many stones own stones are X and X is to move: %v", gs.Moves)
+    }
+    if gs.setPosition([]Move{{7, 7}, {7, 8}}, []Move{{8, 8}}) || gs.setPosition([]Move{{1, 1}}, []Move{{1, 1}}) {
+        t.Errorf("an impossible position was set")
+    }
+}
+
+func TestServePiskvorkRefusals(t *testing.T) {
+    var out strings.Builder
+    err := ServePiskvork(HeuristicEngine{}, strings.NewReader("BEGIN\nSTART 4\nRECTSTART 5,x\nFOO\nABOUT\n"), &out)
+    if err != nil {
+        t.Fatal(err)
+    }
+    lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+    if len(lines) != 5 {
+        t.Fatalf("answers: %q", lines)
+    }
+    for k, prefix := range []string{"ERROR send START first", "ERROR unsupported size 4x4", "ERROR bad size",
+                                    "ERROR send START first", `name="tic_tac_toe_bot"`} {
+        if !strings.HasPrefix(lines[k], prefix) {
+            t.Errorf("answer %d is %q, want %q", k, lines[k], prefix)
+        }
+    }
+}
+
+func TestPiskvorkEngine(t *testing.T) {
+    log := filepath.Join(t.TempDir(), "commands")
+    t.Setenv("TTT_PISKVORK_ENGINE", "1")
+    t.Setenv("TTT_PISKVORK_LOG", log)
+    // With -race the engine would wait a second before it exits.
+    t.Setenv("GORACE", strings.TrimSpace(os.Getenv("GORACE") + " atexit_sleep_ms=0"))
+    engine := NewPiskvorkEngine([]string{os.Args[0], "-test.run=^$"}, 5 * time.Second)
+
+    gs := position(t, 15, 15, 5)
+    if m, err := engine.Move(&gs); err != nil || m != (Move{I: 7, J: 7}) {
+        t.Fatalf("engine opens with %v: %v", m, err)
+    }
+    gs.MakeMove(7, 7)
+    gs.MakeMove(7, 8)
+    m, err := engine.Move(&gs)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !gs.MakeMove(m.I, m.J) {
+        t.Errorf("engine answered the opponent's move with %v", m)
+    }
+
+    // X has four in a row on top and must finish it.
+    other := position(t, 15, 15, 5, Move{0, 0}, Move{5, 5}, Move{0, 1}, Move{5, 6}, Move{0, 2}, Move{5, 7}, Move{0, 3}, Move{9, 9})
+    if m, err := engine.Move(&other); err != nil || m != (Move{I: 0, J: 4}) {
+        t.Errorf("engine plays %v instead of the win: %v", m, err)
+    }
+    if err := engine.Close(); err != nil {
+        t.Errorf("engine did not exit after END: %v", err)
+    }
+
+    data, err := os.ReadFile(log)
+    if err != nil {
+        t.Fatal(err)
+    }
+    want := []string{"START 15", "INFO timeout_turn 5000", "BEGIN", "TURN 8,7", "RESTART", "BOARD",
+                     "0,0,1", "5,5,2", "1,0,1", "6,5,2", "2,0,1", "7,5,2", "3,0,1", "9,9,2", "DONE", "END"}
+    if commands := strings.Split(strings.TrimSpace(string(data)), "\n"); strings.Join(commands, "|") != strings.Join(want, "|") {
+        t.Errorf("engine got %q, want %q", commands, want)
+    }
+}
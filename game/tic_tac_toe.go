@@ -2,16 +2,67 @@ package lib
 
 import (
     "fmt"
-    "log"
 )
 
-type Cell string
+type Cell uint8
 const (
-    X Cell = "❌"
-    O      = "⭕️"
-    Empty  = "🌫"
+    Empty Cell = iota
+    X
+    O
 )
 
+func (c Cell) String() string {
+    switch c {
+    case X:
+        return "X"
+    case O:
+        return "O"
+    }
+    return "."
+}
+
+func (c Cell) MarshalText() ([]byte, error) {
+    return []byte(c.String()), nil
+}
+
+func (c *Cell) UnmarshalText(text []byte) error {
+    switch string(text) {
+    case "X":
+        *c = X
+    case "O":
+        *c = O
+    case ".":
+        *c = Empty
+    default:
+        return fmt.Errorf("invalid cell %q", text)
+    }
+    return nil
+}
+
+type Renderer interface {
+    Symbol(cell Cell, last bool) string
+}
+
+type Symbols struct {
+    X, O, Empty, XLast, OLast string
+}
+
+func (s Symbols) Symbol(cell Cell, last bool) string {
+    switch {
+    case cell == X && last:
+        return s.XLast
+    case cell == X:
+        return s.X
+    case cell == O && last:
+        return s.OLast
+    case cell == O:
+        return s.O
+    }
+    return s.Empty
+}
+
+var DefaultRenderer = Symbols{X: "❌", O: "⭕️", Empty: "🌫", XLast: "❎", OLast: "🟢"}
+
 type State string
 const (
     Start State     = "Start"
@@ -19,6 +70,14 @@ const (
     End             = "End"
 )
 
+type Move struct {
+    I, J int
+}
+
+func (m Move) String() string {
+    return fmt.Sprintf("%c%d", 'a' + m.J, m.I + 1)
+}
+
 type GameState struct {
     Board [][]Cell
     Width int
@@ -29,6 +88,8 @@ type GameState struct {
     WhoTurn Cell
     IsGameEnded bool
     WhoWin Cell
+    Moves []Move
+    WinLine []Move `json:",omitempty"`
 }
 
 func (gs *GameState) CheckEnd() {
@@ -44,7 +105,20 @@ func (gs *GameState) CheckEnd() {
                     diag2 = diag2 && i - k >= 0 && j + k < gs.Width && gs.Board[i - k][j + k] == whoThis
                 }
                 if row || col || diag1 || diag2 {
-                    log.Println("Kek", row, col, diag1, diag2)
+                    di, dj := 1, 0
+                    switch {
+                    case row:
+                    case col:
+                        di, dj = 0, 1
+                    case diag1:
+                        di, dj = 1, 1
+                    case diag2:
+                        di, dj = -1, 1
+                    }
+                    gs.WinLine = make([]Move, gs.WinLength)
+                    for k := range gs.WinLine {
+                        gs.WinLine[k] = Move{I: i + k * di, J: j + k * dj}
+                    }
                     gs.IsGameEnded = true
                     gs.WhoWin = whoThis
                     return
@@ -66,6 +140,7 @@ func (gs *GameState) MakeMove(i int, j int) bool {
         return false
     }
     gs.Board[i][j] = gs.WhoTurn
+    gs.Moves = append(gs.Moves, Move{I: i, J: j})
     gs.CheckEnd()
     if gs.WhoTurn == X {
         gs.WhoTurn = O
@@ -85,6 +160,19 @@ func (gs *GameState) ResetGame() bool {
     }
     gs.WhoTurn = X
     gs.IsGameEnded = false
+    gs.WhoWin = Empty
+    gs.Moves = nil
+    gs.WinLine = nil
+    return true
+}
+
+func (gs *GameState) Replay(moves []Move) bool {
+    gs.ResetGame()
+    for _, move := range moves {
+        if !gs.MakeMove(move.I, move.J) {
+            return false
+        }
+    }
     return true
 }
 
@@ -92,70 +180,22 @@ func (gs *GameState) ValidateParams() bool {
     return gs.Width >= gs.WinLength && gs.Height >= gs.WinLength
 }
 
-func (gs *GameState) ShowBoardToString() string {
+func (gs *GameState) LastMove() (Move, bool) {
+    if len(gs.Moves) == 0 {
+        return Move{}, false
+    }
+    return gs.Moves[len(gs.Moves) - 1], true
+}
+
+func (gs *GameState) ShowBoardToString(r Renderer) string {
+    last, hasLast := gs.LastMove()
     result := ""
     for i := 0; i < gs.Height; i++ {
         for j := 0; j < gs.Width; j++ {
-            result += string(gs.Board[i][j])
+            result += r.Symbol(gs.Board[i][j], hasLast && last.I == i && last.J == j)
         }
         result += "\n"
     }
     result += "\n"
     return result
 }
-
-func (gs *GameState) ShowBoardOnConsole() bool {
-    log.Println("Show on console")
-    fmt.Printf(gs.ShowBoardToString())
-    return true
-}
-
-func ReadMoveFromConsole() (int, int, bool) {
-    var i, j int
-    _, err := fmt.Scanf("%d %d", &i, &j)
-    if err != nil {
-        return -1, -1, false
-    }
-    return i, j, true
-}
-
-func RunConsoleGameLoop(gs GameState) {
-    if ok := gs.ValidateParams(); !ok {
-        log.Fatal("Invalid params")
-        return
-    }
-    for i := 1; i != 0; {
-        gs.ResetGame()
-        log.Println(gs)
-        for gs.IsGameEnded {
-            x, y, okRead := ReadMoveFromConsole()
-            okSet := gs.MakeMove(x, y)
-            if !okRead || !okSet {
-                fmt.Printf("Неправильные координаты %s %s\n", okRead, okSet)
-                continue
-            }
-            gs.ShowBoardOnConsole()
-        }
-
-        switch gs.WhoWin {
-        case Empty:
-            fmt.Printf("Ничья\n")
-        case X:
-            fmt.Printf("Победили крестики\n")
-        case O:
-            fmt.Printf("Победили нолики\n")
-        }
-
-        fmt.Printf("Введите 1 чтобы сыграть еще раз или 0 для выхода ")
-        fmt.Scanf("%d", &i)
-    }
-}
-
-func Main() {
-    gs := GameState{
-        Width: 3,
-        Height: 3,
-        WinLength: 3,
-    }
-    RunConsoleGameLoop(gs)
-}
@@ -0,0 +1,77 @@
+package main
+
+import (
+    game "./game"
+    i18n "./i18n"
+)
+
+// hintSymbol marks the suggested cell; it is not used by any theme.
+const hintSymbol = "💡"
+
+// hintReason explains the suggested move m by the threats it makes or
+// stops. Threes are not worth a word when three in a row wins outright.
+func hintReason(gs *game.GameState, m game.Move) i18n.MessageID {
+    own := gs.ThreatsAt(m, gs.WhoTurn)
+    theirs := gs.ThreatsAt(m, opponentCell(gs.WhoTurn))
+    threes := gs.WinLength > 3
+    switch {
+    case own.Win:
+        return i18n.HintWin
+    case theirs.Win:
+        return i18n.HintBlockWin
+    case own.Unstoppable():
+        return i18n.HintOpenFour
+    case threes && own.DoubleThree():
+        return i18n.HintDoubleThree
+    case theirs.Unstoppable():
+        return i18n.HintBlockOpenFour
+    case threes && theirs.DoubleThree():
+        return i18n.HintBlockDoubleThree
+    }
+    return i18n.HintDevelop
+}
+
+// hintSelector copies the board keyboard with the suggested cell marked;
+// pressing it plays the move as usual.
+func hintSelector(selector Keyboard, m game.Move) Keyboard {
+    hinted := make(Keyboard, len(selector))
+    for i, row := range selector {
+        hinted[i] = append([]Button(nil), row...)
+    }
+    hinted[m.I][m.J].Text = hintSymbol
+    return hinted
+}
+
+// hintsAllowed tells whether the game of userState takes hints. Every
+// opponent is a person for now, so only features.hint_pvp allows them.
+func (botStorage *TicTacToeBotStorage) hintsAllowed(userState *UserState) bool {
+    return botStorage.config.Features.HintPvP
+}
+
+func registerHintHandlers(router *Router, botStorage *TicTacToeBotStorage) {
+    router.Command("/hint", func(input *Input) error {
+        userState := botStorage.RegisterUser(input)
+        lang := userState.Lang()
+        if userState.State != InGame {
+            return SendEditable(botStorage, &userState, NewMessage, MessageNotEditable, i18n.T(lang, i18n.NotInGameForHint))
+        }
+        if !botStorage.hintsAllowed(&userState) {
+            // The refusal takes the buttons off the board, so it is sent
+            // again under it.
+            if err := SendEditable(botStorage, &userState, NewMessage, MessageNotEditable, i18n.T(lang, i18n.HintsOffAgainstPeople)); err != nil {
+                return err
+            }
+            return sendTurnPrompt(botStorage, &userState)
+        }
+        if !userState.CanMeMakeMove() {
+            return SendEditable(botStorage, &userState, NewMessage, MessageNotEditable, i18n.T(lang, i18n.NotYourTurn))
+        }
+        gs := userState.GameState
+        move, ok := game.HeuristicEngine{}.BestMove(&gs)
+        if !ok {
+            return nil
+        }
+        text := i18n.T(lang, i18n.YourTurn) + "\n" + i18n.T(lang, i18n.HintMove, move, i18n.T(lang, hintReason(&gs, move)))
+        return SendEditable(botStorage, &userState, NewMessage, MessageEditable, text, hintSelector(userState.Selector, move))
+    })
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+    "testing"
+
+    i18n "./i18n"
+)
+
+func TestHintRefusedAgainstPeople(t *testing.T) {
+    botStorage, transport := newTestBot(t, DefaultConfig().Rules)
+    router := NewRouter()
+    registerHintHandlers(router, botStorage)
+    startTestGame(t, botStorage, transport)
+
+    hint := testInput(testX)
+    hint.Text = "/hint"
+    if err := router.Dispatch(hint); err != nil {
+        t.Fatal(err)
+    }
+    expectCall(t, transport, testX, "send", english(i18n.HintsOffAgainstPeople))
+    if board := expectCall(t, transport, testX, "send", english(i18n.YourTurn)); len(board.Keyboard) == 0 {
+        t.Errorf("the board is gone after the refusal")
+    }
+    for _, call := range transport.to(testX, "send") {
+        for _, row := range call.Keyboard {
+            for _, button := range row {
+                if button.Text == hintSymbol {
+                    t.Fatalf("a hint was given: %q", call.Text)
+                }
+            }
+        }
+    }
+
+    botStorage.config.Features.HintPvP = true
+    transport.reset()
+    if err := router.Dispatch(hint); err != nil {
+        t.Fatal(err)
+    }
+    if calls := transport.to(testX, "send"); len(calls) != 1 || calls[0].Text == english(i18n.HintsOffAgainstPeople) {
+        t.Errorf("no hint with features.hint_pvp: %+v", calls)
+    }
+}
@@ -0,0 +1,131 @@
+package i18n
+
+import (
+    "fmt"
+    "strings"
+)
+
+type Lang string
+const (
+    Russian Lang = "ru"
+    English      = "en"
+    Default      = Russian
+)
+
+var Supported = []Lang{Russian, English}
+
+type MessageID string
+
+type PluralForm int
+const (
+    One PluralForm = iota
+    Few
+    Many
+)
+
+// Message holds a translation; plural messages fill Forms indexed by
+// PluralForm, the rest only Text.
+type Message struct {
+    Text string
+    Forms []string
+}
+
+var catalogue = map[Lang]map[MessageID]Message{
+    Russian: russian,
+    English: english,
+}
+
+var pluralRules = map[Lang]func(n int) PluralForm{
+    Russian: func(n int) PluralForm {
+        switch {
+        case n % 10 == 1 && n % 100 != 11:
+            return One
+        case n % 10 >= 2 && n % 10 <= 4 && (n % 100 < 10 || n % 100 >= 20):
+            return Few
+        }
+        return Many
+    },
+    English: func(n int) PluralForm {
+        if n == 1 {
+            return One
+        }
+        return Many
+    },
+}
+
+func IsSupported(lang Lang) bool {
+    _, ok := catalogue[lang]
+    return ok
+}
+
+// FromLanguageCode is Russian for a Russian locale and English for any
+// other, English being the one more people read.
+func FromLanguageCode(code string) Lang {
+    code = strings.ToLower(code)
+    if i := strings.IndexAny(code, "-_."); i >= 0 {
+        code = code[:i]
+    }
+    if Lang(code) == Russian {
+        return Russian
+    }
+    return English
+}
+
+func lookup(lang Lang, id MessageID) Message {
+    if msg, ok := catalogue[lang][id]; ok {
+        return msg
+    }
+    if msg, ok := catalogue[Default][id]; ok {
+        return msg
+    }
+    return Message{Text: string(id)}
+}
+
+func T(lang Lang, id MessageID, args ...interface{}) string {
+    text := lookup(lang, id).Text
+    if len(args) == 0 {
+        return text
+    }
+    return fmt.Sprintf(text, args...)
+}
+
+func N(lang Lang, id MessageID, n int, args ...interface{}) string {
+    msg := lookup(lang, id)
+    text := msg.Text
+    if len(msg.Forms) != 0 {
+        rule, ok := pluralRules[lang]
+        if !ok {
+            rule = pluralRules[Default]
+        }
+        form := rule(n)
+        if int(form) >= len(msg.Forms) {
+            form = PluralForm(len(msg.Forms) - 1)
+        }
+        text = msg.Forms[form]
+    }
+    return fmt.Sprintf(text, append([]interface{}{n}, args...)...)
+}
+
+// Text is a message whose language is chosen later, when the recipient
+// is known.
+type Text struct {
+    id MessageID
+    plural bool
+    n int
+    args []interface{}
+}
+
+func Msg(id MessageID, args ...interface{}) Text {
+    return Text{id: id, args: args}
+}
+
+func Plural(id MessageID, n int, args ...interface{}) Text {
+    return Text{id: id, plural: true, n: n, args: args}
+}
+
+func (t Text) In(lang Lang) string {
+    if t.plural {
+        return N(lang, t.id, t.n, t.args...)
+    }
+    return T(lang, t.id, t.args...)
+}
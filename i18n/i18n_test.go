@@ -0,0 +1,19 @@
+package i18n
+
+import "testing"
+
+func TestFromLanguageCode(t *testing.T) {
+    for code, want := range map[string]Lang{
+        "ru": Russian,
+        "ru-RU": Russian,
+        "en": English,
+        "en_GB.UTF-8": English,
+        "uk": English,
+        "de": English,
+        "": English,
+    } {
+        if got := FromLanguageCode(code); got != want {
+            t.Errorf("FromLanguageCode(%q) = %s, want %s", code, got, want)
+        }
+    }
+}
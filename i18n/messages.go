@@ -0,0 +1,372 @@
+package i18n
+
+const (
+    Hello MessageID            = "Hello"
+    Bye                        = "Bye"
+    Yes                        = "Yes"
+    No                         = "No"
+    Help                       = "Help"
+    HelpLanguage               = "HelpLanguage"
+    HelpTheme                  = "HelpTheme"
+    HelpReplay                 = "HelpReplay"
+    HelpHint                   = "HelpHint"
+    HelpPuzzle                 = "HelpPuzzle"
+    HelpDaily                  = "HelpDaily"
+    HelpTextMoves              = "HelpTextMoves"
+    SearchingOpponent          = "SearchingOpponent"
+    OpponentFound              = "OpponentFound"
+    YourTurn                   = "YourTurn"
+    WaitingOpponentMove        = "WaitingOpponentMove"
+    NotYourTurn                = "NotYourTurn"
+    InvalidMove                = "InvalidMove"
+    YouWon                     = "YouWon"
+    YouLost                    = "YouLost"
+    Draw                       = "Draw"
+    YouResigned                = "YouResigned"
+    OpponentResigned           = "OpponentResigned"
+    NotInGameToResign          = "NotInGameToResign"
+    Stats                      = "Stats"
+    NewGameQuestion            = "NewGameQuestion"
+    RestartResumed             = "RestartResumed"
+    RestartGameLost            = "RestartGameLost"
+    ChooseLanguage             = "ChooseLanguage"
+    LanguageAuto               = "LanguageAuto"
+    LanguageChanged            = "LanguageChanged"
+    LanguageName               = "LanguageName"
+    ChooseTheme                = "ChooseTheme"
+    ThemeCustom                = "ThemeCustom"
+    ThemeCustomPrompt          = "ThemeCustomPrompt"
+    ThemeInvalid               = "ThemeInvalid"
+    Cancelled                  = "Cancelled"
+    ThemeChanged               = "ThemeChanged"
+    ThemeClassic               = "ThemeClassic"
+    ThemeHearts                = "ThemeHearts"
+    ThemeAnimals               = "ThemeAnimals"
+    ThemeFruits                = "ThemeFruits"
+    ThemeSpace                 = "ThemeSpace"
+    ReplayCaption              = "ReplayCaption"
+    NoGamesToReplay            = "NoGamesToReplay"
+    NotYourGame                = "NotYourGame"
+    AnalysisClean              = "AnalysisClean"
+    AnalysisMistakes           = "AnalysisMistakes"
+    AnalysisMove               = "AnalysisMove"
+    AnalysisBestMove           = "AnalysisBestMove"
+    AnalysisMissedWin          = "AnalysisMissedWin"
+    AnalysisAllowedWin         = "AnalysisAllowedWin"
+    MoveNotUnderstood          = "MoveNotUnderstood"
+    NotInGameForHint           = "NotInGameForHint"
+    HintsOffAgainstPeople      = "HintsOffAgainstPeople"
+    HintMove                   = "HintMove"
+    HintWin                    = "HintWin"
+    HintBlockWin               = "HintBlockWin"
+    HintOpenFour               = "HintOpenFour"
+    HintDoubleThree            = "HintDoubleThree"
+    HintBlockOpenFour          = "HintBlockOpenFour"
+    HintBlockDoubleThree       = "HintBlockDoubleThree"
+    HintDevelop                = "HintDevelop"
+    PuzzleIntro                = "PuzzleIntro"
+    PuzzleReply                = "PuzzleReply"
+    PuzzleSolved               = "PuzzleSolved"
+    PuzzleFailed               = "PuzzleFailed"
+    PuzzleInGame               = "PuzzleInGame"
+    NoPuzzles                  = "NoPuzzles"
+    NextPuzzle                 = "NextPuzzle"
+    DailyIntro                 = "DailyIntro"
+    DailyFailed                = "DailyFailed"
+    DailySolved                = "DailySolved"
+    DailyAlreadySolved         = "DailyAlreadySolved"
+    DailyLeaderboard           = "DailyLeaderboard"
+    DailyNobody                = "DailyNobody"
+    DailyEntry                 = "DailyEntry"
+    DailyPlay                  = "DailyPlay"
+    DailyPublished             = "DailyPublished"
+    DailySubscribed            = "DailySubscribed"
+    DailyUnsubscribed          = "DailyUnsubscribed"
+    DailyUsage                 = "DailyUsage"
+    OpeningName                = "OpeningName"
+
+    CommandStart               = "CommandStart"
+    CommandResign              = "CommandResign"
+    CommandHelp                = "CommandHelp"
+    CommandMove                = "CommandMove"
+    CommandMoveCell            = "CommandMoveCell"
+    CommandLanguage            = "CommandLanguage"
+    CommandTheme               = "CommandTheme"
+    CommandReplay              = "CommandReplay"
+    CommandHint                = "CommandHint"
+    CommandPuzzle              = "CommandPuzzle"
+    CommandDaily               = "CommandDaily"
+    CommandArgument            = "CommandArgument"
+
+    ConsoleInvalidCoordinates  = "ConsoleInvalidCoordinates"
+    ConsoleDraw                = "ConsoleDraw"
+    ConsoleXWon                = "ConsoleXWon"
+    ConsoleOWon                = "ConsoleOWon"
+    ConsolePlayAgain           = "ConsolePlayAgain"
+    ConsoleMovePrompt          = "ConsoleMovePrompt"
+    ConsoleEngineMove          = "ConsoleEngineMove"
+)
+
+var russian = map[MessageID]Message{
+    Hello:              {Text: "Привет! Хочешь сыграть в крестики нолики?"},
+    Bye:                {Text: "Окей, тогда до связи!"},
+    Yes:                {Text: "Да"},
+    No:                 {Text: "Нет"},
+    Help:               {Text: "/help - помощь\n" +
+                               "/resign - сдаться в текущей игре\n" +
+                               "/start - начать общение с ботом"},
+    HelpLanguage:       {Text: "/language - выбрать язык"},
+    HelpTheme:          {Text: "/theme - выбрать оформление доски"},
+    HelpReplay:         {Text: "/replay - посмотреть последнюю партию"},
+    HelpHint:           {Text: "/hint - подсказать ход"},
+    HelpPuzzle:         {Text: "/puzzle - решить задачу «выигрыш в N ходов»"},
+    HelpDaily:          {Text: "/daily - задача дня (on/off - подписка, top - таблица лидеров)"},
+    HelpTextMoves:      {Text: "Во время игры можно писать ход текстом: e5 или 3 4"},
+    SearchingOpponent:  {Text: "Ищу соперника..."},
+    OpponentFound:      {Text: "Соперник найден. Начинаем игру!"},
+    YourTurn:           {Text: "Ваш ход"},
+    WaitingOpponentMove: {Text: "Ожидаем ход соперника"},
+    NotYourTurn:        {Text: "Сейчас не твой ход"},
+    InvalidMove:        {Text: "Некорректный ход"},
+    YouWon:             {Forms: []string{
+                            "Вы выиграли за %d ход!",
+                            "Вы выиграли за %d хода!",
+                            "Вы выиграли за %d ходов!",
+                        }},
+    YouLost:            {Text: "Вы проиграли!"},
+    Draw:               {Text: "Ничья!"},
+    YouResigned:        {Text: "Вы сдались."},
+    OpponentResigned:   {Text: "Соперник сдался."},
+    NotInGameToResign:  {Text: "Вы не в игре, для того чтобы сдаться."},
+    Stats:              {Text: "Пользователей: %d, играют: %d, ищут соперника: %d."},
+    NewGameQuestion:    {Text: "Хотите начать новую игру?"},
+    RestartResumed:     {Text: "Бот был перезапущен, продолжаем игру."},
+    RestartGameLost:    {Text: "Бот был перезапущен, и игру не удалось восстановить."},
+    ChooseLanguage:     {Text: "Выберите язык:"},
+    LanguageAuto:       {Text: "Как в Telegram"},
+    LanguageChanged:    {Text: "Язык переключён: %s"},
+    LanguageName:       {Text: "Русский"},
+    ChooseTheme:        {Text: "Выберите оформление:"},
+    ThemeCustom:        {Text: "Своё"},
+    ThemeCustomPrompt:  {Text: "Пришлите пять эмодзи через пробел: крестик, нолик, пустая клетка, " +
+                               "последний крестик, последний нолик. Например: ❌ 🔴 🌫 ❎ 🟢\n/cancel - передумать"},
+    ThemeInvalid:       {Text: "Нужно пять разных эмодзи, по одному символу на клетку. Нажмите /theme, чтобы попробовать ещё раз."},
+    Cancelled:          {Text: "Отменено."},
+    ThemeChanged:       {Text: "Оформление изменено: %s"},
+    ThemeClassic:       {Text: "Классика"},
+    ThemeHearts:        {Text: "Сердечки"},
+    ThemeAnimals:       {Text: "Кошки-собаки"},
+    ThemeFruits:        {Text: "Фрукты"},
+    ThemeSpace:         {Text: "Космос"},
+    ReplayCaption:      {Text: "Партия #%d, ход %d из %d"},
+    NoGamesToReplay:    {Text: "Вы ещё не сыграли ни одной партии."},
+    NotYourGame:        {Text: "Среди ваших партий нет #%d."},
+    AnalysisClean:      {Text: "Форсированный выигрыш никто не упустил и не отдал."},
+    AnalysisMistakes:   {Text: "Ошибки: %s"},
+    AnalysisMove:       {Text: "%s %s: %d%% от лучшего хода движка (%s)"},
+    AnalysisBestMove:   {Text: "%s %s: лучший ход движка"},
+    AnalysisMissedWin:  {Text: "⚠ Упущен форсированный выигрыш."},
+    AnalysisAllowedWin: {Text: "⚠ Соперник получил форсированный выигрыш."},
+    MoveNotUnderstood:  {Text: "Не понял ход. Нажмите на клетку или напишите координаты, например e5 или 3 4 (строка, столбец)."},
+    NotInGameForHint:   {Text: "Подсказки доступны только во время игры."},
+    HintsOffAgainstPeople: {Text: "В играх с другими игроками подсказки отключены."},
+    HintMove:           {Text: "💡 Подсказка: %s. %s"},
+    HintWin:            {Text: "Этот ход выигрывает."},
+    HintBlockWin:       {Text: "Иначе соперник выиграет следующим ходом."},
+    HintOpenFour:       {Text: "Получается открытая четвёрка: соперник закроет только один конец."},
+    HintDoubleThree:    {Text: "Получается вилка из двух открытых троек."},
+    HintBlockOpenFour:  {Text: "Не даёт сопернику построить открытую четвёрку."},
+    HintBlockDoubleThree: {Text: "Не даёт сопернику построить вилку из двух троек."},
+    HintDevelop:        {Text: "Явных угроз нет, эта клетка лучше всего усиливает позицию."},
+    PuzzleIntro:        {Forms: []string{
+                            "🧩 Выиграйте за %d ход, играя за %s (задача %s, рейтинг %d).",
+                            "🧩 Выиграйте за %d хода, играя за %s (задача %s, рейтинг %d).",
+                            "🧩 Выиграйте за %d ходов, играя за %s (задача %s, рейтинг %d).",
+                        }},
+    PuzzleReply:        {Text: "Соперник отвечает %s."},
+    PuzzleSolved:       {Text: "✅ Решено! Рейтинг в задачах: %d (%+d)."},
+    PuzzleFailed:       {Text: "❌ Не вышло. Решение: %s. Рейтинг в задачах: %d (%+d)."},
+    PuzzleInGame:       {Text: "Сначала доиграйте или сдайте текущую партию."},
+    NoPuzzles:          {Text: "Задач пока нет."},
+    NextPuzzle:         {Text: "🧩 Следующая задача"},
+    DailyIntro:         {Text: "📅 Задача дня %s, попытка %d."},
+    DailyFailed:        {Text: "❌ Не вышло (попытка %d). Попробуйте ещё раз — время идёт."},
+    DailySolved:        {Forms: []string{
+                            "✅ Решено с %d попытки, время %s!",
+                            "✅ Решено с %d попыток, время %s!",
+                            "✅ Решено с %d попыток, время %s!",
+                        }},
+    DailyAlreadySolved: {Text: "Вы уже решили сегодняшнюю задачу."},
+    DailyLeaderboard:   {Text: "🏆 Таблица лидеров за %s:"},
+    DailyNobody:        {Text: "Пока никто не решил."},
+    DailyEntry:         {Forms: []string{
+                            "%[2]d. %[3]s — %[1]d попытка, %[4]s",
+                            "%[2]d. %[3]s — %[1]d попытки, %[4]s",
+                            "%[2]d. %[3]s — %[1]d попыток, %[4]s",
+                        }},
+    DailyPlay:          {Text: "📅 Решать"},
+    DailyPublished:     {Forms: []string{
+                            "📅 Новая задача дня: выигрыш за %d ход. Чем меньше попыток и быстрее решение, тем выше место в таблице.",
+                            "📅 Новая задача дня: выигрыш за %d хода. Чем меньше попыток и быстрее решение, тем выше место в таблице.",
+                            "📅 Новая задача дня: выигрыш за %d ходов. Чем меньше попыток и быстрее решение, тем выше место в таблице.",
+                        }},
+    DailySubscribed:    {Text: "Задача дня будет приходить каждый день в %s UTC. Отписаться: /daily off."},
+    DailyUnsubscribed:  {Text: "Задача дня больше не будет приходить."},
+    DailyUsage:         {Text: "/daily - решить задачу дня\n" +
+                               "/daily top - таблица лидеров\n" +
+                               "/daily on, /daily off - присылать задачу каждый день или нет"},
+    OpeningName:        {Text: "Дебют: %s."},
+
+    CommandStart:       {Text: "Начать общение с ботом"},
+    CommandResign:      {Text: "Сдаться в текущей игре"},
+    CommandHelp:        {Text: "Помощь"},
+    CommandMove:        {Text: "Сделать ход"},
+    CommandMoveCell:    {Text: "Клетка, например e5 или 3 4"},
+    CommandLanguage:    {Text: "Выбрать язык"},
+    CommandTheme:       {Text: "Выбрать оформление доски"},
+    CommandReplay:      {Text: "Посмотреть последнюю партию"},
+    CommandHint:        {Text: "Подсказать ход"},
+    CommandPuzzle:      {Text: "Решить задачу"},
+    CommandDaily:       {Text: "Задача дня"},
+    CommandArgument:    {Text: "Необязательный параметр"},
+
+    ConsoleInvalidCoordinates: {Text: "Неправильные координаты"},
+    ConsoleDraw:        {Text: "Ничья"},
+    ConsoleXWon:        {Text: "Победили крестики"},
+    ConsoleOWon:        {Text: "Победили нолики"},
+    ConsolePlayAgain:   {Text: "Введите 1 чтобы сыграть еще раз или 0 для выхода "},
+    ConsoleMovePrompt:  {Text: "Ход %s (например e5 или 3 4): "},
+    ConsoleEngineMove:  {Text: "Компьютер (%s) ходит %s"},
+}
+
+var english = map[MessageID]Message{
+    Hello:              {Text: "Hi! Do you want to play tic-tac-toe?"},
+    Bye:                {Text: "Okay, see you later!"},
+    Yes:                {Text: "Yes"},
+    No:                 {Text: "No"},
+    Help:               {Text: "/help - show this help\n" +
+                               "/resign - resign the current game\n" +
+                               "/start - start talking to the bot"},
+    HelpLanguage:       {Text: "/language - choose the language"},
+    HelpTheme:          {Text: "/theme - choose the board style"},
+    HelpReplay:         {Text: "/replay - replay your last game"},
+    HelpHint:           {Text: "/hint - suggest a move"},
+    HelpPuzzle:         {Text: "/puzzle - solve a win-in-N puzzle"},
+    HelpDaily:          {Text: "/daily - the daily challenge (on/off to subscribe, top for the leaderboard)"},
+    HelpTextMoves:      {Text: "During a game you can also type a move: e5 or 3 4"},
+    SearchingOpponent:  {Text: "Looking for an opponent..."},
+    OpponentFound:      {Text: "Opponent found. Let's play!"},
+    YourTurn:           {Text: "Your turn"},
+    WaitingOpponentMove: {Text: "Waiting for the opponent's move"},
+    NotYourTurn:        {Text: "It's not your turn"},
+    InvalidMove:        {Text: "Invalid move"},
+    YouWon:             {Forms: []string{
+                            "You won in %d move!",
+                            "You won in %d moves!",
+                            "You won in %d moves!",
+                        }},
+    YouLost:            {Text: "You lost!"},
+    Draw:               {Text: "Draw!"},
+    YouResigned:        {Text: "You resigned."},
+    OpponentResigned:   {Text: "Your opponent resigned."},
+    NotInGameToResign:  {Text: "You are not in a game to resign from."},
+    Stats:              {Text: "Users: %d, playing: %d, looking for an opponent: %d."},
+    NewGameQuestion:    {Text: "Do you want to start a new game?"},
+    RestartResumed:     {Text: "The bot was restarted, let's continue the game."},
+    RestartGameLost:    {Text: "The bot was restarted and the game could not be restored."},
+    ChooseLanguage:     {Text: "Choose a language:"},
+    LanguageAuto:       {Text: "Same as Telegram"},
+    LanguageChanged:    {Text: "Language switched: %s"},
+    LanguageName:       {Text: "English"},
+    ChooseTheme:        {Text: "Choose a board style:"},
+    ThemeCustom:        {Text: "Custom"},
+    ThemeCustomPrompt:  {Text: "Send five emoji separated by spaces: X, O, empty cell, " +
+                               "last X, last O. For example: ❌ 🔴 🌫 ❎ 🟢\n/cancel - never mind"},
+    ThemeInvalid:       {Text: "Five different emoji are needed, one symbol per cell. Press /theme to try again."},
+    Cancelled:          {Text: "Cancelled."},
+    ThemeChanged:       {Text: "Board style changed: %s"},
+    ThemeClassic:       {Text: "Classic"},
+    ThemeHearts:        {Text: "Hearts"},
+    ThemeAnimals:       {Text: "Cats and dogs"},
+    ThemeFruits:        {Text: "Fruits"},
+    ThemeSpace:         {Text: "Space"},
+    ReplayCaption:      {Text: "Game #%d, move %d of %d"},
+    NoGamesToReplay:    {Text: "You have not played any games yet."},
+    NotYourGame:        {Text: "Game #%d is not one of yours."},
+    AnalysisClean:      {Text: "No forced win was missed or given away."},
+    AnalysisMistakes:   {Text: "Mistakes: %s"},
+    AnalysisMove:       {Text: "%s %s: %d%% of the engine's best move (%s)"},
+    AnalysisBestMove:   {Text: "%s %s: the engine's best move"},
+    AnalysisMissedWin:  {Text: "⚠ Missed a forced win."},
+    AnalysisAllowedWin: {Text: "⚠ Gave the opponent a forced win."},
+    MoveNotUnderstood:  {Text: "I didn't get that move. Tap a cell or type coordinates, e.g. e5 or 3 4 (row, column)."},
+    NotInGameForHint:   {Text: "Hints are only available during a game."},
+    HintsOffAgainstPeople: {Text: "Hints are off in games against other players."},
+    HintMove:           {Text: "💡 Hint: %s. %s"},
+    HintWin:            {Text: "This move wins."},
+    HintBlockWin:       {Text: "Otherwise your opponent wins on the next move."},
+    HintOpenFour:       {Text: "It makes an open four: your opponent can block only one end."},
+    HintDoubleThree:    {Text: "It makes a double three: two open threes at once."},
+    HintBlockOpenFour:  {Text: "It stops your opponent from making an open four."},
+    HintBlockDoubleThree: {Text: "It stops your opponent from making a double three."},
+    HintDevelop:        {Text: "No direct threats; this cell strengthens your position the most."},
+    PuzzleIntro:        {Forms: []string{
+                            "🧩 Win in %d move playing %s (puzzle %s, rating %d).",
+                            "🧩 Win in %d moves playing %s (puzzle %s, rating %d).",
+                            "🧩 Win in %d moves playing %s (puzzle %s, rating %d).",
+                        }},
+    PuzzleReply:        {Text: "Your opponent replies %s."},
+    PuzzleSolved:       {Text: "✅ Solved! Puzzle rating: %d (%+d)."},
+    PuzzleFailed:       {Text: "❌ Not this time. The solution: %s. Puzzle rating: %d (%+d)."},
+    PuzzleInGame:       {Text: "Finish or resign your current game first."},
+    NoPuzzles:          {Text: "There are no puzzles yet."},
+    NextPuzzle:         {Text: "🧩 Next puzzle"},
+    DailyIntro:         {Text: "📅 Daily challenge of %s, attempt %d."},
+    DailyFailed:        {Text: "❌ Not this time (attempt %d). Try again, the clock keeps running."},
+    DailySolved:        {Forms: []string{
+                            "✅ Solved in %d attempt, time %s!",
+                            "✅ Solved in %d attempts, time %s!",
+                            "✅ Solved in %d attempts, time %s!",
+                        }},
+    DailyAlreadySolved: {Text: "You have already solved today's challenge."},
+    DailyLeaderboard:   {Text: "🏆 Leaderboard of %s:"},
+    DailyNobody:        {Text: "Nobody has solved it yet."},
+    DailyEntry:         {Forms: []string{
+                            "%[2]d. %[3]s — %[1]d attempt, %[4]s",
+                            "%[2]d. %[3]s — %[1]d attempts, %[4]s",
+                            "%[2]d. %[3]s — %[1]d attempts, %[4]s",
+                        }},
+    DailyPlay:          {Text: "📅 Solve"},
+    DailyPublished:     {Forms: []string{
+                            "📅 A new daily challenge is out: win in %d move. Fewer attempts and a faster solution put you higher on the leaderboard.",
+                            "📅 A new daily challenge is out: win in %d moves. Fewer attempts and a faster solution put you higher on the leaderboard.",
+                            "📅 A new daily challenge is out: win in %d moves. Fewer attempts and a faster solution put you higher on the leaderboard.",
+                        }},
+    DailySubscribed:    {Text: "You will get the daily challenge every day at %s UTC. /daily off to stop."},
+    DailyUnsubscribed:  {Text: "You will no longer get the daily challenge."},
+    DailyUsage:         {Text: "/daily - solve today's challenge\n" +
+                               "/daily top - show the leaderboard\n" +
+                               "/daily on, /daily off - get the challenge every day or not"},
+    OpeningName:        {Text: "Opening: %s."},
+
+    CommandStart:       {Text: "Start talking to the bot"},
+    CommandResign:      {Text: "Resign the current game"},
+    CommandHelp:        {Text: "Show the help"},
+    CommandMove:        {Text: "Make a move"},
+    CommandMoveCell:    {Text: "Cell, e.g. e5 or 3 4"},
+    CommandLanguage:    {Text: "Choose the language"},
+    CommandTheme:       {Text: "Choose the board style"},
+    CommandReplay:      {Text: "Replay your last game"},
+    CommandHint:        {Text: "Suggest a move"},
+    CommandPuzzle:      {Text: "Solve a puzzle"},
+    CommandDaily:       {Text: "Daily challenge"},
+    CommandArgument:    {Text: "Optional argument"},
+
+    ConsoleInvalidCoordinates: {Text: "Invalid coordinates"},
+    ConsoleDraw:        {Text: "Draw"},
+    ConsoleXWon:        {Text: "X wins"},
+    ConsoleOWon:        {Text: "O wins"},
+    ConsolePlayAgain:   {Text: "Enter 1 to play again or 0 to quit "},
+    ConsoleMovePrompt:  {Text: "%s to move (e.g. e5 or 3 4): "},
+    ConsoleEngineMove:  {Text: "Computer (%s) plays %s"},
+}
@@ -0,0 +1,376 @@
+// Package fakeapi is an in-process stand-in for the Telegram Bot API. It
+// implements the handful of methods the bot uses, keeps every chat's
+// messages in memory and lets a script play users by queueing updates.
+package fakeapi
+
+import (
+    "encoding/json"
+    "fmt"
+    "io"
+    "log"
+    "net"
+    "net/http"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+)
+
+type User struct {
+    ID int64 `json:"id"`
+    FirstName string `json:"first_name"`
+    LanguageCode string `json:"language_code,omitempty"`
+}
+
+type Button struct {
+    Text string `json:"text"`
+    Data string `json:"callback_data,omitempty"`
+}
+
+type Message struct {
+    ID int
+    ChatID int64
+    Text string
+    Photo bool
+    Keyboard [][]Button
+    Deleted bool
+    // Seq grows with every change to any message, so a script can wait for
+    // changes made after a given point.
+    Seq int
+}
+
+func (m Message) Button(text string) (Button, bool) {
+    for _, row := range m.Keyboard {
+        for _, button := range row {
+            if button.Text == text {
+                return button, true
+            }
+        }
+    }
+    return Button{}, false
+}
+
+type Server struct {
+    URL string
+    Token string
+
+    mutex sync.Mutex
+    changed chan struct{}
+    seq int
+    updates []map[string]interface{}
+    nextUpdate int
+    nextMessage int
+    nextCallback int
+    messages map[int64][]*Message
+    listener net.Listener
+    server *http.Server
+}
+
+func NewServer(token string) (*Server, error) {
+    listener, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil {
+        return nil, err
+    }
+    s := &Server{
+        URL: "http://" + listener.Addr().String(),
+        Token: token,
+        changed: make(chan struct{}),
+        nextUpdate: 1,
+        messages: make(map[int64][]*Message),
+        listener: listener,
+    }
+    s.server = &http.Server{Handler: s}
+    go s.server.Serve(listener)
+    return s, nil
+}
+
+func (s *Server) Close() error {
+    return s.server.Close()
+}
+
+// notify must be called with the mutex held.
+func (s *Server) notify() {
+    close(s.changed)
+    s.changed = make(chan struct{})
+}
+
+func (s *Server) Seq() int {
+    s.mutex.Lock()
+    defer s.mutex.Unlock()
+    return s.seq
+}
+
+func (s *Server) Messages(chatID int64) []Message {
+    s.mutex.Lock()
+    defer s.mutex.Unlock()
+    var result []Message
+    for _, m := range s.messages[chatID] {
+        result = append(result, *m)
+    }
+    return result
+}
+
+// WaitFor returns the newest live message of the chat changed after seq that
+// satisfies match.
+func (s *Server) WaitFor(chatID int64, seq int, timeout time.Duration, match func(Message) bool) (Message, error) {
+    deadline := time.After(timeout)
+    for {
+        s.mutex.Lock()
+        changed := s.changed
+        messages := s.messages[chatID]
+        for k := len(messages) - 1; k >= 0; k-- {
+            if m := *messages[k]; !m.Deleted && m.Seq > seq && match(m) {
+                s.mutex.Unlock()
+                return m, nil
+            }
+        }
+        s.mutex.Unlock()
+
+        select {
+        case <-changed:
+        case <-deadline:
+            return Message{}, fmt.Errorf("chat %d: no matching message after %v", chatID, timeout)
+        }
+    }
+}
+
+func (s *Server) push(update map[string]interface{}) {
+    s.mutex.Lock()
+    defer s.mutex.Unlock()
+    update["update_id"] = s.nextUpdate
+    s.nextUpdate++
+    s.updates = append(s.updates, update)
+    s.notify()
+}
+
+func chat(user User) map[string]interface{} {
+    return map[string]interface{}{"id": user.ID, "type": "private", "first_name": user.FirstName}
+}
+
+func (s *Server) SendText(user User, text string) {
+    s.mutex.Lock()
+    s.nextMessage++
+    id := s.nextMessage
+    s.mutex.Unlock()
+    s.push(map[string]interface{}{
+        "message": map[string]interface{}{
+            "message_id": id,
+            "from": user,
+            "chat": chat(user),
+            "date": time.Now().Unix(),
+            "text": text,
+        },
+    })
+}
+
+func (s *Server) Press(user User, message Message, data string) {
+    s.mutex.Lock()
+    s.nextCallback++
+    id := s.nextCallback
+    s.mutex.Unlock()
+    s.push(map[string]interface{}{
+        "callback_query": map[string]interface{}{
+            "id": strconv.Itoa(id),
+            "from": user,
+            "message": map[string]interface{}{
+                "message_id": message.ID,
+                "chat": chat(user),
+                "date": time.Now().Unix(),
+                "text": message.Text,
+            },
+            "chat_instance": strconv.FormatInt(user.ID, 10),
+            "data": data,
+        },
+    })
+}
+
+func readParams(r *http.Request) (map[string]string, error) {
+    params := make(map[string]string)
+    if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/") {
+        if err := r.ParseMultipartForm(32 << 20); err != nil {
+            return nil, err
+        }
+        for key, values := range r.MultipartForm.Value {
+            params[key] = values[0]
+        }
+        for key := range r.MultipartForm.File {
+            params[key] = "attach://" + key
+        }
+        return params, nil
+    }
+
+    body, err := io.ReadAll(r.Body)
+    if err != nil || len(strings.TrimSpace(string(body))) == 0 {
+        return params, err
+    }
+    var raw map[string]json.RawMessage
+    if err := json.Unmarshal(body, &raw); err != nil {
+        return nil, err
+    }
+    for key, value := range raw {
+        var text string
+        if json.Unmarshal(value, &text) != nil {
+            text = string(value)
+        }
+        params[key] = text
+    }
+    return params, nil
+}
+
+func parseKeyboard(markup string) [][]Button {
+    var parsed struct {
+        InlineKeyboard [][]Button `json:"inline_keyboard"`
+    }
+    if markup == "" || json.Unmarshal([]byte(markup), &parsed) != nil {
+        return nil
+    }
+    return parsed.InlineKeyboard
+}
+
+func reply(w http.ResponseWriter, result interface{}) {
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "result": result})
+}
+
+func fail(w http.ResponseWriter, code int, description string) {
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error_code": code, "description": description})
+}
+
+func (m *Message) result() map[string]interface{} {
+    result := map[string]interface{}{
+        "message_id": m.ID,
+        "chat": map[string]interface{}{"id": m.ChatID, "type": "private"},
+        "date": time.Now().Unix(),
+    }
+    if m.Photo {
+        result["photo"] = []map[string]interface{}{{"file_id": fmt.Sprintf("photo%d", m.ID), "width": 1, "height": 1}}
+        result["caption"] = m.Text
+    } else {
+        result["text"] = m.Text
+    }
+    return result
+}
+
+// find must be called with the mutex held.
+func (s *Server) find(params map[string]string) (*Message, bool) {
+    chatID, _ := strconv.ParseInt(params["chat_id"], 10, 64)
+    messageID, _ := strconv.Atoi(params["message_id"])
+    for _, m := range s.messages[chatID] {
+        if m.ID == messageID && !m.Deleted {
+            return m, true
+        }
+    }
+    return nil, false
+}
+
+// touch must be called with the mutex held.
+func (s *Server) touch(m *Message) {
+    s.seq++
+    m.Seq = s.seq
+    s.notify()
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+    prefix := "/bot" + s.Token + "/"
+    if !strings.HasPrefix(r.URL.Path, prefix) {
+        fail(w, http.StatusUnauthorized, "Unauthorized")
+        return
+    }
+    method := strings.TrimPrefix(r.URL.Path, prefix)
+    params, err := readParams(r)
+    if err != nil {
+        fail(w, http.StatusBadRequest, "Bad Request: " + err.Error())
+        return
+    }
+
+    if method == "getUpdates" {
+        s.getUpdates(w, params)
+        return
+    }
+
+    s.mutex.Lock()
+    defer s.mutex.Unlock()
+    switch method {
+    case "getMe":
+        reply(w, map[string]interface{}{"id": 1, "is_bot": true, "first_name": "Fake", "username": "fake_bot"})
+    case "sendMessage", "sendPhoto":
+        chatID, err := strconv.ParseInt(params["chat_id"], 10, 64)
+        if err != nil {
+            fail(w, http.StatusBadRequest, "Bad Request: chat not found")
+            return
+        }
+        s.nextMessage++
+        m := &Message{ID: s.nextMessage, ChatID: chatID, Keyboard: parseKeyboard(params["reply_markup"])}
+        if method == "sendPhoto" {
+            m.Photo, m.Text = true, params["caption"]
+        } else {
+            m.Text = params["text"]
+        }
+        s.messages[chatID] = append(s.messages[chatID], m)
+        s.touch(m)
+        reply(w, m.result())
+    case "editMessageText", "editMessageReplyMarkup", "editMessageMedia":
+        m, ok := s.find(params)
+        if !ok {
+            fail(w, http.StatusBadRequest, "Bad Request: message to edit not found")
+            return
+        }
+        switch method {
+        case "editMessageText":
+            m.Text = params["text"]
+        case "editMessageMedia":
+            var media struct {
+                Caption string `json:"caption"`
+            }
+            json.Unmarshal([]byte(params["media"]), &media)
+            m.Photo, m.Text = true, media.Caption
+        }
+        m.Keyboard = parseKeyboard(params["reply_markup"])
+        s.touch(m)
+        reply(w, m.result())
+    case "deleteMessage":
+        m, ok := s.find(params)
+        if !ok {
+            fail(w, http.StatusBadRequest, "Bad Request: message to delete not found")
+            return
+        }
+        m.Deleted = true
+        s.touch(m)
+        reply(w, true)
+    case "answerCallbackQuery":
+        reply(w, true)
+    default:
+        log.Println("fakeapi: unsupported method", method)
+        fail(w, http.StatusNotFound, "Not Found: method " + method)
+    }
+}
+
+func (s *Server) getUpdates(w http.ResponseWriter, params map[string]string) {
+    offset, _ := strconv.Atoi(params["offset"])
+    timeout, _ := strconv.Atoi(params["timeout"])
+    deadline := time.After(time.Duration(timeout) * time.Second)
+    for {
+        s.mutex.Lock()
+        var pending []map[string]interface{}
+        for _, update := range s.updates {
+            if update["update_id"].(int) >= offset {
+                pending = append(pending, update)
+            }
+        }
+        s.updates = pending
+        changed := s.changed
+        s.mutex.Unlock()
+
+        if len(pending) > 0 {
+            reply(w, pending)
+            return
+        }
+        select {
+        case <-changed:
+        case <-deadline:
+            reply(w, []interface{}{})
+            return
+        }
+    }
+}
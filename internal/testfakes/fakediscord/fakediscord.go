@@ -0,0 +1,421 @@
+// Package fakediscord is an in-process stand-in for Discord: the REST calls
+// the bot makes and a gateway that greets, acknowledges heartbeats and
+// delivers interactions. A script plays users by running slash commands and
+// pressing components; messages are kept per direct message channel.
+package fakediscord
+
+import (
+    "encoding/json"
+    "fmt"
+    "io"
+    "log"
+    "mime"
+    "net"
+    "net/http"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+
+    websocket "github.com/gorilla/websocket"
+)
+
+const applicationID = "1"
+
+type User struct {
+    ID string `json:"id"`
+    Username string `json:"username"`
+    Locale string `json:"-"`
+}
+
+type Option struct {
+    Label string `json:"label"`
+    Value string `json:"value"`
+}
+
+// Component is a button (Type 2) or a select menu (Type 3).
+type Component struct {
+    Type int `json:"type"`
+    Label string `json:"label,omitempty"`
+    CustomID string `json:"custom_id,omitempty"`
+    Options []Option `json:"options,omitempty"`
+    Components []Component `json:"components,omitempty"`
+}
+
+type Message struct {
+    ID string
+    ChannelID string
+    Content string
+    Photo bool
+    // Components holds the rows of the message.
+    Components []Component
+    Deleted bool
+    Seq int
+}
+
+// Button finds a button by its label.
+func (m Message) Button(label string) (Component, bool) {
+    for _, row := range m.Components {
+        for _, component := range row.Components {
+            if component.Type == 2 && component.Label == label {
+                return component, true
+            }
+        }
+    }
+    return Component{}, false
+}
+
+// Option finds a select menu option by the start of its label, e.g. "e5".
+func (m Message) Option(prefix string) (Component, Option, bool) {
+    for _, row := range m.Components {
+        for _, component := range row.Components {
+            for _, option := range component.Options {
+                if strings.HasPrefix(option.Label, prefix + " ") || option.Label == prefix {
+                    return component, option, true
+                }
+            }
+        }
+    }
+    return Component{}, Option{}, false
+}
+
+type Server struct {
+    URL string
+    Token string
+    // Commands holds the slash commands registered by the bot.
+    Commands []map[string]interface{}
+
+    mutex sync.Mutex
+    changed chan struct{}
+    seq int
+    nextID int
+    channels map[string]string
+    messages map[string][]*Message
+    events chan []byte
+    listener net.Listener
+    server *http.Server
+}
+
+func NewServer(token string) (*Server, error) {
+    listener, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil {
+        return nil, err
+    }
+    s := &Server{
+        URL: "http://" + listener.Addr().String(),
+        Token: token,
+        changed: make(chan struct{}),
+        nextID: 1000,
+        channels: make(map[string]string),
+        messages: make(map[string][]*Message),
+        events: make(chan []byte, 64),
+        listener: listener,
+    }
+    s.server = &http.Server{Handler: s}
+    go s.server.Serve(listener)
+    return s, nil
+}
+
+func (s *Server) Close() error {
+    return s.server.Close()
+}
+
+// notify must be called with the mutex held.
+func (s *Server) notify() {
+    close(s.changed)
+    s.changed = make(chan struct{})
+}
+
+// id must be called with the mutex held.
+func (s *Server) id() string {
+    s.nextID++
+    return strconv.Itoa(s.nextID)
+}
+
+func (s *Server) Seq() int {
+    s.mutex.Lock()
+    defer s.mutex.Unlock()
+    return s.seq
+}
+
+// WaitFor returns the newest live message in the user's direct messages
+// changed after seq that satisfies match.
+func (s *Server) WaitFor(user User, seq int, timeout time.Duration, match func(Message) bool) (Message, error) {
+    deadline := time.After(timeout)
+    for {
+        s.mutex.Lock()
+        changed := s.changed
+        messages := s.messages[s.channels[user.ID]]
+        for k := len(messages) - 1; k >= 0; k-- {
+            if m := *messages[k]; !m.Deleted && m.Seq > seq && match(m) {
+                s.mutex.Unlock()
+                return m, nil
+            }
+        }
+        s.mutex.Unlock()
+
+        select {
+        case <-changed:
+        case <-deadline:
+            return Message{}, fmt.Errorf("user %s: no matching message after %v", user.Username, timeout)
+        }
+    }
+}
+
+func (s *Server) interaction(user User, kind int, data interface{}, message *Message) {
+    s.mutex.Lock()
+    interaction := map[string]interface{}{
+        "id": s.id(),
+        "application_id": applicationID,
+        "type": kind,
+        "data": data,
+        "channel_id": s.channels[user.ID],
+        "user": user,
+        "locale": user.Locale,
+        "token": "interaction" + strconv.Itoa(s.nextID),
+        "version": 1,
+    }
+    if message != nil {
+        interaction["message"] = message.result()
+    }
+    s.mutex.Unlock()
+    event, _ := json.Marshal(map[string]interface{}{"op": 0, "t": "INTERACTION_CREATE", "d": interaction})
+    s.events <- event
+}
+
+// Command runs a slash command; options map option names to values.
+func (s *Server) Command(user User, name string, options map[string]string) {
+    var list []map[string]interface{}
+    for optionName, value := range options {
+        list = append(list, map[string]interface{}{"name": optionName, "type": 3, "value": value})
+    }
+    s.interaction(user, 2, map[string]interface{}{"id": name, "name": name, "type": 1, "options": list}, nil)
+}
+
+func (s *Server) Press(user User, message Message, button Component) {
+    s.interaction(user, 3, map[string]interface{}{"custom_id": button.CustomID, "component_type": 2}, &message)
+}
+
+func (s *Server) Select(user User, message Message, menu Component, option Option) {
+    s.interaction(user, 3, map[string]interface{}{"custom_id": menu.CustomID, "component_type": 3, "values": []string{option.Value}}, &message)
+}
+
+func (m *Message) result() map[string]interface{} {
+    result := map[string]interface{}{
+        "id": m.ID,
+        "channel_id": m.ChannelID,
+        "content": m.Content,
+        "timestamp": time.Now().Format(time.RFC3339),
+    }
+    if m.Photo {
+        result["attachments"] = []map[string]interface{}{{"id": m.ID, "filename": "board.png"}}
+    }
+    return result
+}
+
+func reply(w http.ResponseWriter, result interface{}) {
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(result)
+}
+
+func fail(w http.ResponseWriter, code int, message string) {
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(code)
+    json.NewEncoder(w).Encode(map[string]interface{}{"code": 0, "message": message})
+}
+
+// readMessage decodes a request body, which comes as multipart with a
+// payload_json part when files are attached. An array, such as the bulk
+// command overwrite, is returned whole under "".
+func readMessage(r *http.Request) (map[string]json.RawMessage, bool, error) {
+    payload, files := []byte(nil), false
+    mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+    if strings.HasPrefix(mediaType, "multipart/") {
+        if err := r.ParseMultipartForm(32 << 20); err != nil {
+            return nil, false, err
+        }
+        payload = []byte(r.MultipartForm.Value["payload_json"][0])
+        files = len(r.MultipartForm.File) > 0
+    } else {
+        var err error
+        if payload, err = io.ReadAll(r.Body); err != nil {
+            return nil, false, err
+        }
+    }
+    fields := make(map[string]json.RawMessage)
+    if len(payload) == 0 {
+        return fields, files, nil
+    }
+    if payload[0] == '[' {
+        fields[""] = payload
+        return fields, files, nil
+    }
+    return fields, files, json.Unmarshal(payload, &fields)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+    if strings.TrimSuffix(r.URL.Path, "/") == "/gateway" {
+        s.gateway(w, r)
+        return
+    }
+    if r.Header.Get("Authorization") != "Bot " + s.Token {
+        fail(w, http.StatusUnauthorized, "401: Unauthorized")
+        return
+    }
+    path := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+    if len(path) < 3 || path[0] != "api" {
+        fail(w, http.StatusNotFound, "404: Not Found")
+        return
+    }
+    route := path[2:]
+    fields, files, err := readMessage(r)
+    if err != nil {
+        fail(w, http.StatusBadRequest, err.Error())
+        return
+    }
+
+    s.mutex.Lock()
+    defer s.mutex.Unlock()
+    switch {
+    case r.Method == "GET" && route[0] == "gateway":
+        reply(w, map[string]string{"url": "ws" + strings.TrimPrefix(s.URL, "http") + "/gateway"})
+    case r.Method == "PUT" && route[0] == "applications":
+        json.Unmarshal(fields[""], &s.Commands)
+        reply(w, s.Commands)
+    case r.Method == "POST" && strings.Join(route, "/") == "users/@me/channels":
+        var recipient string
+        json.Unmarshal(fields["recipient_id"], &recipient)
+        channelID, ok := s.channels[recipient]
+        if !ok {
+            channelID = s.id()
+            s.channels[recipient] = channelID
+        }
+        reply(w, map[string]interface{}{"id": channelID, "type": 1})
+    case route[0] == "channels" && len(route) >= 3 && route[2] == "messages":
+        s.channelMessages(w, r.Method, route, fields, files)
+    case r.Method == "POST" && route[0] == "interactions":
+        w.WriteHeader(http.StatusNoContent)
+    case r.Method == "DELETE" && route[0] == "webhooks":
+        w.WriteHeader(http.StatusNoContent)
+    default:
+        log.Println("fakediscord: unsupported route", r.Method, r.URL.Path)
+        fail(w, http.StatusNotFound, "404: Not Found")
+    }
+}
+
+// channelMessages must be called with the mutex held.
+func (s *Server) channelMessages(w http.ResponseWriter, method string, route []string, fields map[string]json.RawMessage, files bool) {
+    channelID := route[1]
+    var m *Message
+    if len(route) == 4 {
+        for _, candidate := range s.messages[channelID] {
+            if candidate.ID == route[3] && !candidate.Deleted {
+                m = candidate
+            }
+        }
+        if m == nil {
+            fail(w, http.StatusNotFound, "404: Unknown Message")
+            return
+        }
+    }
+
+    switch method {
+    case "POST":
+        m = &Message{ID: s.id(), ChannelID: channelID}
+        s.messages[channelID] = append(s.messages[channelID], m)
+    case "PATCH":
+    case "DELETE":
+        m.Deleted = true
+        s.touch(m)
+        w.WriteHeader(http.StatusNoContent)
+        return
+    }
+    if content, ok := fields["content"]; ok {
+        json.Unmarshal(content, &m.Content)
+    }
+    if components, ok := fields["components"]; ok {
+        m.Components = nil
+        json.Unmarshal(components, &m.Components)
+    }
+    if _, ok := fields["attachments"]; ok || files {
+        m.Photo = files
+    }
+    s.touch(m)
+    reply(w, m.result())
+}
+
+// touch must be called with the mutex held.
+func (s *Server) touch(m *Message) {
+    s.seq++
+    m.Seq = s.seq
+    s.notify()
+}
+
+var upgrader = websocket.Upgrader{}
+
+// gateway speaks just enough of the gateway protocol for one bot: Hello,
+// Ready after Identify, heartbeat acks and queued dispatches.
+func (s *Server) gateway(w http.ResponseWriter, r *http.Request) {
+    conn, err := upgrader.Upgrade(w, r, nil)
+    if err != nil {
+        return
+    }
+    defer conn.Close()
+
+    var writeMutex sync.Mutex
+    seq := 0
+    write := func(op int, event string, data interface{}) error {
+        writeMutex.Lock()
+        defer writeMutex.Unlock()
+        frame := map[string]interface{}{"op": op, "d": data}
+        if op == 0 {
+            seq++
+            frame["s"], frame["t"] = seq, event
+        }
+        return conn.WriteJSON(frame)
+    }
+    if err := write(10, "", map[string]interface{}{"heartbeat_interval": 45000}); err != nil {
+        return
+    }
+
+    done := make(chan struct{})
+    defer close(done)
+    go func() {
+        for {
+            select {
+            case event := <-s.events:
+                var frame struct {
+                    T string `json:"t"`
+                    D json.RawMessage `json:"d"`
+                }
+                json.Unmarshal(event, &frame)
+                if write(0, frame.T, frame.D) != nil {
+                    return
+                }
+            case <-done:
+                return
+            }
+        }
+    }()
+
+    for {
+        var frame struct {
+            Op int `json:"op"`
+        }
+        if err := conn.ReadJSON(&frame); err != nil {
+            return
+        }
+        switch frame.Op {
+        case 1:
+            write(11, "", nil)
+        case 2:
+            write(0, "READY", map[string]interface{}{
+                "v": 10,
+                "user": map[string]interface{}{"id": applicationID, "username": "fake", "bot": true},
+                "session_id": "fake",
+                "application": map[string]interface{}{"id": applicationID},
+                "guilds": []interface{}{},
+            })
+        }
+    }
+}
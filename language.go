@@ -0,0 +1,48 @@
+package main
+
+import (
+    i18n "./i18n"
+)
+
+const languageAuto = "auto"
+
+func constructLanguageSelector(lang i18n.Lang) Keyboard {
+    selector := Keyboard{}
+    for _, option := range i18n.Supported {
+        selector = append(selector, []Button{{Text: i18n.T(option, i18n.LanguageName), Action: "language", Data: string(option)}})
+    }
+    selector = append(selector, []Button{{Text: i18n.T(lang, i18n.LanguageAuto), Action: "language", Data: languageAuto}})
+    return selector
+}
+
+func setLanguage(botStorage *TicTacToeBotStorage, input *Input, choice string, newMsg IsNewMessage) error {
+    userState := botStorage.RegisterUser(input)
+    switch {
+    case choice == languageAuto:
+        userState.Language = ""
+    case i18n.IsSupported(i18n.Lang(choice)):
+        userState.Language = i18n.Lang(choice)
+    default:
+        return SendEditable(botStorage, &userState, NewMessage, MessageEditable,
+                            i18n.T(userState.Lang(), i18n.ChooseLanguage), constructLanguageSelector(userState.Lang()))
+    }
+    botStorage.setUserState(userState.User.ID, userState)
+    lang := userState.Lang()
+    if err := SendEditable(botStorage, &userState, newMsg, MessageNotEditable,
+                           i18n.T(lang, i18n.LanguageChanged, i18n.T(lang, i18n.LanguageName))); err != nil {
+        return err
+    }
+    if userState.State == InGame {
+        return sendTurnPrompt(botStorage, &userState)
+    }
+    return nil
+}
+
+func registerLanguageHandlers(router *Router, botStorage *TicTacToeBotStorage) {
+    router.Command("/language", func(input *Input) error {
+        return setLanguage(botStorage, input, input.Payload, NewMessage)
+    })
+    router.Action("language", func(input *Input) error {
+        return setLanguage(botStorage, input, input.Data, EditPreviousMessage)
+    })
+}
@@ -7,13 +7,15 @@ import (
     "log"
     "math/rand"
     "os"
+    "os/signal"
     "strconv"
     "strings"
     "sync"
+    "syscall"
     "time"
 
     game "./game"
-    telebot "github.com/tucnak/telebot"
+    i18n "./i18n"
 )
 
 type State string
@@ -30,22 +32,41 @@ type UserCustomization struct {
 
 type UserState struct {
     GameState game.GameState
+    GameID int64
     OpponentUserID int64
-    User *telebot.User
+    User *User
     WhoMe game.Cell
     State State
+    Language i18n.Lang `json:",omitempty"`
 
     Customization UserCustomization
-    Selector *telebot.ReplyMarkup
+    AwaitingTheme bool `json:",omitempty"`
+    Selector Keyboard `json:"-"`
     LastX, LastY int
 
-    BadMoveMessages []*telebot.StoredMessage
-    LastBotMsg *telebot.StoredMessage
+    Puzzle *PuzzleProgress `json:",omitempty"`
+    PuzzleRating int `json:",omitempty"`
+    LastPuzzle string `json:",omitempty"`
+    DailySubscribed bool `json:",omitempty"`
+    Daily *DailyResult `json:",omitempty"`
+
+    BadMoveMessages []MessageRef
+    LastBotMsg *MessageRef
     LastBotText string
 
     mutex sync.Mutex
 }
 
+func (us *UserState) Lang() i18n.Lang {
+    if us.Language != "" {
+        return us.Language
+    }
+    if us.User != nil {
+        return i18n.FromLanguageCode(us.User.LanguageCode)
+    }
+    return i18n.Default
+}
+
 func (us *UserState) CanMeMakeMove() bool {
     us.mutex.Lock()
     defer us.mutex.Unlock()
@@ -65,42 +86,45 @@ func (us *UserState) ResetGame() {
     us.LastX = -1
     us.LastY = -1
     us.GameState.ResetGame()
-    for i := range us.Selector.InlineKeyboard {
-        for j := range us.Selector.InlineKeyboard[i] {
-            us.Selector.InlineKeyboard[i][j].Text = us.Customization.Empty
+    rebuildSelector(us)
+}
+
+func rebuildSelector(us *UserState) {
+    if us.Selector == nil {
+        us.Selector = constructSelectorBoard(us.GameState.Width, us.GameState.Height)
+    }
+    for i := range us.Selector {
+        for j := range us.Selector[i] {
+            last := i == us.LastX && j == us.LastY
+            us.Selector[i][j].Text = us.Customization.Symbol(us.GameState.Board[i][j], last)
         }
     }
 }
 
-func constructSelectorBoard(buttonsWidth, buttonsHeight int) *telebot.ReplyMarkup {
-    selector := &telebot.ReplyMarkup{}
-    buttons := make([]telebot.Row, buttonsHeight)
+func opponentCell(cell game.Cell) game.Cell {
+    if cell == game.X {
+        return game.O
+    }
+    return game.X
+}
+
+func constructSelectorBoard(buttonsWidth, buttonsHeight int) Keyboard {
+    buttons := make(Keyboard, buttonsHeight)
     for i := 0; i < buttonsHeight; i++ {
-        buttons[i] = make([]telebot.Btn, buttonsWidth)
+        buttons[i] = make([]Button, buttonsWidth)
         for j := 0; j < buttonsWidth; j++ {
-            buttons[i][j] = selector.Data("🌫", strconv.Itoa(i * buttonsWidth + j))
+            buttons[i][j] = Button{Text: "🌫", Action: strconv.Itoa(i * maxBoardSize + j)}
         }
     }
-    selector.Inline(buttons...)
-    return selector
+    return buttons
 }
 
-func NewUser() UserState {
+func NewUser(rules RulesConfig) UserState {
     us := UserState{
-        GameState: game.GameState{
-            Width:     8,
-            Height:    8,
-            WinLength: 5,
-        },
+        GameState: rules.NewGameState(),
         WhoMe: game.X,
         State: Start,
-        Customization: UserCustomization{
-            X:     "❌",
-            O:     "🔴",
-            Empty: "🌫",
-            XLast: "❎",
-            OLast: "🟢",
-        },
+        Customization: themes[0].Customization,
         LastX: -1,
         LastY: -1,
     }
@@ -109,24 +133,152 @@ func NewUser() UserState {
     return us
 }
 
+func (us *UserState) applyRules(rules RulesConfig) {
+    us.GameState = rules.NewGameState()
+    us.Selector = nil
+    us.ResetGame()
+}
+
+// clone is a copy of the state that shares no memory with us, so the stored
+// state can be saved while a handler changes its own copy.
+func (us *UserState) clone() UserState {
+    c := *us
+    c.GameState = us.GameState.Clone()
+    if us.User != nil {
+        user := *us.User
+        c.User = &user
+    }
+    if us.Puzzle != nil {
+        puzzle := *us.Puzzle
+        c.Puzzle = &puzzle
+    }
+    if us.Daily != nil {
+        daily := *us.Daily
+        c.Daily = &daily
+    }
+    if us.LastBotMsg != nil {
+        ref := *us.LastBotMsg
+        c.LastBotMsg = &ref
+    }
+    if us.Selector != nil {
+        c.Selector = make(Keyboard, len(us.Selector))
+        for i := range us.Selector {
+            c.Selector[i] = append([]Button(nil), us.Selector[i]...)
+        }
+    }
+    c.BadMoveMessages = append([]MessageRef(nil), us.BadMoveMessages...)
+    return c
+}
+
 type TicTacToeBotStorage struct {
     UserId2UserState map[int64]UserState
     UsersSearching map[int64]bool
+    // accounts maps "platform:external id" to the user id.
+    accounts map[string]int64
     mutex sync.Mutex
-
-    selectorConfirm *telebot.ReplyMarkup
-    bot *telebot.Bot
+    // saveMutex orders the writes to the store, which happen outside mutex.
+    saveMutex sync.Mutex
+    // updates is held while an update is handled: handlers read the states
+    // of both players, change them and write them back whole, so two of
+    // them must not interleave.
+    updates sync.Mutex
+
+    selectorConfirm map[i18n.Lang]Keyboard
+    transport Transport
+    store Store
+    events *EventLog
+    config Config
+    puzzles []Puzzle
+    dailyPuzzles []Puzzle
+    analyses map[int64]*gameAnalysis
 }
 
-func NewTicTacToeBotStorage() TicTacToeBotStorage {
-    return TicTacToeBotStorage{
+func NewTicTacToeBotStorage(store Store, config Config) (*TicTacToeBotStorage, error) {
+    botStorage := &TicTacToeBotStorage{
         UserId2UserState: make(map[int64]UserState),
         UsersSearching: make(map[int64]bool),
+        accounts: make(map[string]int64),
+        analyses: make(map[int64]*gameAnalysis),
+        store: store,
+        config: config,
+    }
+    users, err := store.LoadUsers()
+    if err != nil {
+        return nil, err
+    }
+    for userId, userState := range users {
+        rebuildSelector(&userState)
+        botStorage.UserId2UserState[userId] = userState
+        if userState.User != nil && userState.User.Platform != PlatformTelegram {
+            botStorage.accounts[accountKey(userState.User.Platform, userState.User.ExternalID)] = userId
+        }
+    }
+
+    // Users who were looking for an opponent keep waiting after a restart,
+    // the queue forgets everybody else.
+    queue, err := store.LoadQueue()
+    if err != nil {
+        return nil, err
+    }
+    for _, userId := range queue {
+        if botStorage.UserId2UserState[userId].State != SearchingGame {
+            if err := store.Dequeue(userId); err != nil {
+                return nil, err
+            }
+            continue
+        }
+        botStorage.UsersSearching[userId] = true
+    }
+    for userId, userState := range botStorage.UserId2UserState {
+        if userState.State == SearchingGame && !botStorage.UsersSearching[userId] {
+            botStorage.UsersSearching[userId] = true
+            if err := store.Enqueue(userId); err != nil {
+                return nil, err
+            }
+        }
+    }
+    return botStorage, nil
+}
+
+func (botStorage *TicTacToeBotStorage) confirmSelector(userState *UserState) Keyboard {
+    return botStorage.selectorConfirm[userState.Lang()]
+}
+
+// confirmSelectors are the Yes/No buttons of the new game question.
+func confirmSelectors() map[i18n.Lang]Keyboard {
+    selectorConfirm := make(map[i18n.Lang]Keyboard)
+    for _, lang := range i18n.Supported {
+        selectorConfirm[lang] = Keyboard{{
+            {Text: i18n.T(lang, i18n.Yes), Action: "yes"},
+            {Text: i18n.T(lang, i18n.No), Action: "no"},
+        }}
+    }
+    return selectorConfirm
+}
+
+func accountKey(platform string, externalID string) string {
+    return platform + ":" + externalID
+}
+
+// UserID finds the user id of a user of another platform, allocating one on
+// the first visit.
+func (botStorage *TicTacToeBotStorage) UserID(platform string, externalID string) (int64, error) {
+    botStorage.mutex.Lock()
+    defer botStorage.mutex.Unlock()
+    key := accountKey(platform, externalID)
+    if userId, ok := botStorage.accounts[key]; ok {
+        return userId, nil
+    }
+    userId, err := botStorage.store.NewUserID()
+    if err != nil {
+        return 0, err
     }
+    botStorage.accounts[key] = userId
+    return userId, nil
 }
 
-func getUserId(context telebot.Context) int64 {
-    return context.Sender().ID
+func getUserId(input *Input) int64 {
+    return input.User.ID
 }
 
 func (botStorage *TicTacToeBotStorage) getUserState(userId int64) UserState {
@@ -134,30 +286,103 @@ func (botStorage *TicTacToeBotStorage) getUserState(userId int64) UserState {
     defer botStorage.mutex.Unlock()
     userState, ok := botStorage.UserId2UserState[userId]
     if !ok {
-        userState = NewUser()
+        userState = NewUser(botStorage.config.Rules)
         botStorage.UserId2UserState[userId] = userState
     }
-    return userState
+    return userState.clone()
 }
 
 func (botStorage *TicTacToeBotStorage) setUserState(userId int64, userState UserState) {
     botStorage.mutex.Lock()
-    defer botStorage.mutex.Unlock()
-    botStorage.UserId2UserState[userId] = userState
+    botStorage.UserId2UserState[userId] = userState.clone()
+    botStorage.mutex.Unlock()
+
+    // Whoever saves last stores the latest state, so a slow write cannot
+    // overwrite a newer one.
+    botStorage.saveMutex.Lock()
+    defer botStorage.saveMutex.Unlock()
+    latest := botStorage.getUserState(userId)
+    if err := botStorage.store.SaveUser(userId, &latest); err != nil {
+        log.Println("Failed to save user", userId, err)
+    }
 }
 
-func (botStorage *TicTacToeBotStorage) RegisterUser(context telebot.Context) UserState {
-    user := context.Sender()
+func (botStorage *TicTacToeBotStorage) newGame(xUserId int64, oUserId int64, gs game.GameState, opening string) int64 {
+    gameId, err := botStorage.store.NewGameID()
+    if err != nil {
+        log.Println("Failed to allocate game id", err)
+        return 0
+    }
+    record := GameRecord{
+        ID: gameId,
+        XUserID: xUserId,
+        OUserID: oUserId,
+        Width: gs.Width,
+        Height: gs.Height,
+        WinLength: gs.WinLength,
+        Opening: opening,
+        Moves: append([]game.Move(nil), gs.Moves...),
+        StartedAt: time.Now(),
+    }
+    botStorage.logEvent(Event{
+        Type: GameCreatedEvent,
+        GameID: gameId,
+        XUserID: xUserId,
+        OUserID: oUserId,
+        Width: gs.Width,
+        Height: gs.Height,
+        WinLength: gs.WinLength,
+        Opening: opening,
+    })
+    for k, m := range gs.Moves {
+        botStorage.logEvent(Event{Type: MoveEvent, GameID: gameId, N: k, I: m.I, J: m.J})
+    }
+    if err := botStorage.store.SaveGame(&record); err != nil {
+        log.Println("Failed to save game", gameId, err)
+    }
+    return gameId
+}
+
+func (botStorage *TicTacToeBotStorage) updateGame(gameId int64, update func(record *GameRecord)) {
+    if gameId == 0 {
+        return
+    }
+    record, err := botStorage.store.LoadGame(gameId)
+    if err != nil {
+        log.Println("Failed to load game", gameId, err)
+        return
+    }
+    update(&record)
+    if err := botStorage.store.SaveGame(&record); err != nil {
+        log.Println("Failed to save game", gameId, err)
+    }
+}
+
+func (botStorage *TicTacToeBotStorage) recordMove(gameId int64, i int, j int) {
+    botStorage.updateGame(gameId, func(record *GameRecord) {
+        record.Moves = append(record.Moves, game.Move{I: i, J: j})
+    })
+}
+
+func (botStorage *TicTacToeBotStorage) finishGame(gameId int64, whoWin game.Cell) {
+    botStorage.logEvent(Event{Type: GameEndedEvent, GameID: gameId, WhoWin: whoWin})
+    botStorage.updateGame(gameId, func(record *GameRecord) {
+        record.Finished = true
+        record.WhoWin = whoWin
+        record.FinishedAt = time.Now()
+    })
+}
+
+func (botStorage *TicTacToeBotStorage) RegisterUser(input *Input) UserState {
+    user := input.User
     userState := botStorage.getUserState(user.ID)
     if userState.User != nil {
         return userState
     }
 
     log.Println("Registering new user", user.ID)
-    userState.User = user
+    userState.User = &user
     botStorage.setUserState(user.ID, userState)
-
-    Save("save.json", botStorage)
     return userState
 }
 
@@ -171,13 +396,31 @@ func (botStorage *TicTacToeBotStorage) searchOpponents(userId int64) (int64, boo
             return 0, false
         }
         delete(botStorage.UsersSearching, key)
+        if err := botStorage.store.Dequeue(key); err != nil {
+            log.Println("Failed to dequeue", key, err)
+        }
         return key, true
     }
     log.Println("Opponent not found. Waiting...")
     botStorage.UsersSearching[userId] = true
+    if err := botStorage.store.Enqueue(userId); err != nil {
+        log.Println("Failed to enqueue", userId, err)
+    }
     return 0, false
 }
 
+func (botStorage *TicTacToeBotStorage) stopSearching(userId int64) {
+    botStorage.mutex.Lock()
+    defer botStorage.mutex.Unlock()
+    if !botStorage.UsersSearching[userId] {
+        return
+    }
+    delete(botStorage.UsersSearching, userId)
+    if err := botStorage.store.Dequeue(userId); err != nil {
+        log.Println("Failed to dequeue", userId, err)
+    }
+}
+
 func Marshal(v interface{}) (io.Reader, error) {
     b, err := json.MarshalIndent(v, "", "\t")
     if err != nil {
@@ -194,18 +437,12 @@ var (
 func Save(path string, v interface{}) error {
     saveMutex.Lock()
     defer saveMutex.Unlock()
-    f, err := os.Create(path)
-    if err != nil {
-        log.Println(err)
-        return err
-    }
-    defer f.Close()
     r, err := Marshal(v)
     if err != nil {
         log.Println(err)
         return err
     }
-    _, err = io.Copy(f, r)
+    err = writeFileAtomic(path, r)
     if err != nil {
         log.Println(err)
     }
@@ -239,17 +476,19 @@ const (
 )
 
 func SendEditable(botStorage *TicTacToeBotStorage, userState *UserState, newMsg IsNewMessage, editableMsg IsMessageEditable,
-                  what string,  opts ...interface{}) error {
-    defer Save("save.json", botStorage)
-
+                  what string, keyboard ...Keyboard) error {
     user := userState.User
+    var markup Keyboard
+    if len(keyboard) > 0 {
+        markup = keyboard[0]
+    }
     if newMsg && userState.LastBotMsg != nil {
         log.Println("New message")
-        botStorage.bot.Edit(userState.LastBotMsg, userState.LastBotText)
+        botStorage.transport.EditText(*userState.LastBotMsg, userState.LastBotText, nil)
     } else if userState.LastBotMsg != nil {
         log.Println("Edit last message", userState.LastBotText, "to", what)
         userState.LastBotText = what
-        _, err := botStorage.bot.Edit(userState.LastBotMsg, what, opts...)
+        err := botStorage.transport.EditText(*userState.LastBotMsg, what, markup)
         if !editableMsg {
             userState.LastBotMsg = nil
             userState.LastBotText = ""
@@ -259,14 +498,13 @@ func SendEditable(botStorage *TicTacToeBotStorage, userState *UserState, newMsg
     }
 
     log.Println("Send new message", what)
-    m, err := botStorage.bot.Send(telebot.Recipient(user), what, opts...)
+    ref, err := botStorage.transport.SendText(*user, what, markup)
     if err != nil {
         return err
     }
     log.Println("Sending complete")
     if editableMsg {
-        messageID, chatID := m.MessageSig()
-        userState.LastBotMsg = &telebot.StoredMessage{MessageID: messageID, ChatID: chatID}
+        userState.LastBotMsg = &ref
         userState.LastBotText = what
     } else {
         userState.LastBotMsg = nil
@@ -276,8 +514,8 @@ func SendEditable(botStorage *TicTacToeBotStorage, userState *UserState, newMsg
     return nil
 }
 
-func makeEndGame(userMsg string, opponentMsg string, botStorage *TicTacToeBotStorage, context telebot.Context) {
-    userId := getUserId(context)
+func makeEndGame(userMsg i18n.Text, opponentMsg i18n.Text, botStorage *TicTacToeBotStorage, input *Input) error {
+    userId := getUserId(input)
     userState := botStorage.getUserState(userId)
     opponentState := botStorage.getUserState(userState.OpponentUserID)
     userState.State = EndGame
@@ -286,228 +524,452 @@ func makeEndGame(userMsg string, opponentMsg string, botStorage *TicTacToeBotSto
     opponentState.State = EndGame
     botStorage.setUserState(userState.OpponentUserID, opponentState)
 
-    SendEditable(botStorage, &userState, EditPreviousMessage, MessageNotEditable, userState.GameState.ShowBoardToString())
-    SendEditable(botStorage, &opponentState, EditPreviousMessage, MessageNotEditable, opponentState.GameState.ShowBoardToString())
+    sendFinalBoard(botStorage, &userState)
+    sendFinalBoard(botStorage, &opponentState)
 
-    questionToNewGame := " Хотите начать новую игру?"
-    if err := SendEditable(botStorage, &userState, NewMessage, MessageEditable, userMsg + questionToNewGame, botStorage.selectorConfirm); err != nil {
-        log.Fatal(err)
-    }
-    if err := SendEditable(botStorage, &opponentState, NewMessage, MessageEditable,
-                              opponentMsg + questionToNewGame, botStorage.selectorConfirm); err != nil {
-        log.Fatal(err)
+    userLang, opponentLang := userState.Lang(), opponentState.Lang()
+    if err := SendEditable(botStorage, &userState, NewMessage, MessageEditable,
+                           userMsg.In(userLang) + " " + i18n.T(userLang, i18n.NewGameQuestion),
+                           botStorage.confirmSelector(&userState)); err != nil {
+        return err
     }
+    return SendEditable(botStorage, &opponentState, NewMessage, MessageEditable,
+                        opponentMsg.In(opponentLang) + " " + i18n.T(opponentLang, i18n.NewGameQuestion),
+                        botStorage.confirmSelector(&opponentState))
 }
 
-func constructButtonHandler(i int, j int, botStorage *TicTacToeBotStorage) func(context telebot.Context) error {
-    return func(context telebot.Context) error {
-        userId := getUserId(context)
-        userState := botStorage.getUserState(userId)
-        log.Println("Handle btn", i, j, userState)
-        if !userState.CanMeMakeMove() {
-            m, err := botStorage.bot.Send(telebot.Recipient(userState.User), "Сейчас не твой ход")
-            if err == nil {
-                messageID, chatID := m.MessageSig()
-                userState.BadMoveMessages = append(userState.BadMoveMessages, &telebot.StoredMessage{MessageID: messageID, ChatID: chatID})
-                botStorage.setUserState(userId, userState)
-            }
-            return err
-        }
-        ok := userState.MakeMove(i, j)
-        if !ok {
-            m, err := botStorage.bot.Send(telebot.Recipient(userState.User), "Некорректный ход")
-            if err == nil {
-                messageID, chatID := m.MessageSig()
-                userState.BadMoveMessages = append(userState.BadMoveMessages, &telebot.StoredMessage{MessageID: messageID, ChatID: chatID})
-                botStorage.setUserState(userId, userState)
-            }
-            return err
+func handleMove(i int, j int, botStorage *TicTacToeBotStorage, input *Input) error {
+    userId := getUserId(input)
+    userState := botStorage.getUserState(userId)
+    log.Println("Handle move", i, j, userState)
+    if !userState.CanMeMakeMove() {
+        ref, err := botStorage.transport.SendText(*userState.User, i18n.T(userState.Lang(), i18n.NotYourTurn), nil)
+        if err == nil {
+            userState.BadMoveMessages = append(userState.BadMoveMessages, ref)
+            botStorage.setUserState(userId, userState)
         }
-        defer Save("save.json", botStorage)
-        for _, msg := range userState.BadMoveMessages {
-            botStorage.bot.Delete(msg)
+        return err
+    }
+    ok := userState.MakeMove(i, j)
+    if !ok {
+        ref, err := botStorage.transport.SendText(*userState.User, i18n.T(userState.Lang(), i18n.InvalidMove), nil)
+        if err == nil {
+            userState.BadMoveMessages = append(userState.BadMoveMessages, ref)
+            botStorage.setUserState(userId, userState)
         }
-        botStorage.setUserState(userId, userState)
+        return err
+    }
+    botStorage.logEvent(Event{
+        Type: MoveEvent,
+        GameID: userState.GameID,
+        N: len(userState.GameState.Moves) - 1,
+        I: i,
+        J: j,
+    })
+    for _, msg := range userState.BadMoveMessages {
+        botStorage.transport.Delete(msg)
+    }
+    botStorage.setUserState(userId, userState)
 
-        opponentState := botStorage.getUserState(userState.OpponentUserID)
-        opponentState.MakeMove(i, j)
-        botStorage.setUserState(userState.OpponentUserID, opponentState)
-        if err := SendEditable(botStorage, &userState, EditPreviousMessage, MessageEditable, "Ожидаем ход соперника"); err != nil {
-            log.Fatal(err)
-        }
+    opponentState := botStorage.getUserState(userState.OpponentUserID)
+    opponentState.MakeMove(i, j)
+    botStorage.setUserState(userState.OpponentUserID, opponentState)
+    botStorage.recordMove(userState.GameID, i, j)
+    if err := SendEditable(botStorage, &userState, EditPreviousMessage, MessageEditable,
+                           i18n.T(userState.Lang(), i18n.WaitingOpponentMove)); err != nil {
+        return err
+    }
+
+    opponentState.LastX = i
+    opponentState.LastY = j
+    userState.LastX = -1
+    userState.LastY = -1
+    rebuildSelector(&opponentState)
+    rebuildSelector(&userState)
+    botStorage.setUserState(userId, userState)
+    botStorage.setUserState(userState.OpponentUserID, opponentState)
 
-        opponentState.LastX = i
-        opponentState.LastY = j
-        if userState.WhoMe == game.X {
-            opponentState.Selector.InlineKeyboard[i][j].Text = opponentState.Customization.XLast
-            userState.Selector.InlineKeyboard[i][j].Text = userState.Customization.X
-            if userState.LastX != -1 {
-                userState.Selector.InlineKeyboard[userState.LastX][userState.LastY].Text = userState.Customization.O
+    if err := SendEditable(botStorage, &opponentState, EditPreviousMessage, MessageEditable,
+                           i18n.T(opponentState.Lang(), i18n.YourTurn), opponentState.Selector); err != nil {
+        return err
+    }
+    if userState.GameState.IsGameEnded {
+        var userMsg, opponentMsg i18n.Text
+        switch userState.GameState.WhoWin {
+        case game.Empty:
+            userMsg = i18n.Msg(i18n.Draw)
+            opponentMsg = userMsg
+        default:
+            record, err := botStorage.store.LoadGame(userState.GameID)
+            if err != nil {
+                record = GameRecord{Moves: userState.GameState.Moves}
             }
-        } else {
-            opponentState.Selector.InlineKeyboard[i][j].Text = opponentState.Customization.OLast
-            userState.Selector.InlineKeyboard[i][j].Text = userState.Customization.O
-            if userState.LastX != -1 {
-                userState.Selector.InlineKeyboard[userState.LastX][userState.LastY].Text = userState.Customization.X
+            userMsg = i18n.Plural(i18n.YouWon, record.MovesOf(userState.GameState.WhoWin))
+            opponentMsg = i18n.Msg(i18n.YouLost)
+            if userState.GameState.WhoWin != userState.WhoMe {
+                userMsg, opponentMsg = opponentMsg, userMsg
             }
         }
-        botStorage.setUserState(userState.OpponentUserID, opponentState)
 
-        if err := SendEditable(botStorage, &opponentState, EditPreviousMessage, MessageEditable, "Ваш ход", opponentState.Selector); err != nil {
-            log.Fatal(err)
-            return err
-        }
-        if userState.GameState.IsGameEnded {
-            userMsg := ""
-            opponentMsg := ""
-            switch userState.GameState.WhoWin {
-            case game.Empty:
-                msg := "Ничья!"
-                userMsg = msg
-                opponentMsg = msg
-            default:
-                userMsg = "Вы выиграли!"
-                opponentMsg = "Вы проиграли!"
-                if userState.GameState.WhoWin != userState.WhoMe {
-                    userMsg, opponentMsg = opponentMsg, userMsg
-                }
-            }
+        botStorage.finishGame(userState.GameID, userState.GameState.WhoWin)
+        return makeEndGame(userMsg, opponentMsg, botStorage, input)
+    }
+    return nil
+}
 
-            makeEndGame(userMsg, opponentMsg, botStorage, context)
+func constructButtonHandler(i int, j int, botStorage *TicTacToeBotStorage) Handler {
+    return func(input *Input) error {
+        if botStorage.getUserState(getUserId(input)).State == InPuzzle {
+            return handlePuzzleMove(i, j, botStorage, input)
         }
+        return handleMove(i, j, botStorage, input)
+    }
+}
+
+func handleResign(botStorage *TicTacToeBotStorage, input *Input) error {
+    userState := botStorage.RegisterUser(input)
+    if userState.State == InPuzzle {
+        return resignPuzzle(botStorage, input)
+    }
+    if userState.State != InGame {
+        SendEditable(botStorage, &userState, NewMessage, MessageNotEditable, i18n.T(userState.Lang(), i18n.NotInGameToResign))
         return nil
     }
+
+    botStorage.logEvent(Event{
+        Type: ResignEvent,
+        GameID: userState.GameID,
+        UserID: userState.User.ID,
+        WhoWin: opponentCell(userState.WhoMe),
+    })
+    botStorage.finishGame(userState.GameID, opponentCell(userState.WhoMe))
+    return makeEndGame(i18n.Msg(i18n.YouResigned), i18n.Msg(i18n.OpponentResigned), botStorage, input)
+}
+
+// helpText lists only the commands of the enabled features.
+func helpText(lang i18n.Lang, features FeaturesConfig) string {
+    lines := []string{i18n.T(lang, i18n.Help)}
+    for _, line := range []struct {
+        enabled bool
+        id i18n.MessageID
+    }{
+        {features.Language, i18n.HelpLanguage},
+        {features.Themes, i18n.HelpTheme},
+        {features.Replay, i18n.HelpReplay},
+        {features.Hint && features.HintPvP, i18n.HelpHint},
+        {features.Puzzle, i18n.HelpPuzzle},
+        {features.Daily, i18n.HelpDaily},
+        {features.TextMoves, i18n.HelpTextMoves},
+    } {
+        if line.enabled {
+            lines = append(lines, i18n.T(lang, line.id))
+        }
+    }
+    return strings.Join(lines, "\n")
+}
+
+func sendTurnPrompt(botStorage *TicTacToeBotStorage, userState *UserState) error {
+    if userState.CanMeMakeMove() {
+        return SendEditable(botStorage, userState, EditPreviousMessage, MessageEditable,
+                            i18n.T(userState.Lang(), i18n.YourTurn), userState.Selector)
+    }
+    return SendEditable(botStorage, userState, EditPreviousMessage, MessageEditable,
+                        i18n.T(userState.Lang(), i18n.WaitingOpponentMove))
+}
+
+func sendGameStart(botStorage *TicTacToeBotStorage, userState *UserState, opening string) {
+    text := i18n.T(userState.Lang(), i18n.OpponentFound)
+    if opening != "" {
+        text += "\n" + i18n.T(userState.Lang(), i18n.OpeningName, opening)
+    }
+    SendEditable(botStorage, userState, EditPreviousMessage, MessageNotEditable, text)
+    sendTurnPrompt(botStorage, userState)
 }
 
-func startSeachingOpponent(botStorage *TicTacToeBotStorage, context telebot.Context) error {
-    userId := getUserId(context)
+func startSeachingOpponent(botStorage *TicTacToeBotStorage, input *Input) error {
+    userId := getUserId(input)
     userState := botStorage.getUserState(userId)
     userState.State = SearchingGame
-    if err := SendEditable(botStorage, &userState, EditPreviousMessage, MessageEditable, "Ищу соперника..."); err != nil {
+    if err := SendEditable(botStorage, &userState, EditPreviousMessage, MessageEditable,
+                           i18n.T(userState.Lang(), i18n.SearchingOpponent)); err != nil {
         return err
     }
     opponentUserId, found := botStorage.searchOpponents(userId)
     if found {
         log.Println("Opponent was found", opponentUserId)
-
-        msgOpponentFound := "Соперник найден. Начинаем игру!"
-
-        fig := []game.Cell{game.X, game.O}
-        rand.Shuffle(len(fig), func(i, j int) { fig[i], fig[j] = fig[j], fig[i] })
-
-        userState.State = InGame
-        userState.OpponentUserID = opponentUserId
-        userState.WhoMe = fig[0]
-        botStorage.setUserState(userId, userState)
-
-        SendEditable(botStorage, &userState, EditPreviousMessage, MessageNotEditable, msgOpponentFound)
-        if userState.WhoMe == game.X {
-            SendEditable(botStorage, &userState, EditPreviousMessage, MessageEditable, "Ваш ход", userState.Selector)
-        } else {
-            SendEditable(botStorage, &userState, EditPreviousMessage, MessageEditable, "Ожидаем ход соперника")
+        xUserId, oUserId := userId, opponentUserId
+        if rand.Intn(2) == 0 {
+            xUserId, oUserId = oUserId, xUserId
         }
+        startMatch(botStorage, xUserId, oUserId)
+    }
+    return nil
+}
 
-        opponentUserState := botStorage.getUserState(opponentUserId)
-        opponentUserState.State = InGame
-        opponentUserState.OpponentUserID = userId
-        opponentUserState.WhoMe = fig[1]
-        botStorage.setUserState(opponentUserId, opponentUserState)
-
-        SendEditable(botStorage, &opponentUserState, EditPreviousMessage, MessageNotEditable, msgOpponentFound)
-        if opponentUserState.WhoMe == game.X {
-            SendEditable(botStorage, &opponentUserState, EditPreviousMessage, MessageEditable, "Ваш ход", opponentUserState.Selector)
-        } else {
-            SendEditable(botStorage, &opponentUserState, EditPreviousMessage, MessageEditable, "Ожидаем ход соперника")
+// startMatch puts two users into a new game and shows them its start; with
+// rules.openings the board already holds a book opening.
+func startMatch(botStorage *TicTacToeBotStorage, xUserId int64, oUserId int64) int64 {
+    xUserState := botStorage.getUserState(xUserId)
+    xUserState.applyRules(botStorage.config.Rules)
+    var opening game.Opening
+    if botStorage.config.Rules.Openings {
+        if book := game.OpeningsFor(&xUserState.GameState); len(book) > 0 {
+            opening = book[rand.Intn(len(book))]
+            xUserState.GameState.ApplyOpening(opening)
         }
     }
-    return nil
+    gameId := botStorage.newGame(xUserId, oUserId, xUserState.GameState, opening.Name)
+
+    for _, side := range []struct {
+        userId, opponentUserId int64
+        who game.Cell
+    }{{xUserId, oUserId, game.X}, {oUserId, xUserId, game.O}} {
+        userState := botStorage.getUserState(side.userId)
+        userState.applyRules(botStorage.config.Rules)
+        if opening.Name != "" {
+            userState.GameState.ApplyOpening(opening)
+            rebuildSelector(&userState)
+        }
+        userState.State = InGame
+        userState.Puzzle = nil
+        userState.GameID = gameId
+        userState.OpponentUserID = side.opponentUserId
+        userState.WhoMe = side.who
+        botStorage.setUserState(side.userId, userState)
+
+        sendGameStart(botStorage, &userState, opening.Name)
+    }
+    return gameId
 }
 
 func main() {
     rand.Seed(time.Now().UnixNano())
 
-	pref := telebot.Settings{
-		Token:  os.Getenv("TELEGRAM_TOKEN"),
-		Poller: &telebot.LongPoller{Timeout: 10 * time.Second},
-	}
+    config, err := LoadConfig(os.Args)
+    if err != nil {
+        log.Fatal(err)
+        return
+    }
+    if config.Console.Enabled {
+        if err := runConsole(config); err != nil {
+            log.Fatal(err)
+        }
+        return
+    }
+    if config.Arena.Enabled {
+        if err := runArena(config); err != nil {
+            log.Fatal(err)
+        }
+        return
+    }
+    if config.Piskvork {
+        if err := runPiskvork(); err != nil {
+            log.Fatal(err)
+        }
+        return
+    }
 
-	bot, err := telebot.NewBot(pref)
-	if err != nil {
-		log.Fatal(err)
-		return
-	}
+    services, closeBot, err := newBot(config)
+    if err != nil {
+        log.Fatal(err)
+        return
+    }
+    defer closeBot()
+    for _, service := range services {
+        go service.Start()
+    }
+    log.Println("Started")
 
-    botStorage := NewTicTacToeBotStorage()
-    Load("save.json", &botStorage)
+    signals := make(chan os.Signal, 1)
+    signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+    <-signals
+    log.Println("Stopping")
+    for _, service := range services {
+        service.Stop()
+    }
+}
 
-    selectorConfirm := &telebot.ReplyMarkup{}
-    yesButton := selectorConfirm.Data("Да", "yes")
-    noButton := selectorConfirm.Data("Нет", "no")
-    selectorConfirm.Inline(selectorConfirm.Row(yesButton,noButton))
+// newBot sets up the storage, a front-end for every configured messenger and
+// the API; all of them share the game state, so players of different
+// messengers meet in one queue.
+func newBot(config Config) ([]Service, func(), error) {
+    var frontends []Frontend
+    if config.Token != "" {
+        telegram, err := NewTelegramTransport(config)
+        if err != nil {
+            return nil, nil, err
+        }
+        frontends = append(frontends, telegram)
+    }
 
-    botStorage.bot = bot
-    botStorage.selectorConfirm = selectorConfirm
+    store, err := OpenStoreWithFallback(config.Storage.Path, config.Storage.Snapshot)
+    if err != nil {
+        return nil, nil, err
+    }
+    if err := ImportSave(config.Storage.LegacySave, store); err != nil {
+        log.Println("Failed to import", config.Storage.LegacySave, err)
+    }
+    botStorage, err := NewTicTacToeBotStorage(store, config)
+    if err != nil {
+        store.Close()
+        return nil, nil, err
+    }
+    if config.Features.Puzzle || config.Features.Daily {
+        if botStorage.puzzles, err = LoadPuzzles(config.Puzzles.Path); err != nil {
+            log.Println("No puzzles:", err)
+        }
+    }
+    botStorage.dailyPuzzles = botStorage.puzzles
+    if config.Features.Daily && config.Daily.Path != "" {
+        if botStorage.dailyPuzzles, err = LoadPuzzles(config.Daily.Path); err != nil {
+            log.Println("No daily challenges:", err)
+        }
+    }
+    events, err := OpenEventLog(config.Storage.EventLog)
+    if err != nil {
+        store.Close()
+        return nil, nil, err
+    }
+    closeBot := func() {
+        events.Close()
+        store.Close()
+    }
+    if config.Discord.Token != "" {
+        discord, err := NewDiscordTransport(config, botStorage)
+        if err != nil {
+            closeBot()
+            return nil, nil, err
+        }
+        frontends = append(frontends, discord)
+    }
+    if config.Web.Listen != "" {
+        web, err := NewWebTransport(config, botStorage)
+        if err != nil {
+            closeBot()
+            return nil, nil, err
+        }
+        frontends = append(frontends, web)
+    }
+    botStorage.ReplayEvents(events.Events())
+    botStorage.events = events
+    if err := events.Compact(); err != nil {
+        log.Println("Event log compaction failed", err)
+    }
 
+    transports := make(Transports)
+    for _, frontend := range frontends {
+        transports[frontend.Platform()] = frontend
+    }
+    botStorage.transport = transports
+    botStorage.selectorConfirm = confirmSelectors()
+    go botStorage.RunSnapshots(config.Storage.Snapshot, config.Storage.SnapshotInterval)
+    if config.Features.Daily {
+        go botStorage.RunDaily()
+    }
+    botStorage.ResumeGames()
 
-    buttonsHeight := 8
-    buttonsWidth := 8
-    buttons := constructSelectorBoard(buttonsWidth, buttonsHeight).InlineKeyboard
-    for i := 0; i < buttonsHeight; i++ {
-        for j := 0; j < buttonsWidth; j++ {
-            bot.Handle(&buttons[i][j], constructButtonHandler(i, j, &botStorage))
+
+    router := NewRouter()
+    router.Serialize(&botStorage.updates)
+    router.LastMessage(func(input *Input) *MessageRef {
+        return botStorage.getUserState(getUserId(input)).LastBotMsg
+    })
+    buttons := constructSelectorBoard(maxBoardSize, maxBoardSize)
+    for i := 0; i < maxBoardSize; i++ {
+        for j := 0; j < maxBoardSize; j++ {
+            router.CurrentAction(buttons[i][j].Action, constructButtonHandler(i, j, botStorage))
         }
     }
 
-    bot.Handle(&yesButton, func(context telebot.Context) error {
-        defer Save("save.json", botStorage)
-        userId := getUserId(context)
+    router.CurrentAction("yes", func(input *Input) error {
+        userId := getUserId(input)
         userState := botStorage.getUserState(userId)
+        if userState.State == InPuzzle {
+            return nil
+        }
         userState.ResetGame()
         botStorage.setUserState(userId, userState)
         switch userState.State {
         case Start, EndGame:
-            startSeachingOpponent(&botStorage, context)
+            startSeachingOpponent(botStorage, input)
         }
         return nil
     })
-    bot.Handle(&noButton, func(context telebot.Context) error {
-        userState := botStorage.getUserState(getUserId(context))
+    router.CurrentAction("no", func(input *Input) error {
+        userState := botStorage.getUserState(getUserId(input))
         switch userState.State {
         case Start, EndGame:
-            return SendEditable(&botStorage, &userState, NewMessage, MessageNotEditable, "Окей, тогда до связи!")
+            return SendEditable(botStorage, &userState, NewMessage, MessageNotEditable, i18n.T(userState.Lang(), i18n.Bye))
         }
         return nil
     })
 
-    printHelloMsg := func(context telebot.Context) error {
-        userState := botStorage.RegisterUser(context)
+    printHelloMsg := func(input *Input) error {
+        userState := botStorage.RegisterUser(input)
         log.Println("Hello!", userState)
-        return SendEditable(&botStorage, &userState, NewMessage, MessageEditable,
-                            "Привет! Хочешь сыграть в крестики нолики?", selectorConfirm)
+        return SendEditable(botStorage, &userState, NewMessage, MessageEditable,
+                            i18n.T(userState.Lang(), i18n.Hello), botStorage.confirmSelector(&userState))
     }
 
-    log.Println("Started")
-    bot.Handle("/hello", printHelloMsg)
-    bot.Handle("/start", printHelloMsg)
-    bot.Handle("/resign", func(context telebot.Context) error {
-        userState := botStorage.RegisterUser(context)
-        if userState.State != InGame {
-            SendEditable(&botStorage, &userState, NewMessage, MessageNotEditable, "Вы не в игре, для того чтобы сдаться.")
-            return nil
+    router.Command("/hello", printHelloMsg)
+    router.Command("/start", printHelloMsg)
+    router.Command("/resign", func(input *Input) error {
+        return handleResign(botStorage, input)
+    })
+    router.Command("/help", func(input *Input) error {
+        userState := botStorage.RegisterUser(input)
+        return SendEditable(botStorage, &userState, NewMessage, MessageNotEditable, helpText(userState.Lang(), config.Features))
+    })
+    registerAdminHandlers(router, botStorage)
+    if config.Features.Language {
+        registerLanguageHandlers(router, botStorage)
+    }
+    if config.Features.Themes {
+        registerThemeHandlers(router, botStorage)
+    }
+    if config.Features.Replay {
+        registerReplayHandlers(router, botStorage)
+    }
+    if config.Features.Hint {
+        registerHintHandlers(router, botStorage)
+    }
+    if config.Features.Puzzle {
+        registerPuzzleHandlers(router, botStorage)
+    }
+    if config.Features.Daily {
+        registerDailyHandlers(router, botStorage)
+    }
+    router.Text(func(input *Input) error {
+        userState := botStorage.RegisterUser(input)
+        playing := (userState.State == InGame || userState.State == InPuzzle) && config.Features.TextMoves
+        if move, ok := game.ParseMove(input.Text); ok && playing {
+            if userState.State == InPuzzle {
+                return handlePuzzleMove(move.I, move.J, botStorage, input)
+            }
+            return handleMove(move.I, move.J, botStorage, input)
+        }
+        if userState.AwaitingTheme {
+            return handleThemeInput(botStorage, input, input.Text)
+        }
+        if playing {
+            return SendEditable(botStorage, &userState, NewMessage, MessageNotEditable,
+                                i18n.T(userState.Lang(), i18n.MoveNotUnderstood))
         }
-
-        defer Save("save.json", botStorage)
-        makeEndGame("Вы сдались.", "Соперник сдался.", &botStorage, context)
         return nil
     })
-    bot.Handle("/help", func(context telebot.Context) error {
-        userState := botStorage.RegisterUser(context)
-        return SendEditable(&botStorage, &userState, NewMessage, MessageNotEditable, strings.Join([]string{
-            "/help - помощь",
-            "/resign - сдаться в текущей игре",
-            "/start - начать общение с ботом",
-        }, "\n"))
-    })
-
-	bot.Start()
+    var services []Service
+    for _, frontend := range frontends {
+        frontend.Bind(router)
+        services = append(services, frontend)
+    }
+    if config.API.Listen != "" {
+        api, err := NewAPIServer(config, botStorage)
+        if err != nil {
+            closeBot()
+            return nil, nil, err
+        }
+        services = append(services, api)
+    }
+    return services, closeBot, nil
 }
+
@@ -0,0 +1,274 @@
+package main
+
+import (
+    "io"
+    "log"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+
+    game "./game"
+    i18n "./i18n"
+)
+
+const (
+    testX int64 = 1
+    testO int64 = 2
+)
+
+// newTestBot is a bot with its own storage that talks to a mock transport.
+func newTestBot(t *testing.T, rules RulesConfig) (*TicTacToeBotStorage, *mockTransport) {
+    log.SetOutput(io.Discard)
+    t.Cleanup(func() { log.SetOutput(os.Stderr) })
+    store, err := OpenBoltStore(filepath.Join(t.TempDir(), "storage.db"))
+    if err != nil {
+        t.Fatal(err)
+    }
+    t.Cleanup(func() { store.Close() })
+    config := DefaultConfig()
+    config.Rules = rules
+    botStorage, err := NewTicTacToeBotStorage(store, config)
+    if err != nil {
+        t.Fatal(err)
+    }
+    transport := &mockTransport{}
+    botStorage.transport = transport
+    botStorage.selectorConfirm = confirmSelectors()
+    return botStorage, transport
+}
+
+func testInput(userId int64) *Input {
+    return &Input{User: User{ID: userId, FirstName: "Player", LanguageCode: "en"}}
+}
+
+// startTestGame registers both players and starts a game with testX as X.
+func startTestGame(t *testing.T, botStorage *TicTacToeBotStorage, transport *mockTransport) int64 {
+    botStorage.RegisterUser(testInput(testX))
+    botStorage.RegisterUser(testInput(testO))
+    gameId := startMatch(botStorage, testX, testO)
+    if gameId == 0 {
+        t.Fatal("no game id")
+    }
+    transport.reset()
+    return gameId
+}
+
+// play makes the moves alternately for X and O.
+func play(t *testing.T, botStorage *TicTacToeBotStorage, moves ...game.Move) {
+    for k, m := range moves {
+        userId := testX
+        if k % 2 == 1 {
+            userId = testO
+        }
+        if err := handleMove(m.I, m.J, botStorage, testInput(userId)); err != nil {
+            t.Fatal(err)
+        }
+    }
+}
+
+func expectCall(t *testing.T, transport *mockTransport, userId int64, kind string, text string) mockCall {
+    t.Helper()
+    call, ok := transport.find(userId, kind, text)
+    if !ok {
+        t.Fatalf("user %d got no %s with %q, got %+v", userId, kind, text, transport.to(userId, kind))
+    }
+    return call
+}
+
+func TestHandleMove(t *testing.T) {
+    botStorage, transport := newTestBot(t, DefaultConfig().Rules)
+    gameId := startTestGame(t, botStorage, transport)
+
+    play(t, botStorage, game.Move{I: 0, J: 0})
+    expectCall(t, transport, testX, "edit", english(i18n.WaitingOpponentMove))
+    turn := expectCall(t, transport, testO, "edit", english(i18n.YourTurn))
+    opponentState := botStorage.getUserState(testO)
+    if len(turn.Keyboard) == 0 || turn.Keyboard[0][0].Text != opponentState.Customization.Symbol(game.X, true) {
+        t.Errorf("O's board does not show the last X at a1: %+v", turn.Keyboard)
+    }
+    record, err := botStorage.store.LoadGame(gameId)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(record.Moves) != 1 || record.Moves[0] != (game.Move{I: 0, J: 0}) {
+        t.Errorf("game record has moves %v", record.Moves)
+    }
+
+    transport.reset()
+    play(t, botStorage, game.Move{I: 0, J: 1})
+    expectCall(t, transport, testX, "send", english(i18n.NotYourTurn))
+    if err := handleMove(0, 0, botStorage, testInput(testO)); err != nil {
+        t.Fatal(err)
+    }
+    invalid := expectCall(t, transport, testO, "send", english(i18n.InvalidMove))
+
+    transport.reset()
+    if err := handleMove(1, 1, botStorage, testInput(testO)); err != nil {
+        t.Fatal(err)
+    }
+    if deleted := transport.to(testO, "delete"); len(deleted) != 1 || deleted[0].Ref != invalid.Ref {
+        t.Errorf("the invalid move notice was not deleted: %+v", deleted)
+    }
+    expectCall(t, transport, testX, "edit", english(i18n.YourTurn))
+}
+
+func TestMakeEndGameWin(t *testing.T) {
+    botStorage, transport := newTestBot(t, DefaultConfig().Rules)
+    gameId := startTestGame(t, botStorage, transport)
+
+    var moves []game.Move
+    for j := 0; j < 4; j++ {
+        moves = append(moves, game.Move{I: 0, J: j}, game.Move{I: 1, J: j})
+    }
+    play(t, botStorage, append(moves, game.Move{I: 0, J: 4})...)
+
+    won := expectCall(t, transport, testX, "send", i18n.N(i18n.English, i18n.YouWon, 5))
+    lost := expectCall(t, transport, testO, "send", english(i18n.YouLost))
+    for _, question := range []mockCall{won, lost} {
+        if _, ok := findButton(question.Keyboard, english(i18n.Yes)); !ok {
+            t.Errorf("%q has no new game question", question.Text)
+        }
+    }
+    for _, userId := range []int64{testX, testO} {
+        if len(transport.to(userId, "photo")) != 1 {
+            t.Errorf("user %d did not get the final board", userId)
+        }
+        if state := botStorage.getUserState(userId).State; state != EndGame {
+            t.Errorf("user %d is in state %s", userId, state)
+        }
+    }
+    record, err := botStorage.store.LoadGame(gameId)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !record.Finished || record.WhoWin != game.X {
+        t.Errorf("game record is not won by X: %+v", record)
+    }
+}
+
+func TestMakeEndGameDraw(t *testing.T) {
+    botStorage, transport := newTestBot(t, RulesConfig{Width: 3, Height: 3, WinLength: 3})
+    gameId := startTestGame(t, botStorage, transport)
+
+    // X O X
+    // X O O
+    // O X X
+    play(t, botStorage,
+         game.Move{I: 0, J: 0}, game.Move{I: 0, J: 1}, game.Move{I: 0, J: 2},
+         game.Move{I: 1, J: 1}, game.Move{I: 1, J: 0}, game.Move{I: 1, J: 2},
+         game.Move{I: 2, J: 1}, game.Move{I: 2, J: 0}, game.Move{I: 2, J: 2})
+
+    for _, userId := range []int64{testX, testO} {
+        expectCall(t, transport, userId, "send", english(i18n.Draw))
+        if state := botStorage.getUserState(userId).State; state != EndGame {
+            t.Errorf("user %d is in state %s", userId, state)
+        }
+    }
+    record, err := botStorage.store.LoadGame(gameId)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !record.Finished || record.WhoWin != game.Empty {
+        t.Errorf("game record is not a draw: %+v", record)
+    }
+}
+
+func TestResign(t *testing.T) {
+    botStorage, transport := newTestBot(t, DefaultConfig().Rules)
+    gameId := startTestGame(t, botStorage, transport)
+    play(t, botStorage, game.Move{I: 3, J: 3})
+
+    if err := handleResign(botStorage, testInput(testO)); err != nil {
+        t.Fatal(err)
+    }
+    expectCall(t, transport, testO, "send", english(i18n.YouResigned))
+    expectCall(t, transport, testX, "send", english(i18n.OpponentResigned))
+    record, err := botStorage.store.LoadGame(gameId)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !record.Finished || record.WhoWin != game.X {
+        t.Errorf("game record is not won by X: %+v", record)
+    }
+
+    transport.reset()
+    if err := handleResign(botStorage, testInput(testO)); err != nil {
+        t.Fatal(err)
+    }
+    expectCall(t, transport, testO, "send", english(i18n.NotInGameToResign))
+    if calls := transport.to(testX, "send"); len(calls) != 0 {
+        t.Errorf("X was told about a second resignation: %+v", calls)
+    }
+}
+
+func TestQueueSurvivesRestart(t *testing.T) {
+    botStorage, transport := newTestBot(t, DefaultConfig().Rules)
+    botStorage.RegisterUser(testInput(testX))
+    if err := startSeachingOpponent(botStorage, testInput(testX)); err != nil {
+        t.Fatal(err)
+    }
+
+    restarted, err := NewTicTacToeBotStorage(botStorage.store, botStorage.config)
+    if err != nil {
+        t.Fatal(err)
+    }
+    restarted.transport = transport
+    restarted.selectorConfirm = confirmSelectors()
+    if state := restarted.getUserState(testX).State; state != SearchingGame {
+        t.Fatalf("the waiting user is in state %s after a restart", state)
+    }
+    restarted.RegisterUser(testInput(testO))
+    if err := startSeachingOpponent(restarted, testInput(testO)); err != nil {
+        t.Fatal(err)
+    }
+    for _, userId := range []int64{testX, testO} {
+        if userState := restarted.getUserState(userId); userState.State != InGame || userState.GameID == 0 {
+            t.Errorf("user %d did not get into a game: %s", userId, userState.State)
+        }
+    }
+    if queue, err := restarted.store.LoadQueue(); err != nil || len(queue) != 0 {
+        t.Errorf("queue after the match: %v %v", queue, err)
+    }
+}
+
+func TestHelpListsEnabledFeatures(t *testing.T) {
+    features := FeaturesConfig{Replay: true, TextMoves: true}
+    help := helpText(i18n.English, features)
+    for _, id := range []i18n.MessageID{i18n.Help, i18n.HelpReplay, i18n.HelpTextMoves} {
+        if !strings.Contains(help, english(id)) {
+            t.Errorf("help has no %q", english(id))
+        }
+    }
+    for _, command := range []string{"/language", "/theme", "/hint", "/puzzle", "/daily"} {
+        if strings.Contains(help, command) {
+            t.Errorf("help lists the disabled %s", command)
+        }
+    }
+}
+
+func TestPressOnOldBoardIsIgnored(t *testing.T) {
+    botStorage, transport := newTestBot(t, DefaultConfig().Rules)
+    startTestGame(t, botStorage, transport)
+    router := NewRouter()
+    router.LastMessage(func(input *Input) *MessageRef {
+        return botStorage.getUserState(getUserId(input)).LastBotMsg
+    })
+    cell := constructSelectorBoard(1, 1)[0][0]
+    router.CurrentAction(cell.Action, constructButtonHandler(0, 0, botStorage))
+
+    board := botStorage.getUserState(testX).LastBotMsg
+    if board == nil {
+        t.Fatal("X was not sent a board")
+    }
+    for _, ref := range []MessageRef{{}, {MessageID: "forged", ChatID: board.ChatID}, {MessageID: board.MessageID, ChatID: testO}, *board} {
+        press := testInput(testX)
+        press.Action, press.Message = cell.Action, ref
+        if err := router.Dispatch(press); err != nil {
+            t.Fatal(err)
+        }
+    }
+    if moves := botStorage.getUserState(testX).GameState.Moves; len(moves) != 1 {
+        t.Errorf("%d moves made, want only the one pressed on the board", len(moves))
+    }
+}
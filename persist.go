@@ -0,0 +1,186 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "io"
+    "log"
+    "os"
+    "path/filepath"
+    "time"
+
+    bolt "go.etcd.io/bbolt"
+)
+
+const saveBackups = 3
+
+type SaveFile struct {
+    Version int
+    UserId2UserState map[int64]UserState
+    UsersSearching map[int64]bool
+    Games []GameRecord `json:",omitempty"`
+}
+
+func backupPath(path string, n int) string {
+    return fmt.Sprintf("%s.%d", path, n)
+}
+
+func rotateBackups(path string) error {
+    for n := saveBackups - 1; n >= 1; n-- {
+        err := os.Rename(backupPath(path, n), backupPath(path, n + 1))
+        if err != nil && !os.IsNotExist(err) {
+            return err
+        }
+    }
+    os.Remove(backupPath(path, 1))
+    err := os.Link(path, backupPath(path, 1))
+    if err != nil && !os.IsNotExist(err) {
+        return err
+    }
+    return nil
+}
+
+func syncDir(dir string) error {
+    d, err := os.Open(dir)
+    if err != nil {
+        return err
+    }
+    defer d.Close()
+    return d.Sync()
+}
+
+func writeFileAtomic(path string, r io.Reader) error {
+    f, err := replaceFile(path, r)
+    if f != nil {
+        f.Close()
+    }
+    return err
+}
+
+// replaceFile writes r to a new file that takes the place of path, and
+// returns it open for writing at its end. Once the file has replaced path
+// it is returned even if an error follows.
+func replaceFile(path string, r io.Reader) (*os.File, error) {
+    dir := filepath.Dir(path)
+    f, err := os.CreateTemp(dir, filepath.Base(path) + ".tmp*")
+    if err != nil {
+        return nil, err
+    }
+    tmpPath := f.Name()
+
+    if _, err := io.Copy(f, r); err != nil {
+        f.Close()
+        os.Remove(tmpPath)
+        return nil, err
+    }
+    if err := f.Sync(); err != nil {
+        f.Close()
+        os.Remove(tmpPath)
+        return nil, err
+    }
+    if err := rotateBackups(path); err != nil {
+        f.Close()
+        os.Remove(tmpPath)
+        return nil, err
+    }
+    if err := os.Rename(tmpPath, path); err != nil {
+        f.Close()
+        os.Remove(tmpPath)
+        return nil, err
+    }
+    return f, syncDir(dir)
+}
+
+func LoadWithFallback(path string, v interface{}) (string, error) {
+    var firstErr error
+    for n := 0; n <= saveBackups; n++ {
+        candidate := path
+        if n > 0 {
+            candidate = backupPath(path, n)
+        }
+        b, err := os.ReadFile(candidate)
+        if err == nil && !json.Valid(b) {
+            err = fmt.Errorf("%s: truncated or malformed JSON", candidate)
+        }
+        if err == nil {
+            err = json.Unmarshal(b, v)
+        }
+        if err == nil {
+            if n > 0 {
+                log.Println("Loaded", path, "from backup", candidate)
+            }
+            return candidate, nil
+        }
+        if firstErr == nil {
+            firstErr = err
+        } else if !os.IsNotExist(err) {
+            log.Println("Skipping", candidate, err)
+        }
+    }
+    return "", firstErr
+}
+
+func OpenStoreWithFallback(path string, snapshotPath string) (*BoltStore, error) {
+    store, err := OpenBoltStore(path)
+    if err == bolt.ErrTimeout {
+        return nil, err
+    }
+    if err == nil {
+        if _, err = store.LoadUsers(); err == nil {
+            return store, nil
+        }
+        store.Close()
+    }
+
+    log.Println("Storage", path, "is unreadable, restoring from", snapshotPath, err)
+    if err := os.Rename(path, path + ".broken"); err != nil && !os.IsNotExist(err) {
+        return nil, err
+    }
+    store, err = OpenBoltStore(path)
+    if err != nil {
+        return nil, err
+    }
+    if err := ImportSave(snapshotPath, store); err != nil {
+        store.Close()
+        return nil, err
+    }
+    return store, nil
+}
+
+func (botStorage *TicTacToeBotStorage) Snapshot(path string) error {
+    games, err := botStorage.store.LoadGames()
+    if err != nil {
+        return err
+    }
+    // The stored states are never changed in place, so copying the maps is
+    // enough to write them without holding the lock.
+    saveFile := SaveFile{
+        Version: schemaVersion,
+        UserId2UserState: make(map[int64]UserState),
+        UsersSearching: make(map[int64]bool),
+        Games: games,
+    }
+    botStorage.mutex.Lock()
+    for userId, userState := range botStorage.UserId2UserState {
+        saveFile.UserId2UserState[userId] = userState
+    }
+    for userId, searching := range botStorage.UsersSearching {
+        saveFile.UsersSearching[userId] = searching
+    }
+    botStorage.mutex.Unlock()
+    return Save(path, saveFile)
+}
+
+func (botStorage *TicTacToeBotStorage) RunSnapshots(path string, interval time.Duration) {
+    for range time.Tick(interval) {
+        if err := botStorage.Snapshot(path); err != nil {
+            log.Println("Snapshot failed", err)
+            continue
+        }
+        if botStorage.events != nil {
+            if err := botStorage.events.Compact(); err != nil {
+                log.Println("Event log compaction failed", err)
+            }
+        }
+    }
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "log"
+    "math"
+    "math/rand"
+    "os"
+    "sort"
+    "strings"
+
+    game "./game"
+    i18n "./i18n"
+)
+
+const (
+    InPuzzle State = "InPuzzle"
+
+    puzzleDefaultRating = 1200
+    // puzzleK is how many rating points an attempt moves at most.
+    puzzleK = 32
+)
+
+// Puzzle is a "win in N" position: the side to move wins by playing the
+// odd moves of Solution, the even ones being the opponent's forced replies.
+type Puzzle struct {
+    ID string `json:"id"`
+    Rating int `json:"rating"`
+    // WinLength defaults to five in a row.
+    WinLength int `json:"win_length"`
+    // Board has a row per string, "X", "O" or "." per cell, row 1 first.
+    Board []string `json:"board"`
+    ToMove game.Cell `json:"to_move"`
+    Solution []string `json:"solution"`
+
+    solution []game.Move
+}
+
+// PuzzleProgress is where a user is in the puzzle they are solving. Once a
+// user leaves the solution for another winning line the bot answers with
+// the engine instead.
+type PuzzleProgress struct {
+    ID string
+    Step int
+    OffBook bool `json:",omitempty"`
+    // Daily marks an attempt at the daily challenge.
+    Daily bool `json:",omitempty"`
+}
+
+func (p *Puzzle) Position() game.GameState {
+    gs := game.GameState{Width: len(p.Board[0]), Height: len(p.Board), WinLength: p.WinLength}
+    gs.ResetGame()
+    for i, row := range p.Board {
+        for j := range row {
+            var cell game.Cell
+            cell.UnmarshalText([]byte(row[j:j + 1]))
+            gs.Board[i][j] = cell
+        }
+    }
+    gs.WhoTurn = p.ToMove
+    return gs
+}
+
+// Moves is the N of "win in N".
+func (p *Puzzle) Moves() int {
+    return (len(p.solution) + 1) / 2
+}
+
+func (p *Puzzle) validate() error {
+    if p.ID == "" {
+        return fmt.Errorf("puzzle without id")
+    }
+    if len(p.Board) < 3 || len(p.Board) > maxBoardSize {
+        return fmt.Errorf("puzzle %s: board must have 3 to %d rows", p.ID, maxBoardSize)
+    }
+    for _, row := range p.Board {
+        if len(row) != len(p.Board[0]) || len(row) < 3 || len(row) > maxBoardSize {
+            return fmt.Errorf("puzzle %s: rows must be 3 to %d cells long and equal", p.ID, maxBoardSize)
+        }
+        for _, c := range row {
+            if !strings.ContainsRune("XO.", c) {
+                return fmt.Errorf("puzzle %s: bad cell %q", p.ID, c)
+            }
+        }
+    }
+    if p.ToMove != game.X && p.ToMove != game.O {
+        return fmt.Errorf("puzzle %s: to_move must be X or O", p.ID)
+    }
+    if len(p.Solution) % 2 == 0 {
+        return fmt.Errorf("puzzle %s: the solution must end with a move of %s", p.ID, p.ToMove)
+    }
+
+    gs := p.Position()
+    if gs.CheckEnd(); gs.IsGameEnded {
+        return fmt.Errorf("puzzle %s: the game is already over", p.ID)
+    }
+    p.solution = nil
+    for k, text := range p.Solution {
+        m, ok := game.ParseMove(text)
+        if !ok || !gs.MakeMove(m.I, m.J) {
+            return fmt.Errorf("puzzle %s: bad move %q", p.ID, text)
+        }
+        if gs.IsGameEnded != (k == len(p.Solution) - 1) || gs.IsGameEnded && gs.WhoWin != p.ToMove {
+            return fmt.Errorf("puzzle %s: the solution must win with its last move", p.ID)
+        }
+        p.solution = append(p.solution, m)
+    }
+    return nil
+}
+
+func LoadPuzzles(path string) ([]Puzzle, error) {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return nil, err
+    }
+    var puzzles []Puzzle
+    if err := json.Unmarshal(data, &puzzles); err != nil {
+        return nil, fmt.Errorf("%s: %v", path, err)
+    }
+    for k := range puzzles {
+        if puzzles[k].WinLength == 0 {
+            puzzles[k].WinLength = 5
+        }
+        if err := puzzles[k].validate(); err != nil {
+            return nil, fmt.Errorf("%s: %v", path, err)
+        }
+    }
+    return puzzles, nil
+}
+
+func findPuzzle(puzzles []Puzzle, id string) (*Puzzle, bool) {
+    for k := range puzzles {
+        if puzzles[k].ID == id {
+            return &puzzles[k], true
+        }
+    }
+    return nil, false
+}
+
+func (botStorage *TicTacToeBotStorage) progressPuzzle(progress *PuzzleProgress) (*Puzzle, bool) {
+    if progress.Daily {
+        return findPuzzle(botStorage.dailyPuzzles, progress.ID)
+    }
+    return findPuzzle(botStorage.puzzles, progress.ID)
+}
+
+// pickPuzzle offers one of the three puzzles rated closest to the user,
+// not the one they have just tried.
+func (botStorage *TicTacToeBotStorage) pickPuzzle(rating int, last string) *Puzzle {
+    var choice []*Puzzle
+    for k := range botStorage.puzzles {
+        if botStorage.puzzles[k].ID != last || len(botStorage.puzzles) == 1 {
+            choice = append(choice, &botStorage.puzzles[k])
+        }
+    }
+    sort.Slice(choice, func(a, b int) bool {
+        return math.Abs(float64(choice[a].Rating - rating)) < math.Abs(float64(choice[b].Rating - rating))
+    })
+    if len(choice) > 3 {
+        choice = choice[:3]
+    }
+    return choice[rand.Intn(len(choice))]
+}
+
+func (us *UserState) puzzleRating() int {
+    if us.PuzzleRating == 0 {
+        return puzzleDefaultRating
+    }
+    return us.PuzzleRating
+}
+
+// ratePuzzle moves the user's rating as if they had played the puzzle: up
+// for a solution, down for a miss, more so against an easy puzzle.
+func ratePuzzle(us *UserState, p *Puzzle, solved bool) int {
+    rating := us.puzzleRating()
+    expected := 1 / (1 + math.Pow(10, float64(p.Rating - rating) / 400))
+    score := 0.0
+    if solved {
+        score = 1
+    }
+    delta := int(math.Round(puzzleK * (score - expected)))
+    us.PuzzleRating = rating + delta
+    return delta
+}
+
+func puzzleKeyboard(lang i18n.Lang) Keyboard {
+    return Keyboard{{{Text: i18n.T(lang, i18n.NextPuzzle), Action: "puzzle"}}}
+}
+
+func startPuzzle(botStorage *TicTacToeBotStorage, input *Input, id string) error {
+    userState := botStorage.RegisterUser(input)
+    lang := userState.Lang()
+    if userState.State == InGame {
+        return SendEditable(botStorage, &userState, NewMessage, MessageNotEditable, i18n.T(lang, i18n.PuzzleInGame))
+    }
+    if len(botStorage.puzzles) == 0 {
+        return SendEditable(botStorage, &userState, NewMessage, MessageNotEditable, i18n.T(lang, i18n.NoPuzzles))
+    }
+    p, ok := findPuzzle(botStorage.puzzles, id)
+    if !ok {
+        p = botStorage.pickPuzzle(userState.puzzleRating(), userState.LastPuzzle)
+    }
+    return playPuzzle(botStorage, &userState, p, PuzzleProgress{ID: p.ID}, "")
+}
+
+// playPuzzle sets p up on the user's board; intro goes above the usual
+// puzzle introduction.
+func playPuzzle(botStorage *TicTacToeBotStorage, userState *UserState, p *Puzzle, progress PuzzleProgress, intro string) error {
+    lang := userState.Lang()
+    botStorage.stopSearching(userState.User.ID)
+    userState.State = InPuzzle
+    userState.Puzzle = &progress
+    userState.GameState = p.Position()
+    userState.WhoMe = p.ToMove
+    userState.LastX, userState.LastY = -1, -1
+    userState.Selector = nil
+    rebuildSelector(userState)
+    botStorage.setUserState(userState.User.ID, *userState)
+    text := i18n.N(lang, i18n.PuzzleIntro, p.Moves(), p.ToMove, p.ID, p.Rating) + "\n" + i18n.T(lang, i18n.YourTurn)
+    if intro != "" {
+        text = intro + "\n" + text
+    }
+    return SendEditable(botStorage, userState, NewMessage, MessageEditable, text, userState.Selector)
+}
+
+// finishPuzzle shows the final board with the verdict and the new rating.
+func finishPuzzle(botStorage *TicTacToeBotStorage, userState *UserState, p *Puzzle, solved bool) error {
+    if userState.Puzzle != nil && userState.Puzzle.Daily {
+        return finishDaily(botStorage, userState, p, solved)
+    }
+    lang := userState.Lang()
+    delta := ratePuzzle(userState, p, solved)
+    verdict := i18n.T(lang, i18n.PuzzleSolved, userState.PuzzleRating, delta)
+    if !solved {
+        verdict = i18n.T(lang, i18n.PuzzleFailed, strings.Join(p.Solution, " "), userState.PuzzleRating, delta)
+    }
+    userState.State = Start
+    userState.Puzzle = nil
+    userState.LastPuzzle = p.ID
+    botStorage.setUserState(userState.User.ID, *userState)
+    return SendEditable(botStorage, userState, EditPreviousMessage, MessageNotEditable,
+                        userState.GameState.ShowBoardToString(userState.Customization) + verdict, puzzleKeyboard(lang))
+}
+
+// handlePuzzleMove accepts the solution's move or any other that still
+// wins by fours within the puzzle's N moves, and answers with the forced
+// reply.
+func handlePuzzleMove(i int, j int, botStorage *TicTacToeBotStorage, input *Input) error {
+    userState := botStorage.getUserState(getUserId(input))
+    lang := userState.Lang()
+    progress := userState.Puzzle
+    p, ok := botStorage.progressPuzzle(progress)
+    if !ok {
+        log.Println("Puzzle", progress.ID, "is gone")
+        userState.State, userState.Puzzle = Start, nil
+        botStorage.setUserState(userState.User.ID, userState)
+        return SendEditable(botStorage, &userState, EditPreviousMessage, MessageNotEditable, i18n.T(lang, i18n.NoPuzzles))
+    }
+    gs := &userState.GameState
+    m := game.Move{I: i, J: j}
+    if i >= gs.Height || j >= gs.Width || gs.Board[i][j] != game.Empty {
+        return SendEditable(botStorage, &userState, NewMessage, MessageNotEditable, i18n.T(lang, i18n.InvalidMove))
+    }
+
+    onBook := !progress.OffBook && p.solution[progress.Step] == m
+    remaining := (len(p.solution) - progress.Step + 1) / 2
+    if remaining <= 1 {
+        // The last move must win at once, not start a longer win.
+        next := gs.Clone()
+        next.MakeMove(i, j)
+        if !next.IsGameEnded || next.WhoWin != userState.WhoMe {
+            return finishPuzzle(botStorage, &userState, p, false)
+        }
+    } else if !onBook && !gs.WinsWith(m, remaining - 1) {
+        return finishPuzzle(botStorage, &userState, p, false)
+    }
+    userState.MakeMove(i, j)
+    if gs.IsGameEnded {
+        return finishPuzzle(botStorage, &userState, p, gs.WhoWin == userState.WhoMe)
+    }
+
+    reply := game.Move{}
+    if onBook && progress.Step + 1 < len(p.solution) {
+        reply = p.solution[progress.Step + 1]
+    } else if best, ok := (game.HeuristicEngine{}).BestMove(gs); ok {
+        progress.OffBook = true
+        reply = best
+    } else {
+        return finishPuzzle(botStorage, &userState, p, false)
+    }
+    userState.MakeMove(reply.I, reply.J)
+    progress.Step += 2
+    userState.LastX, userState.LastY = reply.I, reply.J
+    rebuildSelector(&userState)
+    botStorage.setUserState(userState.User.ID, userState)
+    if gs.IsGameEnded || progress.Step >= len(p.solution) {
+        return finishPuzzle(botStorage, &userState, p, false)
+    }
+    text := i18n.T(lang, i18n.PuzzleReply, reply) + "\n" + i18n.T(lang, i18n.YourTurn)
+    return SendEditable(botStorage, &userState, EditPreviousMessage, MessageEditable, text, userState.Selector)
+}
+
+// resignPuzzle gives the current puzzle up; it counts as a miss.
+func resignPuzzle(botStorage *TicTacToeBotStorage, input *Input) error {
+    userState := botStorage.getUserState(getUserId(input))
+    p, ok := botStorage.progressPuzzle(userState.Puzzle)
+    if !ok {
+        userState.State, userState.Puzzle = Start, nil
+        botStorage.setUserState(userState.User.ID, userState)
+        return nil
+    }
+    return finishPuzzle(botStorage, &userState, p, false)
+}
+
+func registerPuzzleHandlers(router *Router, botStorage *TicTacToeBotStorage) {
+    router.Command("/puzzle", func(input *Input) error {
+        return startPuzzle(botStorage, input, strings.TrimSpace(input.Payload))
+    })
+    router.Action("puzzle", func(input *Input) error {
+        return startPuzzle(botStorage, input, "")
+    })
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+    "testing"
+
+    game "./game"
+)
+
+// doubleFour is a win in 1 at e1 where d3 makes a second four instead and
+// would only win a move later.
+func doubleFour(t *testing.T) Puzzle {
+    p := Puzzle{
+        ID: "double-four",
+        Rating: 1200,
+        WinLength: 5,
+        Board: []string{"XXXX....", "........", "XXX.....", "........", "........", "........", ".O.O.O..", "O.O.O.O."},
+        ToMove: game.X,
+        Solution: []string{"e1"},
+    }
+    if err := p.validate(); err != nil {
+        t.Fatal(err)
+    }
+    return p
+}
+
+func TestPuzzleMustBeSolvedInN(t *testing.T) {
+    for _, test := range []struct {
+        name string
+        i, j int
+        solved bool
+    }{
+        {"in N", 0, 4, true},
+        {"in N+1", 2, 3, false},
+    } {
+        t.Run(test.name, func(t *testing.T) {
+            botStorage, transport := newTestBot(t, DefaultConfig().Rules)
+            botStorage.puzzles = []Puzzle{doubleFour(t)}
+            input := testInput(testX)
+            if err := startPuzzle(botStorage, input, "double-four"); err != nil {
+                t.Fatal(err)
+            }
+            if err := handlePuzzleMove(test.i, test.j, botStorage, input); err != nil {
+                t.Fatal(err)
+            }
+            userState := botStorage.getUserState(testX)
+            if userState.State != Start || userState.Puzzle != nil {
+                t.Fatalf("the puzzle goes on after the move: %v", userState.State)
+            }
+            if solved := userState.PuzzleRating > puzzleDefaultRating; solved != test.solved {
+                t.Errorf("solved is %v, want %v (rating %d)", solved, test.solved, userState.PuzzleRating)
+            }
+            if !test.solved {
+                // The verdict shows the solution.
+                expectCall(t, transport, testX, "edit", "e1")
+            }
+        })
+    }
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+    "fmt"
+    "log"
+    "strconv"
+    "strings"
+
+    game "./game"
+    i18n "./i18n"
+)
+
+const (
+    replayAnalysed = "a"
+    // analysisCacheSize is how many analysed games are kept for stepping
+    // through them.
+    analysisCacheSize = 64
+)
+
+// gameAnalysis rates the moves a game had after its opening.
+type gameAnalysis struct {
+    opening int
+    moves []game.MoveAnalysis
+}
+
+// move is the analysis of move n of the game, counting from 1.
+func (analysis *gameAnalysis) move(n int) (game.MoveAnalysis, bool) {
+    k := n - 1 - analysis.opening
+    if k < 0 || k >= len(analysis.moves) {
+        return game.MoveAnalysis{}, false
+    }
+    return analysis.moves[k], true
+}
+
+func analyseGame(record *GameRecord) *gameAnalysis {
+    opening := record.OpeningLength()
+    gs := game.GameState{Width: record.Width, Height: record.Height, WinLength: record.WinLength}
+    gs.Replay(record.Moves[:opening])
+    return &gameAnalysis{opening: opening, moves: gs.Analyse(record.Moves[opening:])}
+}
+
+// analysis analyses a finished game once. A live game gets none: it would
+// give the players the engine's advice while they play.
+func (botStorage *TicTacToeBotStorage) analysis(record *GameRecord) *gameAnalysis {
+    if !record.Finished {
+        return nil
+    }
+    botStorage.mutex.Lock()
+    analysis, ok := botStorage.analyses[record.ID]
+    botStorage.mutex.Unlock()
+    if ok {
+        return analysis
+    }
+    analysis = analyseGame(record)
+    botStorage.mutex.Lock()
+    defer botStorage.mutex.Unlock()
+    if len(botStorage.analyses) >= analysisCacheSize {
+        for gameId := range botStorage.analyses {
+            delete(botStorage.analyses, gameId)
+            break
+        }
+    }
+    botStorage.analyses[record.ID] = analysis
+    return analysis
+}
+
+func boardPhoto(gs *game.GameState, caption string, highlights []game.Move) (Photo, error) {
+    opts := game.DefaultImageOptions
+    opts.Highlights = highlights
+    b, err := gs.PNG(opts)
+    return Photo{PNG: b, Caption: caption}, err
+}
+
+// constructReplaySelector steps through a game from move first, the one
+// after the opening, and offers a finished game's analysis; with analysis it
+// stays in the analysis view and can jump to the next mistake.
+func constructReplaySelector(gameId int64, n int, first int, total int, finished bool, analysis *gameAnalysis) Keyboard {
+    data := func(to int, mode string) string {
+        return strconv.FormatInt(gameId, 10) + "|" + strconv.Itoa(to) + mode
+    }
+    mode := ""
+    if analysis != nil {
+        mode = "|" + replayAnalysed
+    }
+    button := func(text string, to int) Button {
+        if to < first || to > total || to == n {
+            to = -1
+        }
+        return Button{Text: text, Action: "replay", Data: data(to, mode)}
+    }
+    selector := Keyboard{{
+        button("⏮", first),
+        button("◀", n - 1),
+        button("▶", n + 1),
+        button("⏭", total),
+    }}
+    if analysis == nil {
+        if !finished {
+            return selector
+        }
+        return append(selector, []Button{{Text: "🔍", Action: "replay", Data: data(n, "|" + replayAnalysed)}})
+    }
+    for k := n + 1; k <= total; k++ {
+        if a, ok := analysis.move(k); ok && a.Mistake() {
+            return append(selector, []Button{button("⚠", k)})
+        }
+    }
+    return selector
+}
+
+// replayFrame shows the board after n moves; an analysis adds the engine's
+// view of move n and marks the cell it preferred. The opening's stones are
+// not counted as moves of the players.
+func replayFrame(record *GameRecord, n int, analysis *gameAnalysis, lang i18n.Lang) (Photo, Keyboard, error) {
+    gs := game.GameState{Width: record.Width, Height: record.Height, WinLength: record.WinLength}
+    gs.Replay(record.Moves[:n])
+    first := record.OpeningLength()
+    caption := i18n.T(lang, i18n.ReplayCaption, record.ID, n - first, len(record.Moves) - first)
+    if n == first && record.Opening != "" {
+        caption += "\n" + i18n.T(lang, i18n.OpeningName, record.Opening)
+    }
+    if analysis == nil {
+        photo, err := boardPhoto(&gs, caption, nil)
+        return photo, constructReplaySelector(record.ID, n, first, len(record.Moves), record.Finished, nil), err
+    }
+    var highlights []game.Move
+    if a, ok := analysis.move(n); ok && a.Best != a.Move {
+        highlights = append(highlights, a.Best)
+    }
+    photo, err := boardPhoto(&gs, caption + "\n" + analysisText(analysis, n, lang), highlights)
+    return photo, constructReplaySelector(record.ID, n, first, len(record.Moves), record.Finished, analysis), err
+}
+
+// analysisText describes move n of the analysed game, or lists the mistakes
+// before the players' first move.
+func analysisText(analysis *gameAnalysis, n int, lang i18n.Lang) string {
+    if n <= analysis.opening {
+        var mistakes []string
+        for k, a := range analysis.moves {
+            if a.Mistake() {
+                mistakes = append(mistakes, fmt.Sprintf("%d. %s %s", k + 1, a.Who, a.Move))
+            }
+        }
+        if len(mistakes) == 0 {
+            return i18n.T(lang, i18n.AnalysisClean)
+        }
+        return i18n.T(lang, i18n.AnalysisMistakes, strings.Join(mistakes, ", "))
+    }
+    a, ok := analysis.move(n)
+    if !ok {
+        return ""
+    }
+    lines := []string{i18n.T(lang, i18n.AnalysisMove, a.Who, a.Move, a.Quality, a.Best)}
+    if a.Best == a.Move {
+        lines[0] = i18n.T(lang, i18n.AnalysisBestMove, a.Who, a.Move)
+    }
+    if a.MissedWin {
+        lines = append(lines, i18n.T(lang, i18n.AnalysisMissedWin))
+    }
+    if a.AllowedWin {
+        lines = append(lines, i18n.T(lang, i18n.AnalysisAllowedWin))
+    }
+    return strings.Join(lines, "\n")
+}
+
+func sendFinalBoard(botStorage *TicTacToeBotStorage, userState *UserState) {
+    if userState.LastBotMsg != nil {
+        botStorage.transport.Delete(*userState.LastBotMsg)
+        userState.LastBotMsg = nil
+        userState.LastBotText = ""
+        botStorage.setUserState(userState.User.ID, *userState)
+    }
+
+    if !botStorage.config.Features.Replay {
+        SendEditable(botStorage, userState, EditPreviousMessage, MessageNotEditable,
+                     userState.GameState.ShowBoardToString(userState.Customization))
+        return
+    }
+    record, err := botStorage.store.LoadGame(userState.GameID)
+    if err == nil {
+        var photo Photo
+        var selector Keyboard
+        if photo, selector, err = replayFrame(&record, len(record.Moves), nil, userState.Lang()); err == nil {
+            _, err = botStorage.transport.SendPhoto(*userState.User, photo, selector)
+        }
+    }
+    if err != nil {
+        log.Println("Failed to send board image", userState.GameID, err)
+        SendEditable(botStorage, userState, EditPreviousMessage, MessageNotEditable,
+                     userState.GameState.ShowBoardToString(userState.Customization))
+    }
+}
+
+// canReplay lets players see their own games and admins any game.
+func (botStorage *TicTacToeBotStorage) canReplay(user *User, record *GameRecord) bool {
+    if record.XUserID == user.ID || record.OUserID == user.ID {
+        return true
+    }
+    return botStorage.config.IsAdmin(user)
+}
+
+// parseReplayData reads "game|move", with "|a" in the analysis view.
+func parseReplayData(data string) (int64, int, bool, error) {
+    parts := strings.Split(data, "|")
+    if len(parts) != 2 && (len(parts) != 3 || parts[2] != replayAnalysed) {
+        return 0, 0, false, fmt.Errorf("bad replay data %q", data)
+    }
+    gameId, err := strconv.ParseInt(parts[0], 10, 64)
+    if err != nil {
+        return 0, 0, false, err
+    }
+    n, err := strconv.Atoi(parts[1])
+    return gameId, n, len(parts) == 3, err
+}
+
+func registerReplayHandlers(router *Router, botStorage *TicTacToeBotStorage) {
+    router.Command("/replay", func(input *Input) error {
+        userState := botStorage.RegisterUser(input)
+        gameId := userState.GameID
+        if id, err := strconv.ParseInt(input.Payload, 10, 64); err == nil {
+            gameId = id
+        }
+        record, err := botStorage.store.LoadGame(gameId)
+        if gameId != userState.GameID && (err != nil || !botStorage.canReplay(userState.User, &record)) {
+            return SendEditable(botStorage, &userState, NewMessage, MessageNotEditable, i18n.T(userState.Lang(), i18n.NotYourGame, gameId))
+        }
+        if err != nil {
+            return SendEditable(botStorage, &userState, NewMessage, MessageNotEditable, i18n.T(userState.Lang(), i18n.NoGamesToReplay))
+        }
+        photo, selector, err := replayFrame(&record, len(record.Moves), nil, userState.Lang())
+        if err != nil {
+            return err
+        }
+        _, err = botStorage.transport.SendPhoto(*userState.User, photo, selector)
+        return err
+    })
+    router.Action("replay", func(input *Input) error {
+        gameId, n, analysed, err := parseReplayData(input.Data)
+        if err != nil {
+            return err
+        }
+        record, err := botStorage.store.LoadGame(gameId)
+        if err != nil {
+            return err
+        }
+        userState := botStorage.RegisterUser(input)
+        if n < record.OpeningLength() || n > len(record.Moves) || !botStorage.canReplay(userState.User, &record) {
+            return nil
+        }
+        var analysis *gameAnalysis
+        if analysed {
+            if analysis = botStorage.analysis(&record); analysis == nil {
+                return nil
+            }
+        }
+        photo, selector, err := replayFrame(&record, n, analysis, userState.Lang())
+        if err != nil {
+            return err
+        }
+        return botStorage.transport.EditPhoto(input.Message, photo, selector)
+    })
+}
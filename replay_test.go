@@ -0,0 +1,132 @@
+package main
+
+import (
+    "fmt"
+    "testing"
+
+    game "./game"
+    i18n "./i18n"
+)
+
+// openingRecord is a finished game from Kagetsu with two moves after it.
+func openingRecord() GameRecord {
+    opening, _ := game.FindOpening("Kagetsu")
+    gs := DefaultConfig().Rules.NewGameState()
+    gs.ResetGame()
+    moves, _ := opening.Place(&gs)
+    return GameRecord{
+        ID: 7,
+        Width: gs.Width,
+        Height: gs.Height,
+        WinLength: gs.WinLength,
+        Opening: opening.Name,
+        Moves: append(moves, game.Move{I: 2, J: 2}, game.Move{I: 5, J: 5}),
+        Finished: true,
+    }
+}
+
+func TestOpeningIsNotCounted(t *testing.T) {
+    record := openingRecord()
+    if x, o := record.MovesOf(game.X), record.MovesOf(game.O); x != 1 || o != 1 {
+        t.Errorf("X made %d moves and O %d, want 1 each", x, o)
+    }
+    photo, selector, err := replayFrame(&record, 3, nil, i18n.English)
+    if err != nil {
+        t.Fatal(err)
+    }
+    want := english(i18n.ReplayCaption, 7, 0, 2) + "\n" + english(i18n.OpeningName, "Kagetsu")
+    if photo.Caption != want {
+        t.Errorf("caption %q, want %q", photo.Caption, want)
+    }
+    if first, back := selector[0][0], selector[0][1]; first.Data != "7|-1" || back.Data != "7|-1" {
+        t.Errorf("replay steps back into the opening: %+v", selector[0])
+    }
+}
+
+func TestAnalysisSkipsOpening(t *testing.T) {
+    botStorage, _ := newTestBot(t, DefaultConfig().Rules)
+    record := openingRecord()
+
+    analysis := botStorage.analysis(&record)
+    if analysis.opening != 3 || len(analysis.moves) != 2 {
+        t.Fatalf("analysis covers %d opening stones and %d moves", analysis.opening, len(analysis.moves))
+    }
+    if _, ok := analysis.move(3); ok {
+        t.Errorf("the last opening stone is rated")
+    }
+    if a, ok := analysis.move(4); !ok || a.Move != (game.Move{I: 2, J: 2}) || a.Who != game.O {
+        t.Errorf("move 4 is rated as %+v", a)
+    }
+    if botStorage.analysis(&record) != analysis {
+        t.Errorf("a finished game was analysed again")
+    }
+}
+
+func TestReplayOnlyOwnGames(t *testing.T) {
+    botStorage, transport := newTestBot(t, DefaultConfig().Rules)
+    router := NewRouter()
+    registerReplayHandlers(router, botStorage)
+    gameId := startTestGame(t, botStorage, transport)
+    const stranger int64 = 3
+
+    for _, userId := range []int64{testO, stranger} {
+        input := testInput(userId)
+        input.Text = fmt.Sprintf("/replay %d", gameId)
+        if err := router.Dispatch(input); err != nil {
+            t.Fatal(err)
+        }
+    }
+    if len(transport.to(testO, "photo")) != 1 {
+        t.Errorf("a player cannot replay their game")
+    }
+    expectCall(t, transport, stranger, "send", english(i18n.NotYourGame, gameId))
+    if photos := transport.to(stranger, "photo"); len(photos) != 0 {
+        t.Errorf("somebody else's game was shown: %+v", photos)
+    }
+
+    press := testInput(stranger)
+    press.Action, press.Data = "replay", fmt.Sprintf("%d|0", gameId)
+    press.Message = MessageRef{MessageID: "1", ChatID: stranger}
+    if err := router.Dispatch(press); err != nil {
+        t.Fatal(err)
+    }
+    if edits := transport.to(stranger, "edit"); len(edits) != 0 {
+        t.Errorf("a replay button opened somebody else's game: %+v", edits)
+    }
+}
+
+func TestNoAnalysisOfLiveGames(t *testing.T) {
+    botStorage, transport := newTestBot(t, DefaultConfig().Rules)
+    router := NewRouter()
+    registerReplayHandlers(router, botStorage)
+    gameId := startTestGame(t, botStorage, transport)
+    play(t, botStorage, game.Move{I: 0, J: 0}, game.Move{I: 1, J: 1})
+    transport.reset()
+
+    replay := testInput(testX)
+    replay.Text = "/replay"
+    if err := router.Dispatch(replay); err != nil {
+        t.Fatal(err)
+    }
+    photos := transport.to(testX, "photo")
+    if len(photos) != 1 {
+        t.Fatalf("the live game was not shown: %+v", photos)
+    }
+    for _, row := range photos[0].Keyboard {
+        for _, button := range row {
+            if button.Text == "🔍" {
+                t.Errorf("the live game offers an analysis")
+            }
+        }
+    }
+
+    press := testInput(testX)
+    press.Action, press.Data = "replay", fmt.Sprintf("%d|2|%s", gameId, replayAnalysed)
+    press.Message = photos[0].Ref
+    if err := router.Dispatch(press); err != nil {
+        t.Fatal(err)
+    }
+    if edits := transport.to(testX, "edit"); len(edits) != 0 {
+        t.Errorf("the live game was analysed: %+v", edits)
+    }
+}
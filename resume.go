@@ -0,0 +1,40 @@
+package main
+
+import (
+    "log"
+
+    i18n "./i18n"
+)
+
+func (botStorage *TicTacToeBotStorage) ResumeGames() {
+    botStorage.mutex.Lock()
+    var userIds []int64
+    for userId, userState := range botStorage.UserId2UserState {
+        if userState.State == InGame && userState.User != nil {
+            userIds = append(userIds, userId)
+        }
+    }
+    botStorage.mutex.Unlock()
+
+    for _, userId := range userIds {
+        userState := botStorage.getUserState(userId)
+        opponentState := botStorage.getUserState(userState.OpponentUserID)
+        if opponentState.State != InGame || opponentState.GameID != userState.GameID {
+            log.Println("Cannot resume game", userState.GameID, "of user", userId)
+            userState.State = EndGame
+            botStorage.setUserState(userId, userState)
+            SendEditable(botStorage, &userState, NewMessage, MessageEditable,
+                         i18n.T(userState.Lang(), i18n.RestartGameLost) + " " + i18n.T(userState.Lang(), i18n.NewGameQuestion),
+                         botStorage.confirmSelector(&userState))
+            continue
+        }
+
+        log.Println("Resuming game", userState.GameID, "for user", userId)
+        if err := SendEditable(botStorage, &userState, NewMessage, MessageNotEditable,
+                               i18n.T(userState.Lang(), i18n.RestartResumed)); err != nil {
+            log.Println("Failed to notify", userId, err)
+            continue
+        }
+        sendTurnPrompt(botStorage, &userState)
+    }
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+    "bytes"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "strings"
+
+    i18n "./i18n"
+)
+
+const selfTestAPIToken = "selftest-api-token"
+
+// call makes an API request and decodes the answer into result, failing on
+// any other status than want.
+func (t *selfTest) call(method string, path string, token string, body interface{}, want int, result interface{}) error {
+    var payload bytes.Buffer
+    if body != nil {
+        json.NewEncoder(&payload).Encode(body)
+    }
+    request, err := http.NewRequest(method, "http://" + t.rest.Addr() + path, &payload)
+    if err != nil {
+        return err
+    }
+    if token != "" {
+        request.Header.Set("Authorization", "Bearer " + token)
+    }
+    response, err := http.DefaultClient.Do(request)
+    if err != nil {
+        return err
+    }
+    defer response.Body.Close()
+    if response.StatusCode != want {
+        var problem map[string]string
+        json.NewDecoder(response.Body).Decode(&problem)
+        return fmt.Errorf("%s %s: got %d (%s), want %d", method, path, response.StatusCode, problem["error"], want)
+    }
+    if result == nil {
+        return nil
+    }
+    return json.NewDecoder(response.Body).Decode(result)
+}
+
+// useAPI lists the users of every messenger, starts a game between alice
+// and bob through the API, plays a move for alice and checks both see it in
+// Telegram.
+func useAPI(t *selfTest) error {
+    if err := t.register(t.alice, t.bob); err != nil {
+        return err
+    }
+    t.command(t.carol, "start", nil)
+    if _, err := t.expectDiscord(t.carol, english(i18n.Hello)); err != nil {
+        return err
+    }
+    key, err := webCookie(t.web.Addr())
+    if err != nil {
+        return err
+    }
+    dave, err := dialWeb(t.web.Addr(), key, "Dave")
+    if err != nil {
+        return err
+    }
+    defer dave.Close()
+    seq, err := dave.text("/start")
+    if err != nil {
+        return err
+    }
+    if _, err := dave.expect(seq, english(i18n.Hello)); err != nil {
+        return err
+    }
+
+    if err := t.call("GET", "/api/users", "", nil, http.StatusUnauthorized, nil); err != nil {
+        return err
+    }
+    if err := t.call("GET", "/api/users", "wrong-token-wrong-token", nil, http.StatusUnauthorized, nil); err != nil {
+        return err
+    }
+    var users []apiUser
+    if err := t.call("GET", "/api/users", selfTestAPIToken, nil, http.StatusOK, &users); err != nil {
+        return err
+    }
+    platforms := make(map[string]bool)
+    for _, user := range users {
+        platforms[user.Platform] = true
+    }
+    if !platforms["telegram"] || !platforms[PlatformDiscord] || !platforms[PlatformWeb] {
+        return fmt.Errorf("users of some platforms are missing: %v", users)
+    }
+
+    t.mark = t.api.Seq()
+    var created apiGame
+    newGame := apiNewGame{XUserID: t.alice.ID, OUserID: t.bob.ID}
+    if err := t.call("POST", "/api/games", selfTestAPIToken, newGame, http.StatusCreated, &created); err != nil {
+        return err
+    }
+    if _, err := t.expectBoard(t.alice); err != nil {
+        return err
+    }
+    if err := t.call("POST", "/api/games", selfTestAPIToken, newGame, http.StatusConflict, nil); err != nil {
+        return err
+    }
+
+    movesPath := fmt.Sprintf("/api/games/%d/moves", created.ID)
+    if err := t.call("POST", movesPath, selfTestAPIToken, apiMove{UserID: t.bob.ID, Move: "a1"}, http.StatusConflict, nil); err != nil {
+        return err
+    }
+    if err := t.call("POST", movesPath, selfTestAPIToken, apiMove{UserID: t.alice.ID, Move: "z9"}, http.StatusBadRequest, nil); err != nil {
+        return err
+    }
+    t.mark = t.api.Seq()
+    var played apiGame
+    if err := t.call("POST", movesPath, selfTestAPIToken, apiMove{UserID: t.alice.ID, Move: "c2"}, http.StatusOK, &played); err != nil {
+        return err
+    }
+    if played.Board[1] != "..X....." || strings.Join(played.Moves, " ") != "c2" || played.Turn != "O" {
+        return fmt.Errorf("unexpected game after the move: %+v", played)
+    }
+    if _, err := t.expectBoard(t.bob); err != nil {
+        return err
+    }
+
+    t.send(t.bob, "/resign")
+    if _, err := t.expect(t.alice, english(i18n.OpponentResigned)); err != nil {
+        return err
+    }
+    var finished apiGame
+    if err := t.call("GET", fmt.Sprintf("/api/games/%d", created.ID), selfTestAPIToken, nil, http.StatusOK, &finished); err != nil {
+        return err
+    }
+    if !finished.Finished || finished.Result != "X" {
+        return fmt.Errorf("game is not won by X after the resignation: %+v", finished)
+    }
+    var games []apiGame
+    if err := t.call("GET", fmt.Sprintf("/api/games?user_id=%d", t.bob.ID), selfTestAPIToken, nil, http.StatusOK, &games); err != nil {
+        return err
+    }
+    if len(games) == 0 || games[len(games) - 1].ID != created.ID {
+        return fmt.Errorf("game %d is not among the games of bob", created.ID)
+    }
+    return nil
+}
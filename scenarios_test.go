@@ -0,0 +1,580 @@
+package main
+
+import (
+    "fmt"
+    "io"
+    "log"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+    "time"
+
+    fakeapi "./internal/testfakes/fakeapi"
+    fakediscord "./internal/testfakes/fakediscord"
+    game "./game"
+    i18n "./i18n"
+)
+
+const selfTestTimeout = 5 * time.Second
+
+type selfTest struct {
+    api *fakeapi.Server
+    alice fakeapi.User
+    bob fakeapi.User
+    x fakeapi.User
+    o fakeapi.User
+    discord *fakediscord.Server
+    carol fakediscord.User
+    web *WebTransport
+    rest *APIServer
+    // mark is the message sequence number before the last action; expectations
+    // only look at messages changed after it.
+    mark int
+}
+
+type scenario struct {
+    name string
+    run func(t *selfTest) error
+}
+
+func english(id i18n.MessageID, args ...interface{}) string {
+    return i18n.T(i18n.English, id, args...)
+}
+
+func (t *selfTest) send(user fakeapi.User, text string) {
+    t.mark = t.api.Seq()
+    t.api.SendText(user, text)
+}
+
+func (t *selfTest) press(user fakeapi.User, message fakeapi.Message, data string) {
+    t.mark = t.api.Seq()
+    t.api.Press(user, message, data)
+}
+
+func (t *selfTest) pressButton(user fakeapi.User, message fakeapi.Message, text string) error {
+    button, ok := message.Button(text)
+    if !ok {
+        return fmt.Errorf("no %q button under %q", text, message.Text)
+    }
+    t.press(user, message, button.Data)
+    return nil
+}
+
+func (t *selfTest) expect(user fakeapi.User, text string) (fakeapi.Message, error) {
+    m, err := t.api.WaitFor(user.ID, t.mark, selfTestTimeout, func(m fakeapi.Message) bool {
+        return strings.Contains(m.Text, text)
+    })
+    if err != nil {
+        return m, fmt.Errorf("%s did not get %q: %v", user.FirstName, text, err)
+    }
+    return m, nil
+}
+
+func (t *selfTest) expectBoard(user fakeapi.User) (fakeapi.Message, error) {
+    m, err := t.api.WaitFor(user.ID, t.mark, selfTestTimeout, func(m fakeapi.Message) bool {
+        return m.Text == english(i18n.YourTurn) && len(m.Keyboard) > 0
+    })
+    if err != nil {
+        return m, fmt.Errorf("%s did not get the board: %v", user.FirstName, err)
+    }
+    return m, nil
+}
+
+// pressCell plays cell (i, j) by pressing the board button.
+func (t *selfTest) pressCell(user fakeapi.User, i int, j int) error {
+    board, err := t.expectBoardSince(user, 0)
+    if err != nil {
+        return err
+    }
+    t.press(user, board, board.Keyboard[i][j].Data)
+    _, err = t.expect(user, english(i18n.WaitingOpponentMove))
+    return err
+}
+
+// move plays cell (i, j) for the side to move and waits until the turn
+// passes to the opponent.
+func (t *selfTest) move(user fakeapi.User, opponent fakeapi.User, i int, j int) error {
+    if err := t.pressCell(user, i, j); err != nil {
+        return err
+    }
+    _, err := t.expectBoard(opponent)
+    return err
+}
+
+func (t *selfTest) expectBoardSince(user fakeapi.User, seq int) (fakeapi.Message, error) {
+    mark := t.mark
+    t.mark = seq
+    defer func() { t.mark = mark }()
+    return t.expectBoard(user)
+}
+
+func (t *selfTest) command(user fakediscord.User, name string, options map[string]string) {
+    t.mark = t.discord.Seq()
+    t.discord.Command(user, name, options)
+}
+
+func (t *selfTest) expectDiscord(user fakediscord.User, text string) (fakediscord.Message, error) {
+    m, err := t.discord.WaitFor(user, t.mark, selfTestTimeout, func(m fakediscord.Message) bool {
+        return strings.Contains(m.Content, text)
+    })
+    if err != nil {
+        return m, fmt.Errorf("%s did not get %q: %v", user.Username, text, err)
+    }
+    return m, nil
+}
+
+// discordMove plays a cell from the select menus under carol's board.
+func (t *selfTest) discordMove(cell string) error {
+    board, err := t.discord.WaitFor(t.carol, 0, selfTestTimeout, func(m fakediscord.Message) bool {
+        return strings.HasPrefix(m.Content, english(i18n.YourTurn)) && len(m.Components) > 0
+    })
+    if err != nil {
+        return fmt.Errorf("%s did not get the board: %v", t.carol.Username, err)
+    }
+    menu, option, ok := board.Option(cell)
+    if !ok {
+        return fmt.Errorf("no %s under the board", cell)
+    }
+    t.mark = t.discord.Seq()
+    t.discord.Select(t.carol, board, menu, option)
+    _, err = t.expectDiscord(t.carol, english(i18n.WaitingOpponentMove))
+    return err
+}
+
+// register greets users with /start, which leaves them on the new game
+// question.
+func (t *selfTest) register(users ...fakeapi.User) error {
+    for _, user := range users {
+        t.send(user, "/start")
+        if _, err := t.expect(user, english(i18n.Hello)); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// newGame registers alice and bob and starts a game between them.
+func (t *selfTest) newGame() error {
+    if err := t.register(t.alice, t.bob); err != nil {
+        return err
+    }
+    return t.startGame(t.alice, t.bob)
+}
+
+// startGame takes two users sitting on the new game question into a game
+// and records who plays X.
+func (t *selfTest) startGame(first fakeapi.User, second fakeapi.User) error {
+    t.x, t.o = fakeapi.User{}, fakeapi.User{}
+    for _, user := range []fakeapi.User{first, second} {
+        question, err := t.api.WaitFor(user.ID, 0, selfTestTimeout, func(m fakeapi.Message) bool {
+            _, ok := m.Button(english(i18n.Yes))
+            return ok
+        })
+        if err != nil {
+            return err
+        }
+        if err := t.pressButton(user, question, english(i18n.Yes)); err != nil {
+            return err
+        }
+        if user == first {
+            if _, err := t.expect(first, english(i18n.SearchingOpponent)); err != nil {
+                return err
+            }
+        }
+    }
+
+    mark := t.mark
+    for _, user := range []fakeapi.User{first, second} {
+        m, err := t.api.WaitFor(user.ID, mark, selfTestTimeout, func(m fakeapi.Message) bool {
+            return m.Text == english(i18n.YourTurn) || m.Text == english(i18n.WaitingOpponentMove)
+        })
+        if err != nil {
+            return fmt.Errorf("%s did not get into the game: %v", user.FirstName, err)
+        }
+        if m.Text == english(i18n.YourTurn) {
+            t.x = user
+        } else {
+            t.o = user
+        }
+    }
+    if t.x == t.o || t.x.ID == 0 || t.o.ID == 0 {
+        return fmt.Errorf("both players got the same side")
+    }
+    return nil
+}
+
+var scenarios = []scenario{
+    {"registration", func(t *selfTest) error {
+        t.send(t.alice, "/start")
+        hello, err := t.expect(t.alice, english(i18n.Hello))
+        if err != nil {
+            return err
+        }
+        if _, ok := hello.Button(english(i18n.Yes)); !ok {
+            return fmt.Errorf("greeting has no %q button", english(i18n.Yes))
+        }
+        t.send(t.bob, "/start")
+        _, err = t.expect(t.bob, english(i18n.Hello))
+        return err
+    }},
+    {"matchmaking", func(t *selfTest) error {
+        return t.newGame()
+    }},
+    {"turn order", func(t *selfTest) error {
+        if err := t.newGame(); err != nil {
+            return err
+        }
+        waiting, err := t.expect(t.o, english(i18n.WaitingOpponentMove))
+        if err != nil {
+            return err
+        }
+        t.press(t.o, waiting, "\f0")
+        _, err = t.expect(t.o, english(i18n.NotYourTurn))
+        return err
+    }},
+    {"moves", func(t *selfTest) error {
+        if err := t.newGame(); err != nil {
+            return err
+        }
+        if err := t.move(t.x, t.o, 0, 0); err != nil {
+            return err
+        }
+        t.send(t.o, "a1")
+        if _, err := t.expect(t.o, english(i18n.InvalidMove)); err != nil {
+            return err
+        }
+        t.send(t.o, "hello")
+        if _, err := t.expect(t.o, english(i18n.MoveNotUnderstood)); err != nil {
+            return err
+        }
+        t.send(t.o, "a2")
+        if _, err := t.expect(t.o, english(i18n.WaitingOpponentMove)); err != nil {
+            return err
+        }
+        _, err := t.expectBoard(t.x)
+        return err
+    }},
+    {"win", func(t *selfTest) error {
+        if err := t.newGame(); err != nil {
+            return err
+        }
+        for j := 0; j < 4; j++ {
+            if err := t.move(t.x, t.o, 0, j); err != nil {
+                return err
+            }
+            if err := t.move(t.o, t.x, 1, j); err != nil {
+                return err
+            }
+        }
+        board, err := t.expectBoardSince(t.x, 0)
+        if err != nil {
+            return err
+        }
+        t.press(t.x, board, board.Keyboard[0][4].Data)
+        if _, err := t.expect(t.x, i18n.N(i18n.English, i18n.YouWon, 5)); err != nil {
+            return err
+        }
+        if _, err := t.expect(t.o, english(i18n.YouLost)); err != nil {
+            return err
+        }
+        var final fakeapi.Message
+        for _, user := range []fakeapi.User{t.x, t.o} {
+            if final, err = t.api.WaitFor(user.ID, t.mark, selfTestTimeout, func(m fakeapi.Message) bool { return m.Photo }); err != nil {
+                return fmt.Errorf("%s did not get the final board: %v", user.FirstName, err)
+            }
+        }
+        if err := t.pressButton(t.o, final, "◀"); err != nil {
+            return err
+        }
+        frame, err := t.expect(t.o, english(i18n.ReplayCaption, 1, 8, 9))
+        if err != nil {
+            return err
+        }
+        // O's eighth move left X's four open.
+        if err := t.pressButton(t.o, frame, "🔍"); err != nil {
+            return err
+        }
+        _, err = t.expect(t.o, english(i18n.AnalysisAllowedWin))
+        return err
+    }},
+    {"hint", func(t *selfTest) error {
+        if err := t.newGame(); err != nil {
+            return err
+        }
+        for j := 0; j < 4; j++ {
+            if err := t.move(t.x, t.o, 0, j); err != nil {
+                return err
+            }
+            if err := t.move(t.o, t.x, 1, j); err != nil {
+                return err
+            }
+        }
+        t.send(t.o, "/hint")
+        if _, err := t.expect(t.o, english(i18n.NotYourTurn)); err != nil {
+            return err
+        }
+        t.send(t.x, "/hint")
+        hint, err := t.expect(t.x, english(i18n.HintMove, "e1", english(i18n.HintWin)))
+        if err != nil {
+            return err
+        }
+        if len(hint.Keyboard) == 0 || hint.Keyboard[0][4].Text != hintSymbol {
+            return fmt.Errorf("hint does not mark e1 on the board")
+        }
+        t.press(t.x, hint, hint.Keyboard[0][4].Data)
+        _, err = t.expect(t.x, i18n.N(i18n.English, i18n.YouWon, 5))
+        return err
+    }},
+    {"resign", func(t *selfTest) error {
+        if err := t.newGame(); err != nil {
+            return err
+        }
+        t.send(t.alice, "/resign")
+        if _, err := t.expect(t.alice, english(i18n.YouResigned)); err != nil {
+            return err
+        }
+        if _, err := t.expect(t.bob, english(i18n.OpponentResigned)); err != nil {
+            return err
+        }
+        t.send(t.bob, "/resign")
+        _, err := t.expect(t.bob, english(i18n.NotInGameToResign))
+        return err
+    }},
+    {"puzzle", func(t *selfTest) error {
+        t.send(t.bob, "/puzzle open-three")
+        puzzle, err := t.expect(t.bob, i18n.N(i18n.English, i18n.PuzzleIntro, 2, game.X, "open-three", 1000))
+        if err != nil {
+            return err
+        }
+        if len(puzzle.Keyboard) < 4 {
+            return fmt.Errorf("puzzle has no board")
+        }
+        t.press(t.bob, puzzle, puzzle.Keyboard[3][5].Data)
+        if _, err := t.expect(t.bob, english(i18n.PuzzleReply, "g4")); err != nil {
+            return err
+        }
+        t.send(t.bob, "b4")
+        solved, err := t.expect(t.bob, english(i18n.PuzzleSolved, 1208, 8))
+        if err != nil {
+            return err
+        }
+        if _, ok := solved.Button(english(i18n.NextPuzzle)); !ok {
+            return fmt.Errorf("no %q button after the puzzle", english(i18n.NextPuzzle))
+        }
+
+        t.send(t.bob, "/puzzle edge-four")
+        puzzle, err = t.expect(t.bob, i18n.N(i18n.English, i18n.PuzzleIntro, 1, game.X, "edge-four", 800))
+        if err != nil {
+            return err
+        }
+        t.press(t.bob, puzzle, puzzle.Keyboard[0][0].Data)
+        _, err = t.expect(t.bob, english(i18n.PuzzleFailed, "g3", 1179, -29))
+        return err
+    }},
+    {"daily", func(t *selfTest) error {
+        t.send(t.bob, "/daily on")
+        if _, err := t.expect(t.bob, english(i18n.DailySubscribed, "09:00")); err != nil {
+            return err
+        }
+        t.mark = t.api.Seq()
+        t.rest.botStorage.publishDaily(time.Now())
+        published, err := t.expect(t.bob, i18n.N(i18n.English, i18n.DailyPublished, 2))
+        if err != nil {
+            return err
+        }
+        date := dailyDay(time.Now(), 9 * time.Hour).Format(dailyDateFormat)
+        if err := t.pressButton(t.bob, published, english(i18n.DailyPlay)); err != nil {
+            return err
+        }
+        daily, err := t.expect(t.bob, english(i18n.DailyIntro, date, 1))
+        if err != nil {
+            return err
+        }
+        t.press(t.bob, daily, daily.Keyboard[0][0].Data)
+        failed, err := t.expect(t.bob, english(i18n.DailyFailed, 1))
+        if err != nil {
+            return err
+        }
+        if err := t.pressButton(t.bob, failed, english(i18n.DailyPlay)); err != nil {
+            return err
+        }
+        daily, err = t.expect(t.bob, english(i18n.DailyIntro, date, 2))
+        if err != nil {
+            return err
+        }
+        t.press(t.bob, daily, daily.Keyboard[3][5].Data)
+        if _, err := t.expect(t.bob, english(i18n.PuzzleReply, "g4")); err != nil {
+            return err
+        }
+        t.send(t.bob, "b4")
+        if _, err := t.expect(t.bob, "1. Bob — 2 attempts"); err != nil {
+            return err
+        }
+        t.send(t.bob, "/daily")
+        if _, err := t.expect(t.bob, english(i18n.DailyAlreadySolved)); err != nil {
+            return err
+        }
+        t.send(t.bob, "/daily top")
+        _, err = t.expect(t.bob, "1. Bob — 2 attempts")
+        return err
+    }},
+    {"discord", func(t *selfTest) error {
+        if err := t.register(t.alice); err != nil {
+            return err
+        }
+        t.command(t.carol, "start", nil)
+        hello, err := t.expectDiscord(t.carol, english(i18n.Hello))
+        if err != nil {
+            return err
+        }
+        if len(t.discord.Commands) == 0 {
+            return fmt.Errorf("no slash commands registered")
+        }
+        yes, ok := hello.Button(english(i18n.Yes))
+        if !ok {
+            return fmt.Errorf("greeting has no %q button", english(i18n.Yes))
+        }
+        t.mark = t.discord.Seq()
+        t.discord.Press(t.carol, hello, yes)
+        if _, err := t.expectDiscord(t.carol, english(i18n.SearchingOpponent)); err != nil {
+            return err
+        }
+
+        question, err := t.api.WaitFor(t.alice.ID, 0, selfTestTimeout, func(m fakeapi.Message) bool {
+            _, ok := m.Button(english(i18n.Yes))
+            return ok
+        })
+        if err != nil {
+            return err
+        }
+        if err := t.pressButton(t.alice, question, english(i18n.Yes)); err != nil {
+            return err
+        }
+        turn, err := t.discord.WaitFor(t.carol, 0, selfTestTimeout, func(m fakediscord.Message) bool {
+            return strings.HasPrefix(m.Content, english(i18n.YourTurn)) || m.Content == english(i18n.WaitingOpponentMove)
+        })
+        if err != nil {
+            return fmt.Errorf("%s did not get into the game: %v", t.carol.Username, err)
+        }
+
+        // Discord picks its first cell from the menu, Telegram answers with
+        // a button and Discord types its next move with /move.
+        carolCells, aliceRow := []string{"a1", "b1"}, 1
+        if !strings.HasPrefix(turn.Content, english(i18n.YourTurn)) {
+            carolCells, aliceRow = []string{"a2", "b2"}, 2
+            if err := t.pressCell(t.alice, 0, 0); err != nil {
+                return err
+            }
+        }
+        if err := t.discordMove(carolCells[0]); err != nil {
+            return err
+        }
+        if err := t.pressCell(t.alice, aliceRow, 0); err != nil {
+            return err
+        }
+        t.command(t.carol, "move", map[string]string{"cell": carolCells[1]})
+        if _, err := t.expectDiscord(t.carol, english(i18n.WaitingOpponentMove)); err != nil {
+            return err
+        }
+
+        t.command(t.carol, "resign", nil)
+        if _, err := t.expectDiscord(t.carol, english(i18n.YouResigned)); err != nil {
+            return err
+        }
+        _, err = t.expect(t.alice, english(i18n.OpponentResigned))
+        return err
+    }},
+    {"web", playWeb},
+    {"api", useAPI},
+}
+
+const selfTestPuzzles = `[
+  {"id": "edge-four", "rating": 800, "to_move": "X", "solution": ["g3"],
+   "board": ["........", "........", ".OXXXX..", "........", "..OO....", "....O...", "........", "........"]},
+  {"id": "open-three", "rating": 1000, "to_move": "X", "solution": ["f4", "g4", "b4"],
+   "board": ["........", ".....O..", "........", "..XXX...", "........", "..O.....", "...O....", "........"]}
+]`
+
+const selfTestDaily = `[
+  {"id": "daily-open-three", "rating": 1000, "to_move": "X", "solution": ["f4", "g4", "b4"],
+   "board": ["........", ".....O..", "........", "..XXX...", "........", "..O.....", "...O....", "........"]}
+]`
+
+// newSelfTest starts a real bot with its own storage in a temporary
+// directory, talking to an in-process fake Bot API, a Discord stand-in and
+// browsers over the WebSocket. Everything is stopped when t ends.
+func newSelfTest(t *testing.T) *selfTest {
+    api, err := fakeapi.NewServer("selftest")
+    if err != nil {
+        t.Fatal(err)
+    }
+    t.Cleanup(func() { api.Close() })
+    discord, err := fakediscord.NewServer("selftest")
+    if err != nil {
+        t.Fatal(err)
+    }
+    t.Cleanup(func() { discord.Close() })
+    dir := t.TempDir()
+
+    config := DefaultConfig()
+    config.Token = api.Token
+    config.APIURL = api.URL
+    config.Poller = PollerConfig{Mode: pollerLong, Timeout: time.Second}
+    config.Discord = DiscordConfig{Token: discord.Token, APIURL: discord.URL}
+    config.Web = WebConfig{Listen: "127.0.0.1:0"}
+    config.Features.HintPvP = true
+    config.API = APIConfig{Listen: "127.0.0.1:0", Tokens: []string{selfTestAPIToken}}
+    config.Puzzles = PuzzlesConfig{Path: filepath.Join(dir, "puzzles.json")}
+    if err := os.WriteFile(config.Puzzles.Path, []byte(selfTestPuzzles), 0644); err != nil {
+        t.Fatal(err)
+    }
+    config.Daily = DailyConfig{Time: "09:00", Path: filepath.Join(dir, "daily.json")}
+    if err := os.WriteFile(config.Daily.Path, []byte(selfTestDaily), 0644); err != nil {
+        t.Fatal(err)
+    }
+    config.Storage = StorageConfig{
+        Path: filepath.Join(dir, "storage.db"),
+        Snapshot: filepath.Join(dir, "snapshot.json"),
+        SnapshotInterval: time.Hour,
+        LegacySave: filepath.Join(dir, "save.json"),
+        EventLog: filepath.Join(dir, "events.log"),
+    }
+
+    log.SetOutput(io.Discard)
+    t.Cleanup(func() { log.SetOutput(os.Stderr) })
+    services, closeBot, err := newBot(config)
+    if err != nil {
+        t.Fatal(err)
+    }
+    t.Cleanup(closeBot)
+    st := &selfTest{
+        api: api,
+        discord: discord,
+        carol: fakediscord.User{ID: "201", Username: "carol", Locale: "en-US"},
+        alice: fakeapi.User{ID: 101, FirstName: "Alice", LanguageCode: "en"},
+        bob: fakeapi.User{ID: 102, FirstName: "Bob", LanguageCode: "en"},
+    }
+    for _, service := range services {
+        switch service := service.(type) {
+        case *WebTransport:
+            st.web = service
+        case *APIServer:
+            st.rest = service
+        }
+        go service.Start()
+        t.Cleanup(service.Stop)
+    }
+    return st
+}
+
+// TestScenarios plays the scenarios end to end, each against a bot of its own.
+func TestScenarios(t *testing.T) {
+    for _, scenario := range scenarios {
+        t.Run(scenario.name, func(t *testing.T) {
+            if err := scenario.run(newSelfTest(t)); err != nil {
+                t.Fatal(err)
+            }
+        })
+    }
+}
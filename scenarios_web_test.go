@@ -0,0 +1,271 @@
+package main
+
+import (
+    "fmt"
+    "net/http"
+    "net/url"
+    "strings"
+    "sync"
+    "time"
+
+    websocket "github.com/gorilla/websocket"
+    fakeapi "./internal/testfakes/fakeapi"
+    i18n "./i18n"
+)
+
+// webShown is a message as a browser shows it.
+type webShown struct {
+    webMessage
+    Seq int
+}
+
+// webPlayer plays in the browser UI over its WebSocket, keeping the messages
+// the way the page does.
+type webPlayer struct {
+    conn *websocket.Conn
+    mutex sync.Mutex
+    changed chan struct{}
+    seq int
+    messages []webShown
+}
+
+// webCookie loads the page as a new browser does and returns the key cookie
+// it is given.
+func webCookie(addr string) (*http.Cookie, error) {
+    response, err := http.Get("http://" + addr + "/")
+    if err != nil {
+        return nil, err
+    }
+    response.Body.Close()
+    for _, cookie := range response.Cookies() {
+        if cookie.Name == webKeyCookie && cookie.HttpOnly {
+            return cookie, nil
+        }
+    }
+    return nil, fmt.Errorf("the page set no key cookie: %v", response.Header["Set-Cookie"])
+}
+
+// dialWeb opens the WebSocket as the page at addr does, with origin as the
+// page's origin and the key cookie unless it is nil.
+func dialWeb(addr string, key *http.Cookie, name string) (*webPlayer, error) {
+    return dialWebFrom("http://" + addr, addr, key, name)
+}
+
+func dialWebFrom(origin string, addr string, key *http.Cookie, name string) (*webPlayer, error) {
+    query := url.Values{"name": {name}, "lang": {"en-GB"}}
+    header := http.Header{"Origin": {origin}}
+    if key != nil {
+        header.Set("Cookie", key.String())
+    }
+    conn, response, err := websocket.DefaultDialer.Dial("ws://" + addr + "/ws?" + query.Encode(), header)
+    if err != nil {
+        if response != nil {
+            return nil, fmt.Errorf("%v: %s", err, response.Status)
+        }
+        return nil, err
+    }
+    p := &webPlayer{conn: conn, changed: make(chan struct{})}
+    go p.read()
+    return p, nil
+}
+
+func (p *webPlayer) read() {
+    for {
+        var message webMessage
+        if err := p.conn.ReadJSON(&message); err != nil {
+            return
+        }
+        p.mutex.Lock()
+        p.seq++
+        switch message.Type {
+        case "reset":
+            p.messages = nil
+        case "message":
+            p.messages = append(p.messages, webShown{message, p.seq})
+        case "edit", "delete":
+            for k := range p.messages {
+                if p.messages[k].ID != message.ID {
+                    continue
+                }
+                if message.Type == "edit" {
+                    p.messages[k] = webShown{message, p.seq}
+                } else {
+                    p.messages = append(p.messages[:k], p.messages[k + 1:]...)
+                }
+                break
+            }
+        }
+        close(p.changed)
+        p.changed = make(chan struct{})
+        p.mutex.Unlock()
+    }
+}
+
+func (p *webPlayer) Close() error {
+    return p.conn.Close()
+}
+
+func (p *webPlayer) Seq() int {
+    p.mutex.Lock()
+    defer p.mutex.Unlock()
+    return p.seq
+}
+
+func (p *webPlayer) send(message webMessage) (int, error) {
+    seq := p.Seq()
+    return seq, p.conn.WriteJSON(message)
+}
+
+func (p *webPlayer) waitFor(seq int, match func(webShown) bool) (webShown, error) {
+    deadline := time.After(selfTestTimeout)
+    for {
+        p.mutex.Lock()
+        changed := p.changed
+        for k := len(p.messages) - 1; k >= 0; k-- {
+            if m := p.messages[k]; m.Seq > seq && match(m) {
+                p.mutex.Unlock()
+                return m, nil
+            }
+        }
+        p.mutex.Unlock()
+
+        select {
+        case <-changed:
+        case <-deadline:
+            return webShown{}, fmt.Errorf("no matching message in the browser after %v", selfTestTimeout)
+        }
+    }
+}
+
+func (p *webPlayer) expect(seq int, text string) (webShown, error) {
+    m, err := p.waitFor(seq, func(m webShown) bool { return strings.Contains(m.Text, text) })
+    if err != nil {
+        return m, fmt.Errorf("browser did not get %q: %v", text, err)
+    }
+    return m, nil
+}
+
+func (p *webPlayer) press(message webShown, button Button) (int, error) {
+    return p.send(webMessage{Type: "press", ID: message.ID, Action: button.Action, Data: button.Data})
+}
+
+func (p *webPlayer) text(text string) (int, error) {
+    return p.send(webMessage{Type: "text", Text: text})
+}
+
+func findButton(keyboard Keyboard, text string) (Button, bool) {
+    for _, row := range keyboard {
+        for _, button := range row {
+            if button.Text == text {
+                return button, true
+            }
+        }
+    }
+    return Button{}, false
+}
+
+// playWeb has a browser player meet alice from Telegram, reconnect in the
+// middle of the game and resign.
+func playWeb(t *selfTest) error {
+    if err := t.register(t.alice); err != nil {
+        return err
+    }
+    addr := t.web.Addr()
+    if p, err := dialWeb(addr, nil, "Mallory"); err == nil {
+        p.Close()
+        return fmt.Errorf("a browser without the key cookie connected")
+    }
+    key, err := webCookie(addr)
+    if err != nil {
+        return err
+    }
+    if p, err := dialWebFrom("http://evil.example", addr, key, "Mallory"); err == nil {
+        p.Close()
+        return fmt.Errorf("another site opened the WebSocket with the key cookie")
+    }
+    dave, err := dialWeb(addr, key, "Dave")
+    if err != nil {
+        return err
+    }
+    defer func() { dave.Close() }()
+
+    seq, err := dave.text("/start")
+    if err != nil {
+        return err
+    }
+    hello, err := dave.expect(seq, english(i18n.Hello))
+    if err != nil {
+        return err
+    }
+    yes, ok := findButton(hello.Keyboard, english(i18n.Yes))
+    if !ok {
+        return fmt.Errorf("greeting has no %q button", english(i18n.Yes))
+    }
+    if seq, err = dave.press(hello, yes); err != nil {
+        return err
+    }
+    if _, err := dave.expect(seq, english(i18n.SearchingOpponent)); err != nil {
+        return err
+    }
+
+    question, err := t.api.WaitFor(t.alice.ID, 0, selfTestTimeout, func(m fakeapi.Message) bool {
+        _, ok := m.Button(english(i18n.Yes))
+        return ok
+    })
+    if err != nil {
+        return err
+    }
+    if err := t.pressButton(t.alice, question, english(i18n.Yes)); err != nil {
+        return err
+    }
+    turn, err := dave.waitFor(0, func(m webShown) bool {
+        return m.Text == english(i18n.YourTurn) || m.Text == english(i18n.WaitingOpponentMove)
+    })
+    if err != nil {
+        return fmt.Errorf("browser did not get into the game: %v", err)
+    }
+
+    // The browser presses a cell, alice answers, the browser reconnects and
+    // types its next move.
+    if turn.Text != english(i18n.YourTurn) {
+        if err := t.pressCell(t.alice, 2, 0); err != nil {
+            return err
+        }
+    }
+    board, err := dave.waitFor(0, func(m webShown) bool { return m.Text == english(i18n.YourTurn) && len(m.Keyboard) > 0 })
+    if err != nil {
+        return fmt.Errorf("browser did not get the board: %v", err)
+    }
+    if seq, err = dave.press(board, board.Keyboard[0][0]); err != nil {
+        return err
+    }
+    if _, err := dave.expect(seq, english(i18n.WaitingOpponentMove)); err != nil {
+        return err
+    }
+    if err := t.pressCell(t.alice, 1, 0); err != nil {
+        return err
+    }
+
+    dave.Close()
+    if dave, err = dialWeb(addr, key, "Dave"); err != nil {
+        return err
+    }
+    if _, err := dave.waitFor(0, func(m webShown) bool { return m.Text == english(i18n.YourTurn) && len(m.Keyboard) > 0 }); err != nil {
+        return fmt.Errorf("board is gone after reconnecting: %v", err)
+    }
+    if seq, err = dave.text("h8"); err != nil {
+        return err
+    }
+    if _, err := dave.expect(seq, english(i18n.WaitingOpponentMove)); err != nil {
+        return err
+    }
+
+    if seq, err = dave.text("/resign"); err != nil {
+        return err
+    }
+    if _, err := dave.expect(seq, english(i18n.YouResigned)); err != nil {
+        return err
+    }
+    _, err = t.expect(t.alice, english(i18n.OpponentResigned))
+    return err
+}
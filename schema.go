@@ -0,0 +1,240 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "strconv"
+
+    game "./game"
+    bolt "go.etcd.io/bbolt"
+)
+
+// Version of the stored user and game records. Every change of their JSON
+// layout bumps it and appends a migration below.
+const schemaVersion = 2
+
+var (
+    metaBucket = []byte("meta")
+    schemaVersionKey = []byte("schema_version")
+)
+
+type rawRecord map[string]json.RawMessage
+
+type migration struct {
+    user func(user rawRecord) error
+    game func(game rawRecord) error
+}
+
+var migrations = []migration{
+    // 0 -> 1: keyboards are rebuilt from the board on load instead of being
+    // stored as rendered emoji.
+    {
+        user: func(user rawRecord) error {
+            delete(user, "Selector")
+            return nil
+        },
+    },
+    // 1 -> 2: cells are stored as "X", "O" and "." instead of emoji.
+    {
+        user: func(user rawRecord) error {
+            if err := migrateLegacyCell(user, "WhoMe"); err != nil {
+                return err
+            }
+            gameState := rawRecord{}
+            if err := json.Unmarshal(user["GameState"], &gameState); err != nil {
+                return err
+            }
+            for _, key := range []string{"WhoTurn", "WhoWin"} {
+                if err := migrateLegacyCell(gameState, key); err != nil {
+                    return err
+                }
+            }
+            var board [][]string
+            if err := json.Unmarshal(gameState["Board"], &board); err == nil {
+                cells := make([][]game.Cell, len(board))
+                for i := range board {
+                    cells[i] = make([]game.Cell, len(board[i]))
+                    for j := range board[i] {
+                        cell, ok := legacyCells[board[i][j]]
+                        if !ok {
+                            return fmt.Errorf("unknown cell %q", board[i][j])
+                        }
+                        cells[i][j] = cell
+                    }
+                }
+                gameState["Board"], _ = json.Marshal(cells)
+            }
+            var err error
+            user["GameState"], err = json.Marshal(gameState)
+            return err
+        },
+        game: func(game rawRecord) error {
+            return migrateLegacyCell(game, "WhoWin")
+        },
+    },
+}
+
+var legacyCells = map[string]game.Cell{
+    "": game.Empty,
+    "🌫": game.Empty,
+    "❌": game.X,
+    "⭕️": game.O,
+}
+
+func migrateLegacyCell(r rawRecord, key string) error {
+    raw, ok := r[key]
+    if !ok {
+        return nil
+    }
+    var symbol string
+    if err := json.Unmarshal(raw, &symbol); err != nil {
+        return nil
+    }
+    cell, ok := legacyCells[symbol]
+    if !ok {
+        return fmt.Errorf("unknown %s cell %q", key, symbol)
+    }
+    r[key], _ = json.Marshal(cell)
+    return nil
+}
+
+// Events are not versioned, they only live until the next compaction;
+// lines written by older versions are upgraded when read.
+func decodeEvent(line []byte, event *Event) error {
+    err := json.Unmarshal(line, event)
+    if err == nil {
+        return nil
+    }
+    r := rawRecord{}
+    if json.Unmarshal(line, &r) != nil || migrateLegacyCell(r, "WhoWin") != nil {
+        return err
+    }
+    upgraded, _ := json.Marshal(r)
+    *event = Event{}
+    return json.Unmarshal(upgraded, event)
+}
+
+func migrateRecord(data []byte, from int, pick func(m migration) func(rawRecord) error) ([]byte, error) {
+    if from == schemaVersion {
+        return data, nil
+    }
+    r := rawRecord{}
+    if err := json.Unmarshal(data, &r); err != nil {
+        return nil, err
+    }
+    for version := from; version < schemaVersion; version++ {
+        if apply := pick(migrations[version]); apply != nil {
+            if err := apply(r); err != nil {
+                return nil, fmt.Errorf("migration %d -> %d: %w", version, version + 1, err)
+            }
+        }
+    }
+    return json.Marshal(r)
+}
+
+func migrateUser(data []byte, from int) ([]byte, error) {
+    return migrateRecord(data, from, func(m migration) func(rawRecord) error { return m.user })
+}
+
+func migrateGame(data []byte, from int) ([]byte, error) {
+    return migrateRecord(data, from, func(m migration) func(rawRecord) error { return m.game })
+}
+
+func checkSchemaVersion(version int) error {
+    if version > schemaVersion {
+        return fmt.Errorf("data schema version %d is newer than supported %d", version, schemaVersion)
+    }
+    return nil
+}
+
+func migrateBucket(tx *bolt.Tx, name []byte, from int, migrate func([]byte, int) ([]byte, error)) error {
+    bucket := tx.Bucket(name)
+    updated := make(map[string][]byte)
+    err := bucket.ForEach(func(k, v []byte) error {
+        migrated, err := migrate(v, from)
+        if err != nil {
+            return fmt.Errorf("%s %x: %w", name, k, err)
+        }
+        updated[string(k)] = migrated
+        return nil
+    })
+    if err != nil {
+        return err
+    }
+    for k, v := range updated {
+        if err := bucket.Put([]byte(k), v); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+func migrateBolt(tx *bolt.Tx) error {
+    meta, err := tx.CreateBucketIfNotExists(metaBucket)
+    if err != nil {
+        return err
+    }
+
+    version := 0
+    if v := meta.Get(schemaVersionKey); v != nil {
+        if version, err = strconv.Atoi(string(v)); err != nil {
+            return err
+        }
+    } else if tx.Bucket(usersBucket).Stats().KeyN == 0 && tx.Bucket(gamesBucket).Stats().KeyN == 0 {
+        version = schemaVersion
+    }
+    if err := checkSchemaVersion(version); err != nil {
+        return err
+    }
+
+    if version < schemaVersion {
+        if err := migrateBucket(tx, usersBucket, version, migrateUser); err != nil {
+            return err
+        }
+        if err := migrateBucket(tx, gamesBucket, version, migrateGame); err != nil {
+            return err
+        }
+    }
+    return meta.Put(schemaVersionKey, []byte(strconv.Itoa(schemaVersion)))
+}
+
+type rawSaveFile struct {
+    Version int
+    UserId2UserState map[int64]json.RawMessage
+    UsersSearching map[int64]bool
+    Games []json.RawMessage
+}
+
+func (raw *rawSaveFile) migrate() (SaveFile, error) {
+    saveFile := SaveFile{
+        Version: schemaVersion,
+        UserId2UserState: make(map[int64]UserState),
+        UsersSearching: raw.UsersSearching,
+    }
+    if err := checkSchemaVersion(raw.Version); err != nil {
+        return saveFile, err
+    }
+    for userId, data := range raw.UserId2UserState {
+        migrated, err := migrateUser(data, raw.Version)
+        if err != nil {
+            return saveFile, fmt.Errorf("user %d: %w", userId, err)
+        }
+        var userState UserState
+        if err := json.Unmarshal(migrated, &userState); err != nil {
+            return saveFile, fmt.Errorf("user %d: %w", userId, err)
+        }
+        saveFile.UserId2UserState[userId] = userState
+    }
+    for _, data := range raw.Games {
+        migrated, err := migrateGame(data, raw.Version)
+        if err != nil {
+            return saveFile, err
+        }
+        var record GameRecord
+        if err := json.Unmarshal(migrated, &record); err != nil {
+            return saveFile, err
+        }
+        saveFile.Games = append(saveFile.Games, record)
+    }
+    return saveFile, nil
+}
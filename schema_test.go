@@ -0,0 +1,125 @@
+package main
+
+import (
+    "encoding/json"
+    "testing"
+
+    game "./game"
+)
+
+// The same game of alice as save.json stored it at every schema version:
+// X in the corner, O in the centre and X to move.
+var saveFiles = []struct {
+    version int
+    data string
+}{
+    {0, `{
+        "UserId2UserState": {"1": {
+            "GameState": {"Board": [["❌", "🌫", "🌫"], ["🌫", "⭕️", "🌫"], ["🌫", "🌫", "🌫"]],
+                          "Width": 3, "Height": 3, "WinLength": 3, "State": "InGame",
+                          "WhoTurn": "❌", "IsGameEnded": false, "WhoWin": ""},
+            "OpponentUserID": 2,
+            "User": {"id": 1, "first_name": "Alice"},
+            "WhoMe": "❌",
+            "State": "InGame",
+            "Selector": {"inline_keyboard": [[{"text": "❌", "callback_data": "0"}]]},
+            "LastX": 1, "LastY": 1,
+            "LastBotMsg": {"message_id": "5", "chat_id": 1},
+            "LastBotText": "Your turn"
+        }},
+        "UsersSearching": {}
+    }`},
+    {1, `{
+        "Version": 1,
+        "UserId2UserState": {"1": {
+            "GameState": {"Board": [["❌", "🌫", "🌫"], ["🌫", "⭕️", "🌫"], ["🌫", "🌫", "🌫"]],
+                          "Width": 3, "Height": 3, "WinLength": 3, "State": "InGame",
+                          "WhoTurn": "❌", "IsGameEnded": false, "WhoWin": ""},
+            "GameID": 4,
+            "OpponentUserID": 2,
+            "User": {"id": 1, "first_name": "Alice"},
+            "WhoMe": "❌",
+            "State": "InGame",
+            "LastX": 1, "LastY": 1,
+            "LastBotMsg": {"message_id": "5", "chat_id": 1},
+            "LastBotText": "Your turn"
+        }},
+        "Games": [{"ID": 4, "XUserID": 1, "OUserID": 2, "Finished": true, "WhoWin": "⭕️"}]
+    }`},
+    {2, `{
+        "Version": 2,
+        "UserId2UserState": {"1": {
+            "GameState": {"Board": [["X", ".", "."], [".", "O", "."], [".", ".", "."]],
+                          "Width": 3, "Height": 3, "WinLength": 3, "State": "InGame",
+                          "WhoTurn": "X", "IsGameEnded": false, "WhoWin": "."},
+            "GameID": 4,
+            "OpponentUserID": 2,
+            "User": {"id": 1, "first_name": "Alice"},
+            "WhoMe": "X",
+            "State": "InGame",
+            "LastX": 1, "LastY": 1,
+            "LastBotMsg": {"message_id": "5", "chat_id": 1},
+            "LastBotText": "Your turn"
+        }},
+        "Games": [{"ID": 4, "XUserID": 1, "OUserID": 2, "Finished": true, "WhoWin": "O"}]
+    }`},
+}
+
+func TestMigrateSaveFile(t *testing.T) {
+    for _, saveFile := range saveFiles {
+        raw := rawSaveFile{}
+        if err := json.Unmarshal([]byte(saveFile.data), &raw); err != nil {
+            t.Fatalf("version %d: %v", saveFile.version, err)
+        }
+        if raw.Version != saveFile.version {
+            t.Fatalf("fixture of version %d reads as version %d", saveFile.version, raw.Version)
+        }
+        migrated, err := raw.migrate()
+        if err != nil {
+            t.Errorf("version %d: %v", saveFile.version, err)
+            continue
+        }
+        if migrated.Version != schemaVersion {
+            t.Errorf("version %d is migrated to %d", saveFile.version, migrated.Version)
+        }
+        alice, ok := migrated.UserId2UserState[1]
+        if !ok {
+            t.Errorf("version %d lost the user", saveFile.version)
+            continue
+        }
+        gs := alice.GameState
+        if alice.WhoMe != game.X || gs.WhoTurn != game.X || gs.WhoWin != game.Empty {
+            t.Errorf("version %d: WhoMe %v, WhoTurn %v, WhoWin %v", saveFile.version, alice.WhoMe, gs.WhoTurn, gs.WhoWin)
+        }
+        if gs.Board[0][0] != game.X || gs.Board[1][1] != game.O || gs.Board[2][2] != game.Empty {
+            t.Errorf("version %d: board %v", saveFile.version, gs.Board)
+        }
+        if alice.User == nil || alice.User.FirstName != "Alice" || alice.LastBotMsg == nil || alice.LastBotMsg.MessageID != "5" {
+            t.Errorf("version %d: user %+v, last message %+v", saveFile.version, alice.User, alice.LastBotMsg)
+        }
+        if saveFile.version > 0 && (len(migrated.Games) != 1 || migrated.Games[0].WhoWin != game.O) {
+            t.Errorf("version %d: games %+v", saveFile.version, migrated.Games)
+        }
+    }
+}
+
+func TestMigrationDropsStoredKeyboard(t *testing.T) {
+    user := []byte(`{"WhoMe": "❌", "GameState": {"WhoTurn": "⭕️"}, "Selector": {"inline_keyboard": []}}`)
+    migrated, err := migrateUser(user, 0)
+    if err != nil {
+        t.Fatal(err)
+    }
+    r := rawRecord{}
+    if err := json.Unmarshal(migrated, &r); err != nil {
+        t.Fatal(err)
+    }
+    if _, ok := r["Selector"]; ok {
+        t.Errorf("the keyboard is still stored: %s", migrated)
+    }
+    if string(r["WhoMe"]) != `"X"` {
+        t.Errorf("WhoMe is %s", r["WhoMe"])
+    }
+    if _, err := migrateUser([]byte(`{"WhoMe": "?"}`), 1); err == nil {
+        t.Errorf("an unknown cell was migrated")
+    }
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+    "errors"
+    "log"
+    "os"
+    "time"
+
+    game "./game"
+)
+
+var ErrNotFound = errors.New("not found")
+
+type GameRecord struct {
+    ID int64
+    XUserID int64
+    OUserID int64
+    Width int
+    Height int
+    WinLength int
+    // Opening names the book opening the game started from; its stones
+    // are the first Moves.
+    Opening string `json:",omitempty"`
+    Moves []game.Move
+
+    Finished bool
+    WhoWin game.Cell
+    StartedAt time.Time
+    FinishedAt time.Time
+}
+
+// OpeningLength is how many of Moves the opening placed.
+func (record *GameRecord) OpeningLength() int {
+    opening, _ := game.FindOpening(record.Opening)
+    if len(opening.Moves) > len(record.Moves) {
+        return len(record.Moves)
+    }
+    return len(opening.Moves)
+}
+
+// MovesOf counts the moves who made, the opening's stones aside.
+func (record *GameRecord) MovesOf(who game.Cell) int {
+    count := 0
+    for k := record.OpeningLength(); k < len(record.Moves); k++ {
+        if (k % 2 == 0) == (who == game.X) {
+            count++
+        }
+    }
+    return count
+}
+
+func (record *GameRecord) Replay() game.GameState {
+    gs := game.GameState{
+        Width: record.Width,
+        Height: record.Height,
+        WinLength: record.WinLength,
+    }
+    gs.Replay(record.Moves)
+    return gs
+}
+
+type Store interface {
+    LoadUsers() (map[int64]UserState, error)
+    SaveUser(userId int64, userState *UserState) error
+    // NewUserID allocates an id for a user who has no Telegram id.
+    NewUserID() (int64, error)
+
+    NewGameID() (int64, error)
+    LoadGame(gameId int64) (GameRecord, error)
+    LoadGames() ([]GameRecord, error)
+    SaveGame(record *GameRecord) error
+
+    LoadQueue() ([]int64, error)
+    Enqueue(userId int64) error
+    Dequeue(userId int64) error
+
+    Close() error
+}
+
+func ImportSave(path string, store Store) error {
+    users, err := store.LoadUsers()
+    if err != nil {
+        return err
+    }
+    if len(users) != 0 {
+        return nil
+    }
+
+    raw := rawSaveFile{}
+    loadedPath, err := LoadWithFallback(path, &raw)
+    if err != nil {
+        if os.IsNotExist(err) {
+            return nil
+        }
+        return err
+    }
+    saveFile, err := raw.migrate()
+    if err != nil {
+        return err
+    }
+
+    log.Println("Importing", len(saveFile.UserId2UserState), "users from", loadedPath)
+    for userId, userState := range saveFile.UserId2UserState {
+        if err := store.SaveUser(userId, &userState); err != nil {
+            return err
+        }
+    }
+    for i := range saveFile.Games {
+        if err := store.SaveGame(&saveFile.Games[i]); err != nil {
+            return err
+        }
+    }
+    return nil
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+    "encoding/binary"
+    "encoding/json"
+    "time"
+
+    bolt "go.etcd.io/bbolt"
+)
+
+var (
+    usersBucket = []byte("users")
+    gamesBucket = []byte("games")
+    queueBucket = []byte("queue")
+)
+
+type BoltStore struct {
+    db *bolt.DB
+}
+
+func OpenBoltStore(path string) (*BoltStore, error) {
+    db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+    if err != nil {
+        return nil, err
+    }
+    err = db.Update(func(tx *bolt.Tx) error {
+        for _, name := range [][]byte{usersBucket, gamesBucket, queueBucket} {
+            if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+                return err
+            }
+        }
+        return migrateBolt(tx)
+    })
+    if err != nil {
+        db.Close()
+        return nil, err
+    }
+    return &BoltStore{db: db}, nil
+}
+
+func idToKey(id int64) []byte {
+    key := make([]byte, 8)
+    binary.BigEndian.PutUint64(key, uint64(id))
+    return key
+}
+
+func keyToId(key []byte) int64 {
+    return int64(binary.BigEndian.Uint64(key))
+}
+
+func (s *BoltStore) put(bucket []byte, id int64, v interface{}) error {
+    b, err := json.Marshal(v)
+    if err != nil {
+        return err
+    }
+    return s.db.Update(func(tx *bolt.Tx) error {
+        return tx.Bucket(bucket).Put(idToKey(id), b)
+    })
+}
+
+func (s *BoltStore) LoadUsers() (map[int64]UserState, error) {
+    users := make(map[int64]UserState)
+    err := s.db.View(func(tx *bolt.Tx) error {
+        return tx.Bucket(usersBucket).ForEach(func(k, v []byte) error {
+            var userState UserState
+            if err := json.Unmarshal(v, &userState); err != nil {
+                return err
+            }
+            users[keyToId(k)] = userState
+            return nil
+        })
+    })
+    return users, err
+}
+
+func (s *BoltStore) SaveUser(userId int64, userState *UserState) error {
+    return s.put(usersBucket, userId, userState)
+}
+
+// NewUserID hands out negative ids, which Telegram never uses, and skips
+// ids taken by users restored from a snapshot.
+func (s *BoltStore) NewUserID() (int64, error) {
+    var id int64
+    err := s.db.Update(func(tx *bolt.Tx) error {
+        bucket := tx.Bucket(usersBucket)
+        for {
+            seq, err := bucket.NextSequence()
+            if err != nil {
+                return err
+            }
+            id = -int64(seq)
+            if bucket.Get(idToKey(id)) == nil {
+                return nil
+            }
+        }
+    })
+    return id, err
+}
+
+func (s *BoltStore) NewGameID() (int64, error) {
+    var id int64
+    err := s.db.Update(func(tx *bolt.Tx) error {
+        seq, err := tx.Bucket(gamesBucket).NextSequence()
+        id = int64(seq)
+        return err
+    })
+    return id, err
+}
+
+func (s *BoltStore) LoadGame(gameId int64) (GameRecord, error) {
+    var record GameRecord
+    err := s.db.View(func(tx *bolt.Tx) error {
+        v := tx.Bucket(gamesBucket).Get(idToKey(gameId))
+        if v == nil {
+            return ErrNotFound
+        }
+        return json.Unmarshal(v, &record)
+    })
+    return record, err
+}
+
+func (s *BoltStore) LoadGames() ([]GameRecord, error) {
+    var records []GameRecord
+    err := s.db.View(func(tx *bolt.Tx) error {
+        return tx.Bucket(gamesBucket).ForEach(func(k, v []byte) error {
+            var record GameRecord
+            if err := json.Unmarshal(v, &record); err != nil {
+                return err
+            }
+            records = append(records, record)
+            return nil
+        })
+    })
+    return records, err
+}
+
+func (s *BoltStore) SaveGame(record *GameRecord) error {
+    b, err := json.Marshal(record)
+    if err != nil {
+        return err
+    }
+    return s.db.Update(func(tx *bolt.Tx) error {
+        bucket := tx.Bucket(gamesBucket)
+        if uint64(record.ID) > bucket.Sequence() {
+            if err := bucket.SetSequence(uint64(record.ID)); err != nil {
+                return err
+            }
+        }
+        return bucket.Put(idToKey(record.ID), b)
+    })
+}
+
+func (s *BoltStore) LoadQueue() ([]int64, error) {
+    var queue []int64
+    err := s.db.View(func(tx *bolt.Tx) error {
+        return tx.Bucket(queueBucket).ForEach(func(k, v []byte) error {
+            queue = append(queue, keyToId(k))
+            return nil
+        })
+    })
+    return queue, err
+}
+
+func (s *BoltStore) Enqueue(userId int64) error {
+    return s.db.Update(func(tx *bolt.Tx) error {
+        return tx.Bucket(queueBucket).Put(idToKey(userId), []byte{})
+    })
+}
+
+func (s *BoltStore) Dequeue(userId int64) error {
+    return s.db.Update(func(tx *bolt.Tx) error {
+        return tx.Bucket(queueBucket).Delete(idToKey(userId))
+    })
+}
+
+func (s *BoltStore) Close() error {
+    return s.db.Close()
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+    "bytes"
+    "strings"
+
+    telebot "github.com/tucnak/telebot"
+)
+
+type TelegramTransport struct {
+    bot *telebot.Bot
+}
+
+func NewTelegramTransport(config Config) (*TelegramTransport, error) {
+    bot, err := telebot.NewBot(telebot.Settings{
+        URL: config.APIURL,
+        Token: config.Token,
+        Poller: newPoller(config),
+    })
+    if err != nil {
+        return nil, err
+    }
+    return &TelegramTransport{bot: bot}, nil
+}
+
+func telegramUser(user *telebot.User) User {
+    return User{
+        ID: user.ID,
+        FirstName: user.FirstName,
+        LastName: user.LastName,
+        Username: user.Username,
+        LanguageCode: user.LanguageCode,
+    }
+}
+
+func telegramMarkup(keyboard Keyboard) []interface{} {
+    if keyboard == nil {
+        return nil
+    }
+    markup := &telebot.ReplyMarkup{}
+    rows := make([]telebot.Row, len(keyboard))
+    for i, row := range keyboard {
+        for _, button := range row {
+            rows[i] = append(rows[i], markup.Data(button.Text, button.Action, button.Data))
+        }
+    }
+    markup.Inline(rows...)
+    return []interface{}{markup}
+}
+
+func telegramPhoto(photo Photo) *telebot.Photo {
+    return &telebot.Photo{File: telebot.FromReader(bytes.NewReader(photo.PNG)), Caption: photo.Caption}
+}
+
+func storedMessage(ref MessageRef) telebot.StoredMessage {
+    return telebot.StoredMessage{MessageID: ref.MessageID, ChatID: ref.ChatID}
+}
+
+func messageRef(message telebot.Editable) MessageRef {
+    messageID, chatID := message.MessageSig()
+    return MessageRef{MessageID: messageID, ChatID: chatID}
+}
+
+func (transport *TelegramTransport) Platform() string {
+    return PlatformTelegram
+}
+
+func (transport *TelegramTransport) send(to User, what interface{}, keyboard Keyboard) (MessageRef, error) {
+    m, err := transport.bot.Send(telebot.ChatID(to.ID), what, telegramMarkup(keyboard)...)
+    if err != nil {
+        return MessageRef{}, err
+    }
+    return messageRef(m), nil
+}
+
+func (transport *TelegramTransport) SendText(to User, text string, keyboard Keyboard) (MessageRef, error) {
+    return transport.send(to, text, keyboard)
+}
+
+func (transport *TelegramTransport) SendPhoto(to User, photo Photo, keyboard Keyboard) (MessageRef, error) {
+    return transport.send(to, telegramPhoto(photo), keyboard)
+}
+
+func (transport *TelegramTransport) EditText(ref MessageRef, text string, keyboard Keyboard) error {
+    _, err := transport.bot.Edit(storedMessage(ref), text, telegramMarkup(keyboard)...)
+    return err
+}
+
+func (transport *TelegramTransport) EditPhoto(ref MessageRef, photo Photo, keyboard Keyboard) error {
+    _, err := transport.bot.Edit(storedMessage(ref), telegramPhoto(photo), telegramMarkup(keyboard)...)
+    return err
+}
+
+func (transport *TelegramTransport) Delete(ref MessageRef) error {
+    return transport.bot.Delete(storedMessage(ref))
+}
+
+// Bind feeds Telegram updates to the router. Buttons carry "\f<action>|<data>"
+// as telebot encodes them, so keyboards sent before are still understood.
+func (transport *TelegramTransport) Bind(router *Router) {
+    transport.bot.Handle(telebot.OnText, func(context telebot.Context) error {
+        return router.Dispatch(&Input{User: telegramUser(context.Sender()), Text: context.Text()})
+    })
+    transport.bot.Handle(telebot.OnCallback, func(context telebot.Context) error {
+        context.Respond()
+        callback := context.Callback()
+        input := &Input{User: telegramUser(context.Sender())}
+        input.Action = strings.TrimPrefix(callback.Data, "\f")
+        if k := strings.Index(input.Action, "|"); k >= 0 {
+            input.Action, input.Data = input.Action[:k], input.Action[k + 1:]
+        }
+        if callback.Message != nil {
+            input.Message = messageRef(callback.Message)
+        }
+        return router.Dispatch(input)
+    })
+}
+
+func (transport *TelegramTransport) Start() {
+    transport.bot.Start()
+}
+
+func (transport *TelegramTransport) Stop() {
+    transport.bot.Stop()
+}
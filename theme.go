@@ -0,0 +1,198 @@
+package main
+
+import (
+    "strings"
+    "unicode"
+
+    game "./game"
+    i18n "./i18n"
+)
+
+const themeCustom = "custom"
+
+type Theme struct {
+    Name string
+    Title i18n.MessageID
+    Customization UserCustomization
+}
+
+var themes = []Theme{
+    {"classic", i18n.ThemeClassic, UserCustomization{X: "❌", O: "🔴", Empty: "🌫", XLast: "❎", OLast: "🟢"}},
+    {"hearts", i18n.ThemeHearts, UserCustomization{X: "❤️", O: "💙", Empty: "🤍", XLast: "💖", OLast: "💎"}},
+    {"animals", i18n.ThemeAnimals, UserCustomization{X: "🐱", O: "🐶", Empty: "🌿", XLast: "😺", OLast: "🐕"}},
+    {"fruits", i18n.ThemeFruits, UserCustomization{X: "🍎", O: "🍐", Empty: "⬜", XLast: "🍓", OLast: "🍏"}},
+    {"space", i18n.ThemeSpace, UserCustomization{X: "🌟", O: "🪐", Empty: "⬛", XLast: "💫", OLast: "🌎"}},
+}
+
+func findTheme(name string) (Theme, bool) {
+    for _, theme := range themes {
+        if theme.Name == name {
+            return theme, true
+        }
+    }
+    return Theme{}, false
+}
+
+func (c UserCustomization) Preview() string {
+    return c.X + c.O + c.Empty + c.XLast + c.OLast
+}
+
+func (c UserCustomization) Symbol(cell game.Cell, last bool) string {
+    return game.Symbols(c).Symbol(cell, last)
+}
+
+var wideRanges = [][2]rune{
+    {0x1100, 0x115F}, {0x231A, 0x231B}, {0x23E9, 0x23EC}, {0x23F0, 0x23F0}, {0x23F3, 0x23F3},
+    {0x25FD, 0x25FE}, {0x2614, 0x2615}, {0x2648, 0x2653}, {0x267F, 0x267F}, {0x2693, 0x2693},
+    {0x26A1, 0x26A1}, {0x26AA, 0x26AB}, {0x26BD, 0x26BE}, {0x26C4, 0x26C5}, {0x26CE, 0x26CE},
+    {0x26D4, 0x26D4}, {0x26EA, 0x26EA}, {0x26F2, 0x26F3}, {0x26F5, 0x26F5}, {0x26FA, 0x26FA},
+    {0x26FD, 0x26FD}, {0x2705, 0x2705}, {0x270A, 0x270B}, {0x2728, 0x2728}, {0x274C, 0x274C},
+    {0x274E, 0x274E}, {0x2753, 0x2755}, {0x2757, 0x2757}, {0x2795, 0x2797}, {0x27B0, 0x27B0},
+    {0x27BF, 0x27BF}, {0x2B1B, 0x2B1C}, {0x2B50, 0x2B50}, {0x2B55, 0x2B55}, {0x2E80, 0x303E},
+    {0x3041, 0x33FF}, {0x3400, 0x4DBF}, {0x4E00, 0x9FFF}, {0xA000, 0xA4CF}, {0xAC00, 0xD7A3},
+    {0xF900, 0xFAFF}, {0xFE30, 0xFE4F}, {0xFF00, 0xFF60}, {0xFFE0, 0xFFE6}, {0x1F004, 0x1F004},
+    {0x1F0CF, 0x1F0CF}, {0x1F18E, 0x1F18E}, {0x1F191, 0x1F19A}, {0x1F200, 0x1F251}, {0x1F300, 0x1F64F},
+    {0x1F680, 0x1F6FF}, {0x1F7E0, 0x1F7EB}, {0x1F90C, 0x1F9FF}, {0x1FA70, 0x1FAFF}, {0x20000, 0x3FFFD},
+}
+
+func isWideRune(r rune) bool {
+    for _, wide := range wideRanges {
+        if r >= wide[0] && r <= wide[1] {
+            return true
+        }
+    }
+    return false
+}
+
+func isRegionalIndicator(r rune) bool {
+    return r >= 0x1F1E6 && r <= 0x1F1FF
+}
+
+// isSingleWideGrapheme reports whether s is one user-perceived character
+// occupying two columns, so that boards made of such symbols stay aligned.
+func isSingleWideGrapheme(s string) bool {
+    runes := []rune(s)
+    if len(runes) == 0 {
+        return false
+    }
+    if isRegionalIndicator(runes[0]) {
+        return len(runes) == 2 && isRegionalIndicator(runes[1])
+    }
+    if !unicode.IsGraphic(runes[0]) || unicode.IsSpace(runes[0]) || unicode.In(runes[0], unicode.Mn, unicode.Me) {
+        return false
+    }
+
+    wide := isWideRune(runes[0])
+    for k := 1; k < len(runes); k++ {
+        r := runes[k]
+        switch {
+        case r == 0xFE0F, r == 0x20E3:
+            wide = true
+        case r == 0xFE0E:
+            wide = false
+        case r >= 0x1F3FB && r <= 0x1F3FF, r >= 0xE0020 && r <= 0xE007F:
+        case unicode.In(r, unicode.Mn, unicode.Me):
+        case r == 0x200D:
+            if k + 1 >= len(runes) || !unicode.IsGraphic(runes[k + 1]) || unicode.IsSpace(runes[k + 1]) {
+                return false
+            }
+            k++
+        default:
+            return false
+        }
+    }
+    return wide
+}
+
+func parseCustomTheme(text string) (UserCustomization, bool) {
+    symbols := strings.Fields(text)
+    if len(symbols) != 5 {
+        return UserCustomization{}, false
+    }
+    seen := make(map[string]bool)
+    for _, symbol := range symbols {
+        if !isSingleWideGrapheme(symbol) || symbol == hintSymbol || seen[symbol] {
+            return UserCustomization{}, false
+        }
+        seen[symbol] = true
+    }
+    return UserCustomization{X: symbols[0], O: symbols[1], Empty: symbols[2], XLast: symbols[3], OLast: symbols[4]}, true
+}
+
+func constructThemeSelector(lang i18n.Lang) Keyboard {
+    selector := Keyboard{}
+    for _, theme := range themes {
+        text := theme.Customization.Preview() + " " + i18n.T(lang, theme.Title)
+        selector = append(selector, []Button{{Text: text, Action: "theme", Data: theme.Name}})
+    }
+    selector = append(selector, []Button{{Text: i18n.T(lang, i18n.ThemeCustom), Action: "theme", Data: themeCustom}})
+    return selector
+}
+
+func applyTheme(botStorage *TicTacToeBotStorage, userState *UserState, customization UserCustomization,
+                title string, newMsg IsNewMessage) error {
+    userState.Customization = customization
+    userState.AwaitingTheme = false
+    rebuildSelector(userState)
+    botStorage.setUserState(userState.User.ID, *userState)
+
+    lang := userState.Lang()
+    if err := SendEditable(botStorage, userState, newMsg, MessageNotEditable,
+                           i18n.T(lang, i18n.ThemeChanged, title + " " + customization.Preview())); err != nil {
+        return err
+    }
+    if userState.State == InGame {
+        return sendTurnPrompt(botStorage, userState)
+    }
+    return nil
+}
+
+func handleThemeInput(botStorage *TicTacToeBotStorage, input *Input, text string) error {
+    userState := botStorage.RegisterUser(input)
+    lang := userState.Lang()
+    customization, ok := parseCustomTheme(text)
+    if !ok {
+        userState.AwaitingTheme = false
+        botStorage.setUserState(userState.User.ID, userState)
+        return SendEditable(botStorage, &userState, NewMessage, MessageNotEditable, i18n.T(lang, i18n.ThemeInvalid))
+    }
+    return applyTheme(botStorage, &userState, customization, i18n.T(lang, i18n.ThemeCustom), NewMessage)
+}
+
+func registerThemeHandlers(router *Router, botStorage *TicTacToeBotStorage) {
+    // Any command, /cancel included, drops a custom theme prompt.
+    router.BeforeCommand(func(input *Input) {
+        userState := botStorage.RegisterUser(input)
+        if userState.AwaitingTheme {
+            userState.AwaitingTheme = false
+            botStorage.setUserState(userState.User.ID, userState)
+        }
+    })
+    router.Command("/cancel", func(input *Input) error {
+        userState := botStorage.RegisterUser(input)
+        return SendEditable(botStorage, &userState, NewMessage, MessageNotEditable, i18n.T(userState.Lang(), i18n.Cancelled))
+    })
+    router.Command("/theme", func(input *Input) error {
+        if payload := input.Payload; payload != "" {
+            return handleThemeInput(botStorage, input, payload)
+        }
+        userState := botStorage.RegisterUser(input)
+        return SendEditable(botStorage, &userState, NewMessage, MessageEditable,
+                            i18n.T(userState.Lang(), i18n.ChooseTheme), constructThemeSelector(userState.Lang()))
+    })
+    router.Action("theme", func(input *Input) error {
+        userState := botStorage.RegisterUser(input)
+        lang := userState.Lang()
+        if input.Data == themeCustom {
+            userState.AwaitingTheme = true
+            botStorage.setUserState(userState.User.ID, userState)
+            return SendEditable(botStorage, &userState, EditPreviousMessage, MessageNotEditable,
+                                i18n.T(lang, i18n.ThemeCustomPrompt))
+        }
+        theme, ok := findTheme(input.Data)
+        if !ok {
+            return nil
+        }
+        return applyTheme(botStorage, &userState, theme.Customization, i18n.T(lang, theme.Title), EditPreviousMessage)
+    })
+}
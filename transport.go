@@ -0,0 +1,251 @@
+package main
+
+import (
+    "fmt"
+    "strings"
+    "sync"
+)
+
+const (
+    PlatformTelegram = ""
+    PlatformDiscord  = "discord"
+    PlatformWeb      = "web"
+)
+
+// User is the person on the other side of a chat. The JSON names match the
+// Telegram user object that older saves contain. Telegram users keep their
+// Telegram id as ID; users of other platforms get an id from Accounts and
+// their own id in ExternalID.
+type User struct {
+    ID int64 `json:"id"`
+    Platform string `json:"platform,omitempty"`
+    ExternalID string `json:"external_id,omitempty"`
+    FirstName string `json:"first_name,omitempty"`
+    LastName string `json:"last_name,omitempty"`
+    Username string `json:"username,omitempty"`
+    LanguageCode string `json:"language_code,omitempty"`
+}
+
+// MessageRef points at a message the bot sent, so it can be edited or
+// deleted later. It is stored with the user state.
+type MessageRef struct {
+    MessageID string `json:"message_id"`
+    ChatID int64 `json:"chat_id"`
+    Platform string `json:"platform,omitempty"`
+}
+
+type Button struct {
+    Text string `json:"text"`
+    // Action picks the handler of a pressed button, Data is passed to it.
+    Action string `json:"action"`
+    Data string `json:"data,omitempty"`
+}
+
+type Keyboard [][]Button
+
+type Photo struct {
+    PNG []byte
+    Caption string
+}
+
+// Transport delivers the bot's messages to a messenger. A nil keyboard
+// sends or leaves a message without buttons.
+type Transport interface {
+    SendText(to User, text string, keyboard Keyboard) (MessageRef, error)
+    SendPhoto(to User, photo Photo, keyboard Keyboard) (MessageRef, error)
+    EditText(ref MessageRef, text string, keyboard Keyboard) error
+    EditPhoto(ref MessageRef, photo Photo, keyboard Keyboard) error
+    Delete(ref MessageRef) error
+}
+
+// Service runs in the background between Start and Stop.
+type Service interface {
+    Start()
+    Stop()
+}
+
+// Frontend is a messenger the bot runs on: it delivers messages and feeds
+// the router with updates while it runs.
+type Frontend interface {
+    Transport
+    Service
+    Platform() string
+    Bind(router *Router)
+}
+
+type Accounts interface {
+    UserID(platform string, externalID string) (int64, error)
+}
+
+// Transports sends every message through the frontend of its platform, so
+// players of one game may sit in different messengers.
+type Transports map[string]Transport
+
+func (transports Transports) get(platform string) (Transport, error) {
+    transport, ok := transports[platform]
+    if !ok {
+        return nil, fmt.Errorf("no transport for platform %q", platform)
+    }
+    return transport, nil
+}
+
+func (transports Transports) SendText(to User, text string, keyboard Keyboard) (MessageRef, error) {
+    transport, err := transports.get(to.Platform)
+    if err != nil {
+        return MessageRef{}, err
+    }
+    return transport.SendText(to, text, keyboard)
+}
+
+func (transports Transports) SendPhoto(to User, photo Photo, keyboard Keyboard) (MessageRef, error) {
+    transport, err := transports.get(to.Platform)
+    if err != nil {
+        return MessageRef{}, err
+    }
+    return transport.SendPhoto(to, photo, keyboard)
+}
+
+func (transports Transports) EditText(ref MessageRef, text string, keyboard Keyboard) error {
+    transport, err := transports.get(ref.Platform)
+    if err != nil {
+        return err
+    }
+    return transport.EditText(ref, text, keyboard)
+}
+
+func (transports Transports) EditPhoto(ref MessageRef, photo Photo, keyboard Keyboard) error {
+    transport, err := transports.get(ref.Platform)
+    if err != nil {
+        return err
+    }
+    return transport.EditPhoto(ref, photo, keyboard)
+}
+
+func (transports Transports) Delete(ref MessageRef) error {
+    transport, err := transports.get(ref.Platform)
+    if err != nil {
+        return err
+    }
+    return transport.Delete(ref)
+}
+
+// Input is an update from a messenger: either a text message or a pressed
+// button.
+type Input struct {
+    User User
+    Text string
+    Command string
+    Payload string
+
+    Action string
+    Data string
+    Message MessageRef
+}
+
+type Handler func(input *Input) error
+
+type Router struct {
+    commands map[string]Handler
+    actions map[string]Handler
+    text Handler
+    beforeCommand []func(input *Input)
+    lock sync.Locker
+    // current lists the actions whose buttons only work on the message
+    // lastMessage returns.
+    current map[string]bool
+    lastMessage func(input *Input) *MessageRef
+}
+
+func NewRouter() *Router {
+    return &Router{
+        commands: make(map[string]Handler),
+        actions: make(map[string]Handler),
+        current: make(map[string]bool),
+    }
+}
+
+func (router *Router) Command(command string, handler Handler) {
+    router.commands[command] = handler
+}
+
+func (router *Router) Action(action string, handler Handler) {
+    router.actions[action] = handler
+}
+
+// CurrentAction registers a handler for buttons of the message the bot keeps
+// editing for the user; presses on any other message are dropped, whatever
+// action and data a client sends with them.
+func (router *Router) CurrentAction(action string, handler Handler) {
+    router.actions[action] = handler
+    router.current[action] = true
+}
+
+// LastMessage tells the router which message is current for the user of an
+// input; nil means none is.
+func (router *Router) LastMessage(last func(input *Input) *MessageRef) {
+    router.lastMessage = last
+}
+
+func (router *Router) isCurrent(input *Input) bool {
+    if !router.current[input.Action] || router.lastMessage == nil {
+        return true
+    }
+    ref := router.lastMessage(input)
+    return ref != nil && ref.MessageID == input.Message.MessageID && ref.ChatID == input.Message.ChatID
+}
+
+// Text handles messages that are not a known command.
+func (router *Router) Text(handler Handler) {
+    router.text = handler
+}
+
+// BeforeCommand runs hook ahead of every command, known or not.
+func (router *Router) BeforeCommand(hook func(input *Input)) {
+    router.beforeCommand = append(router.beforeCommand, hook)
+}
+
+// parseCommand splits "/theme@bot hearts" into "/theme" and "hearts".
+func parseCommand(text string) (string, string) {
+    if !strings.HasPrefix(text, "/") {
+        return "", ""
+    }
+    command, payload := text, ""
+    if k := strings.IndexAny(text, " \n"); k >= 0 {
+        command, payload = text[:k], strings.TrimSpace(text[k + 1:])
+    }
+    if k := strings.Index(command, "@"); k >= 0 {
+        command = command[:k]
+    }
+    return command, payload
+}
+
+// Serialize makes Dispatch hold lock while a handler runs.
+func (router *Router) Serialize(lock sync.Locker) {
+    router.lock = lock
+}
+
+func (router *Router) Dispatch(input *Input) error {
+    if router.lock != nil {
+        router.lock.Lock()
+        defer router.lock.Unlock()
+    }
+    if input.Action != "" {
+        if handler, ok := router.actions[input.Action]; ok && router.isCurrent(input) {
+            return handler(input)
+        }
+        return nil
+    }
+    input.Command, input.Payload = parseCommand(input.Text)
+    if input.Command != "" {
+        for _, hook := range router.beforeCommand {
+            hook(input)
+        }
+    }
+    if handler, ok := router.commands[input.Command]; ok {
+        return handler(input)
+    }
+    if router.text != nil {
+        return router.text(input)
+    }
+    return nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+    "strconv"
+    "strings"
+    "sync"
+)
+
+// mockCall is a message the bot sent, edited or deleted.
+type mockCall struct {
+    Kind string
+    Ref MessageRef
+    Text string
+    Keyboard Keyboard
+}
+
+// mockTransport records everything the bot does instead of talking to a
+// messenger. Message ids count up from 1.
+type mockTransport struct {
+    mutex sync.Mutex
+    nextID int
+    calls []mockCall
+}
+
+func (transport *mockTransport) record(kind string, ref MessageRef, text string, keyboard Keyboard) {
+    transport.calls = append(transport.calls, mockCall{Kind: kind, Ref: ref, Text: text, Keyboard: keyboard})
+}
+
+func (transport *mockTransport) send(kind string, to User, text string, keyboard Keyboard) (MessageRef, error) {
+    transport.mutex.Lock()
+    defer transport.mutex.Unlock()
+    transport.nextID++
+    ref := MessageRef{MessageID: strconv.Itoa(transport.nextID), ChatID: to.ID, Platform: to.Platform}
+    transport.record(kind, ref, text, keyboard)
+    return ref, nil
+}
+
+func (transport *mockTransport) SendText(to User, text string, keyboard Keyboard) (MessageRef, error) {
+    return transport.send("send", to, text, keyboard)
+}
+
+func (transport *mockTransport) SendPhoto(to User, photo Photo, keyboard Keyboard) (MessageRef, error) {
+    return transport.send("photo", to, photo.Caption, keyboard)
+}
+
+func (transport *mockTransport) EditText(ref MessageRef, text string, keyboard Keyboard) error {
+    transport.mutex.Lock()
+    defer transport.mutex.Unlock()
+    transport.record("edit", ref, text, keyboard)
+    return nil
+}
+
+func (transport *mockTransport) EditPhoto(ref MessageRef, photo Photo, keyboard Keyboard) error {
+    transport.mutex.Lock()
+    defer transport.mutex.Unlock()
+    transport.record("edit", ref, photo.Caption, keyboard)
+    return nil
+}
+
+func (transport *mockTransport) Delete(ref MessageRef) error {
+    transport.mutex.Lock()
+    defer transport.mutex.Unlock()
+    transport.record("delete", ref, "", nil)
+    return nil
+}
+
+// reset forgets the calls made so far.
+func (transport *mockTransport) reset() {
+    transport.mutex.Lock()
+    defer transport.mutex.Unlock()
+    transport.calls = nil
+}
+
+// to lists the calls of kind that went to the chat of userId.
+func (transport *mockTransport) to(userId int64, kind string) []mockCall {
+    transport.mutex.Lock()
+    defer transport.mutex.Unlock()
+    var calls []mockCall
+    for _, call := range transport.calls {
+        if call.Ref.ChatID == userId && call.Kind == kind {
+            calls = append(calls, call)
+        }
+    }
+    return calls
+}
+
+// find is the last call of kind to userId whose text contains text.
+func (transport *mockTransport) find(userId int64, kind string, text string) (mockCall, bool) {
+    calls := transport.to(userId, kind)
+    for k := len(calls) - 1; k >= 0; k-- {
+        if strings.Contains(calls[k].Text, text) {
+            return calls[k], true
+        }
+    }
+    return mockCall{}, false
+}
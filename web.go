@@ -0,0 +1,369 @@
+package main
+
+import (
+    "context"
+    "crypto/rand"
+    _ "embed"
+    "encoding/base64"
+    "encoding/hex"
+    "log"
+    "net"
+    "net/http"
+    "net/url"
+    "strconv"
+    "sync"
+    "time"
+
+    websocket "github.com/gorilla/websocket"
+)
+
+//go:embed web/index.html
+var webPage []byte
+
+const (
+    // webHistory is how many messages of a user are kept for reconnecting
+    // browsers.
+    webHistory = 50
+    webQueue = 64
+    // webKeyCookie holds the key that identifies a browser player. The
+    // server issues it and scripts cannot read it.
+    webKeyCookie = "ttt_key"
+    webKeyAge = 10 * 365 * 24 * time.Hour
+)
+
+// webMessage goes both ways over the WebSocket. The server sends "message",
+// "edit", "delete" and "reset"; the browser sends "text" and "press".
+type webMessage struct {
+    Type string `json:"type"`
+    ID string `json:"id,omitempty"`
+    Text string `json:"text,omitempty"`
+    Photo string `json:"photo,omitempty"`
+    Keyboard Keyboard `json:"keyboard,omitempty"`
+    Action string `json:"action,omitempty"`
+    Data string `json:"data,omitempty"`
+}
+
+type webConn struct {
+    conn *websocket.Conn
+    out chan webMessage
+}
+
+// webChat is what a user sees in the browser; every open tab gets the same
+// messages.
+type webChat struct {
+    messages []*webMessage
+    conns map[*webConn]bool
+}
+
+// WebTransport serves a browser UI and plays with it over a WebSocket.
+// Browsers identify themselves with a random key the server sets in a cookie
+// when it serves the page.
+type WebTransport struct {
+    accounts Accounts
+    listener net.Listener
+    server *http.Server
+    mux *http.ServeMux
+    router *Router
+    upgrader websocket.Upgrader
+
+    mutex sync.Mutex
+    // idPrefix keeps message ids of this run apart from the ones users
+    // still hold from before a restart.
+    idPrefix string
+    nextID int
+    chats map[int64]*webChat
+}
+
+func NewWebTransport(config Config, accounts Accounts) (*WebTransport, error) {
+    listener, err := net.Listen("tcp", config.Web.Listen)
+    if err != nil {
+        return nil, err
+    }
+    transport := &WebTransport{
+        accounts: accounts,
+        listener: listener,
+        mux: http.NewServeMux(),
+        chats: make(map[int64]*webChat),
+        idPrefix: strconv.FormatInt(time.Now().UnixNano(), 36) + "-",
+    }
+    transport.upgrader.CheckOrigin = sameOrigin
+    transport.mux.HandleFunc("/", transport.page)
+    transport.mux.HandleFunc("/ws", transport.connect)
+    transport.server = &http.Server{Handler: transport.mux}
+    return transport, nil
+}
+
+func (transport *WebTransport) Platform() string {
+    return PlatformWeb
+}
+
+// Addr is the address the server listens on, useful with port 0.
+func (transport *WebTransport) Addr() string {
+    return transport.listener.Addr().String()
+}
+
+func (transport *WebTransport) page(w http.ResponseWriter, r *http.Request) {
+    if r.URL.Path != "/" {
+        http.NotFound(w, r)
+        return
+    }
+    if _, ok := webKey(r); !ok {
+        key, err := newWebKey()
+        if err != nil {
+            http.Error(w, err.Error(), http.StatusInternalServerError)
+            return
+        }
+        http.SetCookie(w, &http.Cookie{
+            Name: webKeyCookie,
+            Value: key,
+            Path: "/",
+            MaxAge: int(webKeyAge / time.Second),
+            Secure: r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https",
+            HttpOnly: true,
+            SameSite: http.SameSiteStrictMode,
+        })
+    }
+    w.Header().Set("Content-Type", "text/html; charset=utf-8")
+    w.Write(webPage)
+}
+
+func validWebKey(key string) bool {
+    return len(key) >= 16 && validSecretToken(key)
+}
+
+func newWebKey() (string, error) {
+    key := make([]byte, 16)
+    if _, err := rand.Read(key); err != nil {
+        return "", err
+    }
+    return hex.EncodeToString(key), nil
+}
+
+// webKey is the key from the request's cookie, if it has a valid one.
+func webKey(r *http.Request) (string, bool) {
+    cookie, err := r.Cookie(webKeyCookie)
+    if err != nil || !validWebKey(cookie.Value) {
+        return "", false
+    }
+    return cookie.Value, true
+}
+
+// sameOrigin lets only the page served here open the WebSocket, so that no
+// other site can play with the cookie of a visitor.
+func sameOrigin(r *http.Request) bool {
+    origin, err := url.Parse(r.Header.Get("Origin"))
+    if err != nil || origin.Host == "" {
+        return false
+    }
+    return origin.Host == r.Host
+}
+
+// chat must be called with the mutex held.
+func (transport *WebTransport) chat(userId int64) *webChat {
+    chat, ok := transport.chats[userId]
+    if !ok {
+        chat = &webChat{conns: make(map[*webConn]bool)}
+        transport.chats[userId] = chat
+    }
+    return chat
+}
+
+// broadcast must be called with the mutex held. A browser that does not keep
+// up is disconnected and gets the whole chat again when it reconnects.
+func (chat *webChat) broadcast(message webMessage) {
+    for c := range chat.conns {
+        select {
+        case c.out <- message:
+        default:
+            delete(chat.conns, c)
+            close(c.out)
+        }
+    }
+}
+
+func (transport *WebTransport) connect(w http.ResponseWriter, r *http.Request) {
+    query := r.URL.Query()
+    key, ok := webKey(r)
+    if !ok {
+        http.Error(w, "no key, load the page first", http.StatusUnauthorized)
+        return
+    }
+    if !sameOrigin(r) {
+        http.Error(w, "cross-origin request", http.StatusForbidden)
+        return
+    }
+    userId, err := transport.accounts.UserID(PlatformWeb, key)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusInternalServerError)
+        return
+    }
+    conn, err := transport.upgrader.Upgrade(w, r, nil)
+    if err != nil {
+        return
+    }
+    user := User{
+        ID: userId,
+        Platform: PlatformWeb,
+        ExternalID: key,
+        FirstName: query.Get("name"),
+        LanguageCode: query.Get("lang"),
+    }
+
+    c := &webConn{conn: conn, out: make(chan webMessage, webQueue + webHistory)}
+    transport.mutex.Lock()
+    chat := transport.chat(userId)
+    c.out <- webMessage{Type: "reset"}
+    for _, message := range chat.messages {
+        c.out <- *message
+    }
+    chat.conns[c] = true
+    transport.mutex.Unlock()
+
+    go func() {
+        for message := range c.out {
+            if err := conn.WriteJSON(message); err != nil {
+                break
+            }
+        }
+        conn.Close()
+    }()
+    defer func() {
+        transport.mutex.Lock()
+        if chat.conns[c] {
+            delete(chat.conns, c)
+            close(c.out)
+        }
+        transport.mutex.Unlock()
+    }()
+
+    for {
+        var message webMessage
+        if err := conn.ReadJSON(&message); err != nil {
+            return
+        }
+        input := &Input{User: user}
+        switch message.Type {
+        case "text":
+            input.Text = message.Text
+        case "press":
+            input.Action, input.Data = message.Action, message.Data
+            input.Message = MessageRef{MessageID: message.ID, ChatID: userId, Platform: PlatformWeb}
+        default:
+            continue
+        }
+        if transport.router == nil {
+            continue
+        }
+        if err := transport.router.Dispatch(input); err != nil {
+            log.Println("Web handler failed", err)
+        }
+    }
+}
+
+func photoURL(photo Photo) string {
+    return "data:image/png;base64," + base64.StdEncoding.EncodeToString(photo.PNG)
+}
+
+func (transport *WebTransport) send(to User, message webMessage) (MessageRef, error) {
+    transport.mutex.Lock()
+    defer transport.mutex.Unlock()
+    transport.nextID++
+    message.ID = transport.idPrefix + strconv.Itoa(transport.nextID)
+    transport.chat(to.ID).add(message)
+    return MessageRef{MessageID: message.ID, ChatID: to.ID, Platform: PlatformWeb}, nil
+}
+
+// add must be called with the mutex held.
+func (chat *webChat) add(message webMessage) {
+    message.Type = "message"
+    chat.messages = append(chat.messages, &message)
+    if len(chat.messages) > webHistory {
+        chat.messages = chat.messages[len(chat.messages) - webHistory:]
+    }
+    chat.broadcast(message)
+}
+
+func (transport *WebTransport) SendText(to User, text string, keyboard Keyboard) (MessageRef, error) {
+    return transport.send(to, webMessage{Text: text, Keyboard: keyboard})
+}
+
+func (transport *WebTransport) SendPhoto(to User, photo Photo, keyboard Keyboard) (MessageRef, error) {
+    return transport.send(to, webMessage{Text: photo.Caption, Photo: photoURL(photo), Keyboard: keyboard})
+}
+
+// update must be called with the mutex held. It reports whether the
+// message is still in the history.
+func (transport *WebTransport) update(ref MessageRef, change func(chat *webChat, k int)) bool {
+    chat := transport.chat(ref.ChatID)
+    for k, message := range chat.messages {
+        if message.ID == ref.MessageID {
+            change(chat, k)
+            return true
+        }
+    }
+    return false
+}
+
+// edit sends the message anew, under the same id, when it is gone from the
+// history after a restart or trimming: browsers only have what is there.
+func (transport *WebTransport) edit(ref MessageRef, text string, photo string, keyboard Keyboard) error {
+    transport.mutex.Lock()
+    defer transport.mutex.Unlock()
+    found := transport.update(ref, func(chat *webChat, k int) {
+        message := chat.messages[k]
+        message.Text, message.Keyboard = text, keyboard
+        if photo != "" {
+            message.Photo = photo
+        }
+        edited := *message
+        edited.Type = "edit"
+        chat.broadcast(edited)
+    })
+    if !found {
+        transport.chat(ref.ChatID).add(webMessage{ID: ref.MessageID, Text: text, Photo: photo, Keyboard: keyboard})
+    }
+    return nil
+}
+
+func (transport *WebTransport) EditText(ref MessageRef, text string, keyboard Keyboard) error {
+    return transport.edit(ref, text, "", keyboard)
+}
+
+func (transport *WebTransport) EditPhoto(ref MessageRef, photo Photo, keyboard Keyboard) error {
+    return transport.edit(ref, photo.Caption, photoURL(photo), keyboard)
+}
+
+func (transport *WebTransport) Delete(ref MessageRef) error {
+    transport.mutex.Lock()
+    defer transport.mutex.Unlock()
+    transport.update(ref, func(chat *webChat, k int) {
+        chat.messages = append(chat.messages[:k], chat.messages[k + 1:]...)
+        chat.broadcast(webMessage{Type: "delete", ID: ref.MessageID})
+    })
+    return nil
+}
+
+func (transport *WebTransport) Bind(router *Router) {
+    transport.router = router
+}
+
+func (transport *WebTransport) Start() {
+    if err := transport.server.Serve(transport.listener); err != http.ErrServerClosed {
+        log.Println("Web server failed", err)
+    }
+}
+
+func (transport *WebTransport) Stop() {
+    ctx, cancel := context.WithTimeout(context.Background(), 5 * time.Second)
+    defer cancel()
+    transport.server.Shutdown(ctx)
+
+    transport.mutex.Lock()
+    defer transport.mutex.Unlock()
+    for _, chat := range transport.chats {
+        for c := range chat.conns {
+            delete(chat.conns, c)
+            close(c.out)
+        }
+    }
+}
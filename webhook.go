@@ -0,0 +1,91 @@
+package main
+
+import (
+    "context"
+    "crypto/subtle"
+    "encoding/json"
+    "log"
+    "net/http"
+    "time"
+
+    telebot "github.com/tucnak/telebot"
+)
+
+const secretTokenHeader = "X-Telegram-Bot-Api-Secret-Token"
+
+// WebhookPoller receives updates over HTTP. Unlike telebot.Webhook it answers
+// bad requests with proper status codes and only touches setWebhook when a
+// public URL is configured, so it can run behind a proxy that registered the
+// hook itself or be fed fake updates locally.
+type WebhookPoller struct {
+    config WebhookConfig
+}
+
+func NewWebhookPoller(config WebhookConfig) *WebhookPoller {
+    return &WebhookPoller{config: config}
+}
+
+func (poller *WebhookPoller) handler(dest chan telebot.Update) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if r.Method != http.MethodPost {
+            http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+            return
+        }
+        if secret := poller.config.SecretToken; secret != "" &&
+            subtle.ConstantTimeCompare([]byte(r.Header.Get(secretTokenHeader)), []byte(secret)) != 1 {
+            http.Error(w, "forbidden", http.StatusForbidden)
+            return
+        }
+        var update telebot.Update
+        if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1 << 20)).Decode(&update); err != nil {
+            http.Error(w, "bad update", http.StatusBadRequest)
+            return
+        }
+        select {
+        case dest <- update:
+        case <-r.Context().Done():
+        }
+    })
+}
+
+func (poller *WebhookPoller) Poll(bot *telebot.Bot, dest chan telebot.Update, stop chan struct{}) {
+    config := poller.config
+    if config.PublicURL != "" {
+        webhook := &telebot.Webhook{
+            SecretToken: config.SecretToken,
+            Endpoint: &telebot.WebhookEndpoint{PublicURL: config.PublicURL, Cert: config.PublicCert},
+        }
+        if err := bot.SetWebhook(webhook); err != nil {
+            log.Fatal("Failed to register webhook ", err)
+        }
+        log.Println("Webhook registered at", config.PublicURL)
+    }
+
+    mux := http.NewServeMux()
+    mux.Handle(config.Path, poller.handler(dest))
+    server := &http.Server{Addr: config.Listen, Handler: mux}
+    go func() {
+        var err error
+        if config.TLSCert != "" {
+            err = server.ListenAndServeTLS(config.TLSCert, config.TLSKey)
+        } else {
+            err = server.ListenAndServe()
+        }
+        if err != http.ErrServerClosed {
+            log.Fatal("Webhook server failed ", err)
+        }
+    }()
+    log.Println("Listening for webhook updates on", config.Listen + config.Path)
+
+    <-stop
+    ctx, cancel := context.WithTimeout(context.Background(), 5 * time.Second)
+    defer cancel()
+    server.Shutdown(ctx)
+}
+
+func newPoller(config Config) telebot.Poller {
+    if config.Poller.Mode == pollerWebhook {
+        return NewWebhookPoller(config.Webhook)
+    }
+    return &telebot.LongPoller{Timeout: config.Poller.Timeout, Limit: config.Poller.Limit}
+}